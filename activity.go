@@ -0,0 +1,127 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"encoding/gob"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// activityKey holds the activity log within session.Values
+const activityKey = reservedKeyPrefix + "activity"
+
+func init() {
+	gob.Register([]ActivityEntry{})
+}
+
+// ActivityEntry records a single request made with a session
+type ActivityEntry struct {
+	Time time.Time
+	Path string
+	IP   string
+}
+
+type skipActivityKey struct{}
+
+// SkipActivity returns a context that prevents Save from recording activity for the
+// request e.g. for health checks.  Use with req.WithContext.
+func SkipActivity(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipActivityKey{}, true)
+}
+
+// Activity returns the recent activity recorded for the session, oldest first.
+// Activity is only recorded when the store is configured with ActivityLog.
+func Activity(session *sessions.Session) []ActivityEntry {
+	entries, _ := session.Values[activityKey].([]ActivityEntry)
+	return entries
+}
+
+// recordActivity appends an entry for req to the session's activity log, evicting
+// the oldest entries beyond the configured limit
+func (store *Store) recordActivity(req *http.Request, session *sessions.Session) {
+	if store.activityLimit <= 0 {
+		return
+	}
+	if skip, _ := req.Context().Value(skipActivityKey{}).(bool); skip {
+		return
+	}
+
+	ip := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	entry := ActivityEntry{
+		Time: store.now().UTC(),
+		Path: req.URL.Path,
+		IP:   ip,
+	}
+
+	if session.Values == nil {
+		session.Values = map[interface{}]interface{}{}
+	}
+	session.Values[activityKey] = appendActivity(Activity(session), entry, store.activityLimit)
+}
+
+// decodeActivity converts the activity log as JSON or Msgpack decode it, a slice of
+// maps holding the time as a time.Time or formatted per RFC 3339, to []ActivityEntry
+func decodeActivity(v interface{}) ([]ActivityEntry, bool) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	entries := make([]ActivityEntry, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		var entry ActivityEntry
+		switch t := m["Time"].(type) {
+		case time.Time:
+			entry.Time = t.UTC()
+		case string:
+			parsed, err := time.Parse(time.RFC3339Nano, t)
+			if err != nil {
+				return nil, false
+			}
+			entry.Time = parsed.UTC()
+		default:
+			return nil, false
+		}
+		entry.Path, _ = m["Path"].(string)
+		entry.IP, _ = m["IP"].(string)
+		entries = append(entries, entry)
+	}
+	return entries, true
+}
+
+// appendActivity returns a new slice containing entries plus entry, capped at n
+func appendActivity(entries []ActivityEntry, entry ActivityEntry, n int) []ActivityEntry {
+	if len(entries) >= n {
+		entries = entries[len(entries)-n+1:]
+	}
+
+	out := make([]ActivityEntry, 0, len(entries)+1)
+	out = append(out, entries...)
+	return append(out, entry)
+}
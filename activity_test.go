@@ -0,0 +1,84 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestActivityLog(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	store := &Store{
+		activityLimit: 3,
+		now:           func() time.Time { return now },
+	}
+	session := sessions.NewSession(store, "blah")
+
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost/page/"+strconv.Itoa(i), nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		store.recordActivity(req, session)
+		now = now.Add(time.Second)
+	}
+
+	entries := Activity(session)
+	if v := len(entries); v != 3 {
+		t.Fatalf("expected 3 entries; got %v", v)
+	}
+	for i, entry := range entries {
+		if want := "/page/" + strconv.Itoa(i+2); entry.Path != want {
+			t.Errorf("expected %v; got %v", want, entry.Path)
+		}
+		if entry.IP != "10.0.0.1" {
+			t.Errorf("expected 10.0.0.1; got %v", entry.IP)
+		}
+	}
+
+	// Round Trip -------------------------
+
+	for label, s := range map[string]serializer{"gob": &gobSerializer{}, "json": &jsonSerializer{}, "msgpack": &msgpackSerializer{}} {
+		av, err := s.marshal("blah", session)
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		restored := &sessions.Session{}
+		if err := s.unmarshal("blah", av, restored); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		got := Activity(restored)
+		if v := len(got); v != 3 {
+			t.Fatalf("%v: expected 3 entries after round trip; got %v", label, v)
+		}
+		for i, entry := range got {
+			if want := entries[i]; !entry.Time.Equal(want.Time) || entry.Path != want.Path || entry.IP != want.IP {
+				t.Errorf("%v: expected %v; got %v", label, want, entry)
+			}
+		}
+	}
+
+	// Skip -------------------------------
+
+	req, _ := http.NewRequest("GET", "http://localhost/health", nil)
+	req = req.WithContext(SkipActivity(req.Context()))
+	store.recordActivity(req, session)
+	if last := Activity(session)[2]; last.Path == "/health" {
+		t.Error("expected skipped request not to be recorded")
+	}
+}
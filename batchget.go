@@ -0,0 +1,166 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// batchGetSize is the maximum number of keys per BatchGetItem request
+const batchGetSize = 100
+
+var errBatchGetAPI = errors.New("dynamodb client does not support batch get")
+
+// BatchGetAPI holds the call used by LoadMulti.  The *dynamodb.Client satisfies
+// both DynamoDBAPI and BatchGetAPI.
+type BatchGetAPI interface {
+	BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
+// LoadMulti loads the sessions with the given ids using BatchGetItem, keyed by id.
+// Ids that are missing, expired, quarantined or cannot be decoded are absent from
+// the result.  Reads are strongly consistent unless EventuallyConsistentReads is
+// set.  The DynamoDB client, or ReadClient if set, must implement BatchGetAPI.
+func (store *Store) LoadMulti(ctx context.Context, ids []string) (_ map[string]*sessions.Session, err error) {
+	api, ok := store.reader().(BatchGetAPI)
+	if !ok {
+		return nil, errBatchGetAPI
+	}
+
+	done := store.startOperation(OpLoad)
+	defer func() { done(err) }()
+
+	var (
+		keys   = make([]map[string]types.AttributeValue, 0, len(ids))
+		seen   = map[string]struct{}{}
+		tokens = map[string]string{} // derived id -> id
+	)
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue // BatchGetItem rejects duplicate keys
+		}
+		seen[id] = struct{}{}
+		keys = append(keys, store.key(id))
+		tokens[store.deriveKey(id)] = id
+	}
+
+	result := map[string]*sessions.Session{}
+	for i := 0; i < len(keys); i += batchGetSize {
+		end := i + batchGetSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		items, err := store.batchGet(ctx, api, keys[i:end], 50*time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			store.recordItemSize(item)
+			session, err := store.decodeItem(ctx, item)
+			if err != nil {
+				continue
+			}
+			if id, ok := tokens[session.ID]; ok {
+				session.ID = id
+			}
+			result[session.ID] = session
+		}
+	}
+
+	return result, nil
+}
+
+// batchGet reads the items with the given keys, retrying unprocessed keys with
+// exponential backoff
+func (store *Store) batchGet(ctx context.Context, api BatchGetAPI, keys []map[string]types.AttributeValue, backoff time.Duration) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+
+	request := map[string]types.KeysAndAttributes{
+		store.tableName: {
+			Keys:           keys,
+			ConsistentRead: store.consistentRead(),
+		},
+	}
+	for attempt := 0; ; attempt++ {
+		out, err := api.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems:           request,
+			ReturnConsumedCapacity: store.returnConsumedCapacity(),
+		})
+		if err != nil {
+			store.printf("dynastore: BatchGetItem failed - %v\n", err)
+			return nil, err
+		}
+		for i := range out.ConsumedCapacity {
+			store.consumedCapacity(OpLoad, &out.ConsumedCapacity[i])
+		}
+
+		items = append(items, out.Responses[store.tableName]...)
+
+		unprocessed, ok := out.UnprocessedKeys[store.tableName]
+		if !ok || len(unprocessed.Keys) == 0 {
+			return items, nil
+		}
+		if attempt+1 >= maxBatchRetries {
+			store.printf("dynastore: %v keys left unprocessed\n", len(unprocessed.Keys))
+			return nil, errUnprocessedItems
+		}
+		request = map[string]types.KeysAndAttributes{store.tableName: unprocessed}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff << uint(attempt)):
+		}
+	}
+}
+
+// decodeItem decodes an item read without a request, such as by a query or batch
+// get, using the session name stored alongside it.  ErrNotFound is returned for
+// quarantined items.
+func (store *Store) decodeItem(ctx context.Context, item map[string]types.AttributeValue) (*sessions.Session, error) {
+	if _, ok := item[quarantinedField]; ok {
+		return nil, ErrNotFound
+	}
+	if _, ok := item[deletedField]; ok {
+		return nil, ErrNotFound
+	}
+
+	id, ok := item[store.primaryKey].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, ErrMalformedSession
+	}
+
+	var name string
+	if av, ok := item[nameField].(*types.AttributeValueMemberS); ok {
+		name = av.Value
+	}
+
+	session := sessions.NewSession(store, name)
+	if err := store.decode(ctx, name, item, session); err != nil {
+		return nil, err
+	}
+	session.ID = strings.TrimPrefix(id.Value, store.itemPrefix())
+
+	return session, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestLoadMulti(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 150; i++ {
+		session := sessions.NewSession(store, "blah")
+		session.ID = fmt.Sprintf("id-%03d", i)
+		session.Values["n"] = i
+		if err := store.save(ctx, "blah", session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+
+	ids := []string{"missing"}
+	for i := 0; i < 150; i++ {
+		ids = append(ids, fmt.Sprintf("id-%03d", i))
+	}
+	ids = append(ids, "id-000") // duplicate
+
+	found, err := store.LoadMulti(ctx, ids)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := len(found); v != 150 {
+		t.Fatalf("expected 150 sessions; got %v", v)
+	}
+	if _, ok := found["missing"]; ok {
+		t.Error("expected missing id to be absent")
+	}
+
+	session := found["id-042"]
+	if session == nil {
+		t.Fatal("expected id-042")
+	}
+	if v := session.Values["n"]; v != 42 {
+		t.Errorf("expected 42; got %v", v)
+	}
+	if v := session.Name(); v != "blah" {
+		t.Errorf("expected blah; got %v", v)
+	}
+	if session.IsNew {
+		t.Error("expected loaded session not to be new")
+	}
+
+	var batches int
+	for _, req := range db.Requests() {
+		input, ok := req.(*dynamodb.BatchGetItemInput)
+		if !ok {
+			continue
+		}
+		batches++
+		if v := len(input.RequestItems[DefaultTableName].Keys); v > batchGetSize {
+			t.Errorf("expected at most %v keys; got %v", batchGetSize, v)
+		}
+	}
+	if batches != 2 {
+		t.Errorf("expected 2 batches; got %v", batches)
+	}
+}
+
+func TestLoadMultiUnprocessed(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	for _, id := range []string{"a", "b"} {
+		session := sessions.NewSession(store, "blah")
+		session.ID = id
+		if err := store.save(ctx, "blah", session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+
+	var calls int
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		input := in.(*dynamodb.BatchGetItemInput)
+		calls++
+
+		req := input.RequestItems[DefaultTableName]
+		if calls > 1 {
+			return db.BatchGetItem(ctx, input)
+		}
+
+		// process only the first key
+		processed := req
+		processed.Keys = req.Keys[:1]
+		out, err := db.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{DefaultTableName: processed},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		unprocessed := req
+		unprocessed.Keys = req.Keys[1:]
+		out.UnprocessedKeys = map[string]types.KeysAndAttributes{DefaultTableName: unprocessed}
+		return out, nil
+	})
+	store.ddb = ddb
+
+	found, err := store.LoadMulti(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls; got %v", calls)
+	}
+	if found["a"] == nil || found["b"] == nil {
+		t.Errorf("expected a and b; got %v", found)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// bucketPrefix holds memoized experiment assignments within session.Values
+const bucketPrefix = reservedKeyPrefix + "bucket" + namespaceSeparator
+
+var (
+	errNoSessionID    = errors.New("session has no id")
+	errInvalidWeights = errors.New("variants and weights must be non-empty, of equal length and have a positive total")
+)
+
+func init() {
+	gob.Register(Assignment{})
+}
+
+// Assignment records the variant a session was bucketed into for an experiment
+type Assignment struct {
+	Variant    string
+	AssignedAt time.Time
+}
+
+// Bucket returns the variant of experiment assigned to the session.  The variant is
+// derived deterministically from the session ID and experiment name, so every
+// process computes the same assignment, with variants chosen in proportion to
+// weights.  The assignment is memoized in the session so that later changes to
+// the weights don't reshuffle existing sessions; the session must be saved for
+// the memo to persist.
+func Bucket(session *sessions.Session, experiment string, variants []string, weights []float64) (string, error) {
+	if session.ID == "" {
+		return "", errNoSessionID
+	}
+
+	key := bucketPrefix + experiment
+	if a, ok := session.Values[key].(Assignment); ok && contains(variants, a.Variant) {
+		return a.Variant, nil
+	}
+
+	variant, err := bucketFor(session.ID, experiment, variants, weights)
+	if err != nil {
+		return "", err
+	}
+
+	if session.Values == nil {
+		session.Values = map[interface{}]interface{}{}
+	}
+	session.Values[key] = Assignment{
+		Variant:    variant,
+		AssignedAt: sessionNow(session).UTC(),
+	}
+
+	return variant, nil
+}
+
+// Assignments returns all memoized experiment assignments for the session keyed by experiment
+func Assignments(session *sessions.Session) map[string]Assignment {
+	assignments := map[string]Assignment{}
+	for k, v := range session.Values {
+		key, ok := k.(string)
+		if !ok || !strings.HasPrefix(key, bucketPrefix) {
+			continue
+		}
+		if a, ok := v.(Assignment); ok {
+			assignments[strings.TrimPrefix(key, bucketPrefix)] = a
+		}
+	}
+	return assignments
+}
+
+// bucketFor deterministically maps id and experiment onto one of the weighted variants
+func bucketFor(id, experiment string, variants []string, weights []float64) (string, error) {
+	if len(variants) == 0 || len(variants) != len(weights) {
+		return "", errInvalidWeights
+	}
+
+	total := 0.0
+	for _, w := range weights {
+		if w < 0 {
+			return "", errInvalidWeights
+		}
+		total += w
+	}
+	if total <= 0 {
+		return "", errInvalidWeights
+	}
+
+	sum := sha256.Sum256([]byte(experiment + "\x00" + id))
+	point := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53) * total
+
+	for i, w := range weights {
+		if point < w {
+			return variants[i], nil
+		}
+		point -= w
+	}
+
+	// only reachable through floating point rounding; use the last weighted variant
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return variants[i], nil
+		}
+	}
+	return variants[len(variants)-1], nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
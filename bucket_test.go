@@ -0,0 +1,111 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestBucket(t *testing.T) {
+	variants := []string{"control", "treatment"}
+
+	session := &sessions.Session{ID: "abc", Values: map[interface{}]interface{}{}}
+	variant, err := Bucket(session, "checkout", variants, []float64{0.5, 0.5})
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// derivation is stable without memoization
+	other := &sessions.Session{ID: "abc", Values: map[interface{}]interface{}{}}
+	if v, _ := Bucket(other, "checkout", variants, []float64{0.5, 0.5}); v != variant {
+		t.Errorf("expected %v; got %v", variant, v)
+	}
+
+	// memoized assignment survives weight changes and a save/load cycle
+	s := &gobSerializer{}
+	av, err := s.marshal("blah", session)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	restored := &sessions.Session{}
+	if err := s.unmarshal("blah", av, restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	weights := []float64{1, 0}
+	if variant == "control" {
+		weights = []float64{0, 1}
+	}
+	if v, _ := Bucket(restored, "checkout", variants, weights); v != variant {
+		t.Errorf("expected memoized %v; got %v", variant, v)
+	}
+
+	assignments := Assignments(restored)
+	if v := len(assignments); v != 1 {
+		t.Fatalf("expected 1 assignment; got %v", v)
+	}
+	if a := assignments["checkout"]; a.Variant != variant || a.AssignedAt.IsZero() {
+		t.Errorf("expected %v with assignment time; got %#v", variant, a)
+	}
+}
+
+func TestBucketWeights(t *testing.T) {
+	variants := []string{"a", "b", "c"}
+	weights := []float64{0.7, 0.2, 0.1}
+
+	const n = 100000
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		v, err := bucketFor("session-"+strconv.Itoa(i), "experiment", variants, weights)
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		counts[v]++
+	}
+
+	for i, variant := range variants {
+		got := float64(counts[variant]) / n
+		if math.Abs(got-weights[i]) > 0.01 {
+			t.Errorf("expected %v to be assigned ~%v; got %v", variant, weights[i], got)
+		}
+	}
+}
+
+func TestBucketInvalid(t *testing.T) {
+	testCases := map[string]struct {
+		id       string
+		variants []string
+		weights  []float64
+	}{
+		"no id":      {variants: []string{"a"}, weights: []float64{1}},
+		"empty":      {id: "abc"},
+		"mismatched": {id: "abc", variants: []string{"a", "b"}, weights: []float64{1}},
+		"negative":   {id: "abc", variants: []string{"a", "b"}, weights: []float64{1, -1}},
+		"zero":       {id: "abc", variants: []string{"a", "b"}, weights: []float64{0, 0}},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			session := &sessions.Session{ID: tc.id}
+			if _, err := Bucket(session, "experiment", tc.variants, tc.weights); err == nil {
+				t.Error("expected error; got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+type requestCacheKey struct{}
+
+// requestCache holds the sessions loaded during a request; see WithRequestCache
+type requestCache struct {
+	mutex    sync.Mutex
+	sessions map[cacheKey]*sessions.Session
+}
+
+type cacheKey struct {
+	store *Store
+	name  string
+	id    string
+}
+
+// cached returns a copy of the session with the given name and id loaded earlier in
+// the request
+func (store *Store) cached(req *http.Request, name, id string) (*sessions.Session, bool) {
+	if !store.requestCache {
+		return nil, false
+	}
+
+	rc, ok := req.Context().Value(requestCacheKey{}).(*requestCache)
+	if !ok {
+		return nil, false
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	s, ok := rc.sessions[cacheKey{store: store, name: name, id: id}]
+	if !ok {
+		return nil, false
+	}
+	return copySession(s), true
+}
+
+// cache remembers a copy of session for the remainder of the request
+func (store *Store) cache(req *http.Request, session *sessions.Session) {
+	if !store.requestCache {
+		return
+	}
+
+	rc, ok := req.Context().Value(requestCacheKey{}).(*requestCache)
+	if !ok {
+		rc = &requestCache{}
+		*req = *req.WithContext(context.WithValue(req.Context(), requestCacheKey{}, rc))
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if rc.sessions == nil {
+		rc.sessions = map[cacheKey]*sessions.Session{}
+	}
+	rc.sessions[cacheKey{store: store, name: session.Name(), id: session.ID}] = copySession(session)
+}
+
+// copySession returns a copy of session that shares no mutable state with it
+func copySession(session *sessions.Session) *sessions.Session {
+	dup := sessions.NewSession(session.Store(), session.Name())
+	dup.ID = session.ID
+	dup.IsNew = session.IsNew
+	if session.Options != nil {
+		options := *session.Options
+		dup.Options = &options
+	}
+	for k, v := range session.Values {
+		dup.Values[k] = copyValue(v)
+	}
+	if st, ok := lookupState(session); ok {
+		state := *st
+		if st.options != nil {
+			options := *st.options
+			state.options = &options
+		}
+		*stateOf(dup) = state
+	}
+	return dup
+}
+
+// copyValue deep copies the maps and slices produced by decoding session values;
+// other values are returned as is
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		dup := make(map[interface{}]interface{}, len(v))
+		for k, item := range v {
+			dup[k] = copyValue(item)
+		}
+		return dup
+	case map[string]interface{}:
+		dup := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			dup[k] = copyValue(item)
+		}
+		return dup
+	case []interface{}:
+		dup := make([]interface{}, len(v))
+		for i, item := range v {
+			dup[i] = copyValue(item)
+		}
+		return dup
+	case map[string]string:
+		dup := make(map[string]string, len(v))
+		for k, item := range v {
+			dup[k] = item
+		}
+		return dup
+	case []string:
+		return append([]string(nil), v...)
+	case []byte:
+		return append([]byte(nil), v...)
+	default:
+		return v
+	}
+}
+
+// uncache forgets session so it is loaded again by the next New of the request
+func (store *Store) uncache(req *http.Request, session *sessions.Session) {
+	if !store.requestCache || req == nil {
+		return
+	}
+
+	rc, ok := req.Context().Value(requestCacheKey{}).(*requestCache)
+	if !ok {
+		return
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	delete(rc.sessions, cacheKey{store: store, name: session.Name(), id: session.ID})
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestRequestCache(t *testing.T) {
+	testCases := map[string]struct {
+		opts []Option
+		want []int
+	}{
+		"cached":   {opts: []Option{WithRequestCache()}, want: []int{1, 1, 2, 3}},
+		"uncached": {want: []int{1, 2, 3, 4}},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			store, err := New(append([]Option{DynamoDB(db)}, tc.opts...)...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			gets := func() (n int) {
+				for _, r := range db.Requests() {
+					if _, ok := r.(*dynamodb.GetItemInput); ok {
+						n++
+					}
+				}
+				return n
+			}
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			w := httptest.NewRecorder()
+			session, _ := store.New(req, "blah")
+			if err := session.Save(req, w); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			cookie := w.Result().Cookies()[0]
+
+			newRequest := func() *http.Request {
+				req := httptest.NewRequest("GET", "http://localhost", nil)
+				req.AddCookie(cookie)
+				return req
+			}
+
+			// auth and csrf middleware both call New
+			req = newRequest()
+			auth, _ := store.New(req, "blah")
+			if v := gets(); v != tc.want[0] {
+				t.Errorf("expected %v GetItem; got %v", tc.want[0], v)
+			}
+			csrf, _ := store.New(req, "blah")
+			if v := gets(); v != tc.want[1] {
+				t.Errorf("expected %v GetItem; got %v", tc.want[1], v)
+			}
+			if auth == csrf || auth.ID != csrf.ID {
+				t.Errorf("expected a copy of session %v; got %v", auth.ID, csrf.ID)
+			}
+
+			// saving invalidates the cache
+			if err := auth.Save(req, httptest.NewRecorder()); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			store.New(req, "blah")
+			if v := gets(); v != tc.want[2] {
+				t.Errorf("expected %v GetItem; got %v", tc.want[2], v)
+			}
+
+			// the cache does not outlive the request
+			store.New(newRequest(), "blah")
+			if v := gets(); v != tc.want[3] {
+				t.Errorf("expected %v GetItem; got %v", tc.want[3], v)
+			}
+		})
+	}
+}
+
+func TestCopySession(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["m"] = map[string]interface{}{"a": []interface{}{"b"}}
+	session.Values["b"] = []byte("hello")
+
+	dup := copySession(session)
+	if !reflect.DeepEqual(dup.Values, session.Values) {
+		t.Fatalf("expected %v; got %v", session.Values, dup.Values)
+	}
+
+	dup.Values["m"].(map[string]interface{})["a"].([]interface{})[0] = "c"
+	dup.Values["b"].([]byte)[0] = 'J'
+	dup.Values["n"] = 1
+	dup.Options.MaxAge = -1
+
+	if got := session.Values["m"].(map[string]interface{})["a"].([]interface{})[0]; got != "b" {
+		t.Errorf("expected b; got %v", got)
+	}
+	if got := string(session.Values["b"].([]byte)); got != "hello" {
+		t.Errorf("expected hello; got %v", got)
+	}
+	if _, ok := session.Values["n"]; ok {
+		t.Error("expected n to be absent from the original")
+	}
+	if session.Options.MaxAge == -1 {
+		t.Error("expected options to be copied")
+	}
+}
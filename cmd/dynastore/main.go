@@ -15,108 +15,491 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/savaki/dynastore"
 )
 
 func main() {
 	var (
 		tableName     = flag.String("table", dynastore.DefaultTableName, "DynamoDB table name")
-		ttl           = flag.String("ttl", "ttl", "DynamoDB TTL field")
+		primaryKey    = flag.String("key", dynastore.DefaultPrimaryKey, "DynamoDB hash key attribute")
+		sortKey       = flag.String("sort-key", "", "DynamoDB sort key attribute; the table has a hash key only when empty")
+		sortValue     = flag.String("sort-value", "SESSION", "Sort key value of sessions with -sort-key; {id} is replaced with the session id")
+		ttl           = flag.String("ttl-attribute", "ttl", "DynamoDB TTL attribute; TTL is not enabled when empty")
+		billingMode   = flag.String("billing-mode", "provisioned", "DynamoDB billing mode, ondemand or provisioned")
+		wait          = flag.Bool("wait", false, "Wait until the table is usable, or fully deleted with -delete")
+		timeout       = flag.Duration("timeout", 5*time.Minute, "Maximum time to wait with -wait")
+		yes           = flag.Bool("yes", false, "Delete the table without asking for confirmation")
 		delete        = flag.Bool("delete", false, "Delete the table")
+		prune         = flag.Bool("prune", false, "Delete expired sessions from tables without DynamoDB TTL")
+		segments      = flag.Int("segments", 1, "Number of parallel scan segments used by -prune")
 		readCapacity  = flag.Int64("read", 5, "Provisioned DynamoDB Read capacity")
 		writeCapacity = flag.Int64("write", 5, "Provisioned DynamoDB Write capacity")
+		gsiIndex      = flag.String("gsi-index", "", "Name of a global secondary index to create; requires -gsi-attribute")
+		gsiAttribute  = flag.String("gsi-attribute", "", "Session value indexed by -gsi-index e.g. user_id")
+		describe      = flag.Bool("describe", false, "Print the table status, item count, billing mode, TTL and indexes")
+		get           = flag.String("get", "", "Print the session with the given id")
+		redact        = flag.Bool("redact", false, "Print only the types of session values with -get")
+		keyPrefix     = flag.String("key-prefix", "", "KeyPrefix the sessions were written with, for -get")
+		jsonValues    = flag.Bool("json", false, "Sessions are stored with dynastore.JSON, for -get")
+		msgpackValues = flag.Bool("msgpack", false, "Sessions are stored with dynastore.Msgpack, for -get")
+		quarantined   = flag.Bool("quarantine-report", false, "Count the sessions quarantined by dynastore.QuarantineCorrupt by format")
 	)
+	flag.StringVar(ttl, "ttl", "ttl", "Deprecated: use -ttl-attribute")
 	flag.Parse()
 
+	if *billingMode != "ondemand" && *billingMode != "provisioned" {
+		fmt.Printf("** ERR *** -billing-mode must be ondemand or provisioned; got %v\n", *billingMode)
+		os.Exit(1)
+	}
+	if (*gsiIndex == "") != (*gsiAttribute == "") {
+		fmt.Println("** ERR *** -gsi-index and -gsi-attribute must be set together")
+		os.Exit(1)
+	}
+
+	keyOption := dynastore.PrimaryKey(*primaryKey)
+	if *sortKey != "" {
+		keyOption = dynastore.CompositeKey(*primaryKey, *sortKey, *sortValue)
+	}
+
 	region := os.Getenv("AWS_DEFAULT_REGION")
 	if region == "" {
 		region = os.Getenv("AWS_REGION")
 	}
 
-	cfg := &aws.Config{Region: aws.String(region)}
-	s, err := session.NewSession(cfg)
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
-		log.Fatalf("Unable to create AWS session - %v\n", err)
+		log.Fatalf("Unable to load AWS config - %v\n", err)
 	}
 
-	api := dynamodb.New(s)
-	if *delete {
+	api := dynamodb.NewFromConfig(cfg)
+	if *describe {
+		if err := describeTable(ctx, api, *tableName); err != nil {
+			fmt.Printf("** ERR *** unable to describe dynamodb table - %v\n", err)
+			os.Exit(1)
+		}
+
+	} else if *quarantined {
+		if err := quarantineReport(ctx, api, *tableName); err != nil {
+			fmt.Printf("** ERR *** unable to report quarantined sessions - %v\n", err)
+			os.Exit(1)
+		}
+
+	} else if *get != "" {
+		opts := []dynastore.Option{
+			dynastore.DynamoDB(api),
+			dynastore.TableName(*tableName),
+			keyOption,
+			dynastore.TTLField(*ttl),
+		}
+		if *keyPrefix != "" {
+			opts = append(opts, dynastore.KeyPrefix(*keyPrefix))
+		}
+		if *jsonValues {
+			opts = append(opts, dynastore.JSON())
+		}
+		if *msgpackValues {
+			opts = append(opts, dynastore.Msgpack())
+		}
+		store, err := dynastore.New(opts...)
+		if err != nil {
+			fmt.Printf("** ERR *** unable to create store - %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := printSession(ctx, api, store, *primaryKey, *sortKey, *sortValue, *ttl, *keyPrefix, *get, *redact); err != nil {
+			fmt.Printf("** ERR *** unable to get session - %v\n", err)
+			os.Exit(1)
+		}
+
+	} else if *prune {
+		fmt.Printf("Deleting expired sessions from dynamodb table, %v [%v]\n", *tableName, region)
+		store, err := dynastore.New(
+			dynastore.DynamoDB(api),
+			dynastore.TableName(*tableName),
+			keyOption,
+			dynastore.TTLField(*ttl),
+		)
+		if err != nil {
+			fmt.Printf("** ERR *** unable to create store - %v\n", err)
+			os.Exit(1)
+		}
+
+		n, err := store.DeleteExpired(ctx, time.Now(), dynastore.ScanSegments(*segments))
+		if err != nil {
+			fmt.Printf("** ERR *** unable to delete expired sessions - %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Successfully deleted %v expired sessions\n", n)
+
+	} else if *delete {
+		if !*yes && !confirm(fmt.Sprintf("Delete dynamodb table, %v [%v]? [y/N] ", *tableName, region)) {
+			fmt.Println("Aborted")
+			return
+		}
+
 		fmt.Printf("Deleting dynamodb table, %v [%v]\n", *tableName, region)
-		_, err := api.DeleteTable(&dynamodb.DeleteTableInput{
+		_, err := api.DeleteTable(ctx, &dynamodb.DeleteTableInput{
 			TableName: tableName,
 		})
 		if err != nil {
 			fmt.Printf("** ERR *** unable to delete dynamodb table - %v\n", err)
 			os.Exit(1)
 		}
+
+		if *wait {
+			fmt.Println("Waiting for table to be deleted ...")
+			waiter := dynamodb.NewTableNotExistsWaiter(api)
+			if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: tableName}, *timeout); err != nil {
+				fmt.Printf("** ERR *** table was not deleted - %v\n", err)
+				os.Exit(1)
+			}
+		}
 		fmt.Println("Successfully deleted table")
 
 	} else {
 		fmt.Printf("Creating dynamodb table, %v [%v]\n", *tableName, region)
-		_, err := api.CreateTable(&dynamodb.CreateTableInput{
+		input := &dynamodb.CreateTableInput{
 			TableName: tableName,
-			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			AttributeDefinitions: []types.AttributeDefinition{
 				{
-					AttributeName: aws.String("id"),
-					AttributeType: aws.String("S"),
+					AttributeName: primaryKey,
+					AttributeType: types.ScalarAttributeTypeS,
 				},
 			},
-			KeySchema: []*dynamodb.KeySchemaElement{
+			KeySchema: []types.KeySchemaElement{
 				{
-					AttributeName: aws.String("id"),
-					KeyType:       aws.String("HASH"),
+					AttributeName: primaryKey,
+					KeyType:       types.KeyTypeHash,
 				},
 			},
-			ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+		}
+		if *sortKey != "" {
+			input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{
+				AttributeName: sortKey,
+				AttributeType: types.ScalarAttributeTypeS,
+			})
+			input.KeySchema = append(input.KeySchema, types.KeySchemaElement{
+				AttributeName: sortKey,
+				KeyType:       types.KeyTypeRange,
+			})
+		}
+		if *billingMode == "ondemand" {
+			input.BillingMode = types.BillingModePayPerRequest
+		} else {
+			input.BillingMode = types.BillingModeProvisioned
+			input.ProvisionedThroughput = &types.ProvisionedThroughput{
 				ReadCapacityUnits:  readCapacity,
 				WriteCapacityUnits: writeCapacity,
-			},
-		})
+			}
+		}
+		if *gsiIndex != "" {
+			input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{
+				AttributeName: gsiAttribute,
+				AttributeType: types.ScalarAttributeTypeS,
+			})
+			input.GlobalSecondaryIndexes = []types.GlobalSecondaryIndex{
+				{
+					IndexName: gsiIndex,
+					KeySchema: []types.KeySchemaElement{
+						{
+							AttributeName: gsiAttribute,
+							KeyType:       types.KeyTypeHash,
+						},
+					},
+					Projection:            &types.Projection{ProjectionType: types.ProjectionTypeAll},
+					ProvisionedThroughput: input.ProvisionedThroughput,
+				},
+			}
+		}
+
+		_, err := api.CreateTable(ctx, input)
 		if err != nil {
-			if v, ok := err.(awserr.Error); ok {
-				if v.Code() == "ResourceInUseException" {
-					fmt.Println("Table already exists")
-					return
-				}
+			var inUse *types.ResourceInUseException
+			if errors.As(err, &inUse) {
+				fmt.Println("Table already exists")
+				return
 			}
 			fmt.Printf("** ERR *** unable to create dynamodb table - %v\n", err)
 			os.Exit(1)
 		}
 		fmt.Println("Successfully created table")
 
-		fmt.Printf("Configuring TTL on dynamodb table, %v [%v]\n", *tableName, region)
-		for i := 0; i < 12; i++ {
-			_, err = api.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+		// TTL can only be configured once the table is ACTIVE
+		if *wait || *ttl != "" {
+			fmt.Println("Waiting for table to be created ...")
+			waiter := dynamodb.NewTableExistsWaiter(api)
+			if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: tableName}, *timeout); err != nil {
+				fmt.Printf("** ERR *** table did not become active - %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if *ttl != "" {
+			fmt.Printf("Configuring TTL on dynamodb table, %v [%v]\n", *tableName, region)
+			_, err = api.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
 				TableName: tableName,
-				TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+				TimeToLiveSpecification: &types.TimeToLiveSpecification{
 					AttributeName: ttl,
 					Enabled:       aws.Bool(true),
 				},
 			})
 			if err != nil {
-				if v, ok := err.(awserr.Error); ok {
-					if code := v.Code(); code == "ResourceNotFoundException" || code == "ResourceInUseException" {
-						fmt.Println("Waiting for table to be created ...")
-						time.Sleep(time.Second * 10)
-						continue
-					}
-				}
 				fmt.Printf("** ERR *** unable to configure ttl for table - %v\n", err)
 				os.Exit(1)
 			}
+			fmt.Println("Successfully configured TTL")
+		}
+	}
+}
+
+// describeTable prints the state of the table, its TTL and its indexes
+func describeTable(ctx context.Context, api *dynamodb.Client, tableName string) error {
+	out, err := api.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return err
+	}
+	table := out.Table
+
+	billingMode := types.BillingModeProvisioned
+	if table.BillingModeSummary != nil {
+		billingMode = table.BillingModeSummary.BillingMode
+	}
+
+	fmt.Printf("Table:        %v\n", aws.ToString(table.TableName))
+	fmt.Printf("Status:       %v\n", table.TableStatus)
+	fmt.Printf("Items:        %v (approximate)\n", aws.ToInt64(table.ItemCount))
+	fmt.Printf("Size:         %v bytes\n", aws.ToInt64(table.TableSizeBytes))
+	fmt.Printf("Billing mode: %v\n", billingMode)
+	if billingMode == types.BillingModeProvisioned && table.ProvisionedThroughput != nil {
+		fmt.Printf("Capacity:     %v read, %v write\n",
+			aws.ToInt64(table.ProvisionedThroughput.ReadCapacityUnits),
+			aws.ToInt64(table.ProvisionedThroughput.WriteCapacityUnits))
+	}
+	for _, key := range table.KeySchema {
+		fmt.Printf("Key:          %v (%v)\n", aws.ToString(key.AttributeName), key.KeyType)
+	}
+
+	ttl, err := api.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return err
+	}
+	if desc := ttl.TimeToLiveDescription; desc != nil && desc.AttributeName != nil {
+		fmt.Printf("TTL:          %v (%v)\n", desc.TimeToLiveStatus, aws.ToString(desc.AttributeName))
+	} else {
+		fmt.Println("TTL:          DISABLED")
+	}
+
+	for _, index := range table.GlobalSecondaryIndexes {
+		var keys []string
+		for _, key := range index.KeySchema {
+			keys = append(keys, aws.ToString(key.AttributeName))
+		}
+		fmt.Printf("Index:        %v on %v (%v, %v items)\n", aws.ToString(index.IndexName), strings.Join(keys, ", "), index.IndexStatus, aws.ToInt64(index.ItemCount))
+	}
+
+	return nil
+}
 
+// quarantineReport scans the table for items quarantined by QuarantineCorrupt and
+// prints their number by format, e.g. to confirm which writer produced them
+func quarantineReport(ctx context.Context, api *dynamodb.Client, tableName string) error {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(tableName),
+		FilterExpression:         aws.String("attribute_exists(#quarantined)"),
+		ExpressionAttributeNames: map[string]string{"#quarantined": "quarantined"},
+	}
+
+	counts := map[string]int{}
+	total := 0
+	for {
+		out, err := api.Scan(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, item := range out.Items {
+			counts[formatOf(item)]++
+			total++
+		}
+		if len(out.LastEvaluatedKey) == 0 {
 			break
 		}
-		fmt.Println("Successfully configured TTL")
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	formats := make([]string, 0, len(counts))
+	for format := range counts {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	fmt.Printf("Quarantined sessions in %v:\n", tableName)
+	for _, format := range formats {
+		fmt.Printf("  %v: %v\n", format, counts[format])
+	}
+	fmt.Printf("Total: %v\n", total)
+	return nil
+}
+
+// formatOf describes how the values of item are stored, along with its schema
+// version, for quarantineReport
+func formatOf(item map[string]types.AttributeValue) string {
+	schema := "0"
+	if n, ok := item["schema"].(*types.AttributeValueMemberN); ok {
+		schema = n.Value
+	}
+
+	format := "no values"
+	switch item["values"].(type) {
+	case *types.AttributeValueMemberS:
+		format = "string (gob or codecs)"
+	case *types.AttributeValueMemberM:
+		format = "map (json)"
+	case *types.AttributeValueMemberB:
+		format = "binary (msgpack or compressed)"
+	default:
+		for name := range item {
+			if strings.HasPrefix(name, "values.") {
+				format = "attributes (value attributes)"
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("schema %v, %v", schema, format)
+}
+
+// printSession prints the attributes of the item holding the session with the
+// given id, then its values as decoded by store
+func printSession(ctx context.Context, api *dynamodb.Client, store *dynastore.Store, primaryKey, sortKey, sortValue, ttlField, keyPrefix, id string, redact bool) error {
+	key := id
+	if keyPrefix != "" {
+		key = keyPrefix + "#" + id
+	}
+
+	input := &dynamodb.GetItemInput{
+		TableName:      aws.String(store.TableName()),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			primaryKey: &types.AttributeValueMemberS{Value: key},
+		},
+	}
+	if sortKey != "" {
+		input.Key[sortKey] = &types.AttributeValueMemberS{Value: strings.ReplaceAll(sortValue, "{id}", key)}
+	}
+
+	out, err := api.GetItem(ctx, input)
+	if err != nil {
+		return err
+	}
+	if len(out.Item) == 0 {
+		fmt.Println("Session not found")
+		return nil
+	}
+
+	var names []string
+	for name := range out.Item {
+		if name == "values" || strings.HasPrefix(name, "values.") {
+			continue // printed once decoded
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Attributes:")
+	for _, name := range names {
+		av := out.Item[name]
+		if n, ok := av.(*types.AttributeValueMemberN); ok && name == ttlField {
+			if v, err := strconv.ParseInt(n.Value, 10, 64); err == nil {
+				expiresAt := time.Unix(v, 0)
+				fmt.Printf("  %v: %v (%v, in %v)\n", name, n.Value, expiresAt.Format(time.RFC3339), time.Until(expiresAt).Round(time.Second))
+				continue
+			}
+		}
+		fmt.Printf("  %v: %v\n", name, formatAttribute(av))
+	}
+
+	sessions, err := store.LoadMulti(ctx, []string{id})
+	if err != nil {
+		return err
+	}
+	session, ok := sessions[id]
+	if !ok {
+		fmt.Println("Values: unable to decode; the session may be expired, quarantined, deleted, encrypted or stored with a different -json/-msgpack setting")
+		return nil
+	}
+
+	keys := make([]string, 0, len(session.Values))
+	values := map[string]interface{}{}
+	for k, v := range session.Values {
+		key := fmt.Sprint(k)
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+
+	fmt.Println("Values:")
+	for _, key := range keys {
+		if redact {
+			fmt.Printf("  %v: <%T>\n", key, values[key])
+		} else {
+			fmt.Printf("  %v: %#v\n", key, values[key])
+		}
+	}
+	return nil
+}
+
+// formatAttribute renders av compactly for printSession
+func formatAttribute(av types.AttributeValue) string {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return strconv.Quote(v.Value)
+	case *types.AttributeValueMemberN:
+		return v.Value
+	case *types.AttributeValueMemberBOOL:
+		return strconv.FormatBool(v.Value)
+	case *types.AttributeValueMemberB:
+		return fmt.Sprintf("<%v bytes>", len(v.Value))
+	case *types.AttributeValueMemberM:
+		var keys []string
+		for k := range v.Value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var fields []string
+		for _, k := range keys {
+			fields = append(fields, k+": "+formatAttribute(v.Value[k]))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	default:
+		return fmt.Sprintf("%T", av)
+	}
+}
+
+// confirm prints prompt and returns true if the user answers yes
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
 	}
 }
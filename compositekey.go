@@ -0,0 +1,83 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// idPlaceholder is replaced with the session id in the sort key value given to
+// CompositeKey
+const idPlaceholder = "{id}"
+
+// itemKey returns the key of the item with the given item id; see itemID
+func (store *Store) itemKey(itemID string) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{
+		store.primaryKey: &types.AttributeValueMemberS{Value: itemID},
+	}
+	if store.sortKey != "" {
+		key[store.sortKey] = &types.AttributeValueMemberS{Value: strings.ReplaceAll(store.sortValue, idPlaceholder, itemID)}
+	}
+	return key
+}
+
+// keyOf returns the key attributes of item
+func (store *Store) keyOf(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{
+		store.primaryKey: item[store.primaryKey],
+	}
+	if store.sortKey != "" {
+		key[store.sortKey] = item[store.sortKey]
+	}
+	return key
+}
+
+// keyProjection returns the projection expression reading the key attributes of
+// an item, adding the names it refers to
+func (store *Store) keyProjection(names map[string]string) string {
+	names["#id"] = store.primaryKey
+	if store.sortKey == "" {
+		return "#id"
+	}
+	names["#sk"] = store.sortKey
+	return "#id, #sk"
+}
+
+// sortKeyFilter returns the condition matching session items by their sort key,
+// adding the names and values it refers to, or "" if the sort key does not
+// distinguish them from other items in the table
+func (store *Store) sortKeyFilter(names map[string]string, values map[string]types.AttributeValue) string {
+	if store.sortKey == "" {
+		return ""
+	}
+
+	prefix, _, templated := strings.Cut(store.sortValue, idPlaceholder)
+	switch {
+	case !templated:
+		values[":sk"] = &types.AttributeValueMemberS{Value: store.sortValue}
+	case prefix != "":
+		values[":sk"] = &types.AttributeValueMemberS{Value: prefix}
+	default:
+		return ""
+	}
+
+	names["#sk"] = store.sortKey
+	if !templated {
+		return "#sk = :sk"
+	}
+	return "begins_with(#sk, :sk)"
+}
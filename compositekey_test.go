@@ -0,0 +1,230 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestCompositeKey(t *testing.T) {
+	db := &dynastoretest.DB{PrimaryKey: "PK"}
+	store, err := New(DynamoDB(db), CompositeKey("PK", "SK", "SESSION#{id}"), GSI("user-index", "user"), MaxAge(3600))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["user"] = "alice"
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	id := session.ID
+
+	if v, ok := db.Item(id)["SK"].(*types.AttributeValueMemberS); !ok || v.Value != "SESSION#"+id {
+		t.Fatalf("expected sort key SESSION#%v; got %#v", id, db.Item(id)["SK"])
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	loaded, err := store.New(req, "blah")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("expected existing session; got %v", err)
+	}
+	if v := loaded.Values["user"]; v != "alice" {
+		t.Errorf("expected alice; got %v", v)
+	}
+	if err := store.Touch(ctx, id); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if sessions, err := store.LoadMulti(ctx, []string{id}); err != nil || len(sessions) != 1 {
+		t.Fatalf("expected 1 session; got %v, %v", len(sessions), err)
+	}
+	if n, err := store.DeleteExpired(ctx, time.Now()); err != nil || n != 0 {
+		t.Fatalf("expected 0 deleted; got %v, %v", n, err)
+	}
+	if n, err := store.DeleteByAttribute(ctx, "alice"); err != nil || n != 1 {
+		t.Fatalf("expected 1 deleted; got %v, %v", n, err)
+	}
+	if v := db.Len(); v != 0 {
+		t.Errorf("expected no items; got %v", v)
+	}
+
+	want := &types.AttributeValueMemberS{Value: "SESSION#" + id}
+	hasKey := func(t *testing.T, key map[string]types.AttributeValue) {
+		t.Helper()
+		if v, ok := key["PK"].(*types.AttributeValueMemberS); !ok || v.Value != id {
+			t.Errorf("expected PK %v; got %#v", id, key["PK"])
+		}
+		if v, ok := key["SK"].(*types.AttributeValueMemberS); !ok || v.Value != want.Value {
+			t.Errorf("expected SK %v; got %#v", want.Value, key["SK"])
+		}
+	}
+	projectsKey := func(t *testing.T, projection *string, names map[string]string) {
+		t.Helper()
+		if !strings.Contains(aws.ToString(projection), "#sk") || names["#sk"] != "SK" {
+			t.Errorf("expected projection of SK; got %v %v", aws.ToString(projection), names)
+		}
+	}
+
+	for _, r := range db.Requests() {
+		switch in := r.(type) {
+		case *dynamodb.PutItemInput:
+			hasKey(t, in.Item)
+		case *dynamodb.GetItemInput:
+			hasKey(t, in.Key)
+		case *dynamodb.UpdateItemInput:
+			hasKey(t, in.Key)
+		case *dynamodb.DeleteItemInput:
+			hasKey(t, in.Key)
+		case *dynamodb.BatchGetItemInput:
+			for _, keys := range in.RequestItems {
+				for _, key := range keys.Keys {
+					hasKey(t, key)
+				}
+			}
+		case *dynamodb.BatchWriteItemInput:
+			for _, writes := range in.RequestItems {
+				for _, write := range writes {
+					hasKey(t, write.DeleteRequest.Key)
+				}
+			}
+		case *dynamodb.ScanInput:
+			projectsKey(t, in.ProjectionExpression, in.ExpressionAttributeNames)
+			if !strings.Contains(aws.ToString(in.FilterExpression), "begins_with(#sk, :sk)") {
+				t.Errorf("expected sort key filter; got %v", aws.ToString(in.FilterExpression))
+			}
+		case *dynamodb.QueryInput:
+			projectsKey(t, in.ProjectionExpression, in.ExpressionAttributeNames)
+		default:
+			t.Errorf("unexpected request %T", r)
+		}
+	}
+}
+
+func TestCompositeKeyOtherItems(t *testing.T) {
+	db := &dynastoretest.DB{PrimaryKey: "PK", SortKey: "SK"}
+	store, err := New(DynamoDB(db), CompositeKey("PK", "SK", "SESSION"), GSI("user-index", "user"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["user"] = "alice"
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// an item of another type sharing the hash key and GSI value
+	profile := map[string]types.AttributeValue{
+		"PK":   &types.AttributeValueMemberS{Value: "abc"},
+		"SK":   &types.AttributeValueMemberS{Value: "PROFILE"},
+		"user": &types.AttributeValueMemberS{Value: "alice"},
+	}
+	db.SetItem(profile)
+
+	records, err := store.QueryByAttribute(ctx, "alice")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "abc" {
+		t.Fatalf("expected only session abc; got %v", records)
+	}
+
+	if n, err := store.DeleteByAttribute(ctx, "alice"); err != nil || n != 1 {
+		t.Fatalf("expected 1 deleted; got %v, %v", n, err)
+	}
+	if db.ItemByKey(store.key("abc")) != nil {
+		t.Error("expected session to be deleted")
+	}
+	if db.ItemByKey(map[string]types.AttributeValue{"PK": profile["PK"], "SK": profile["SK"]}) == nil {
+		t.Error("expected profile item to remain")
+	}
+}
+
+func TestCompositeKeyConstant(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}), CompositeKey("PK", "SK", "SESSION"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	key := store.key("abc")
+	if v, ok := key["SK"].(*types.AttributeValueMemberS); !ok || v.Value != "SESSION" {
+		t.Errorf("expected SESSION; got %#v", key["SK"])
+	}
+
+	names, values := map[string]string{}, map[string]types.AttributeValue{}
+	if v := store.sortKeyFilter(names, values); v != "#sk = :sk" || names["#sk"] != "SK" {
+		t.Errorf("expected equality filter; got %v", v)
+	}
+}
+
+func TestCompositeKeyCreateTable(t *testing.T) {
+	db := &dynastoretest.DB{PrimaryKey: "PK"}
+	store, err := New(DynamoDB(db), CompositeKey("PK", "SK", "SESSION"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.CreateTableIfNotExists(context.Background()); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	for _, r := range db.Requests() {
+		in, ok := r.(*dynamodb.CreateTableInput)
+		if !ok {
+			continue
+		}
+		if len(in.KeySchema) != 2 || aws.ToString(in.KeySchema[1].AttributeName) != "SK" || in.KeySchema[1].KeyType != types.KeyTypeRange {
+			t.Errorf("expected SK range key; got %#v", in.KeySchema)
+		}
+		return
+	}
+	t.Error("expected CreateTable request")
+}
+
+func TestCompositeKeyInvalid(t *testing.T) {
+	for _, opts := range [][]Option{
+		{CompositeKey("PK", "", "SESSION")},
+		{CompositeKey("PK", "SK", "")},
+	} {
+		if _, err := New(append(opts, DynamoDB(&dynastoretest.DB{}))...); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected ErrInvalidOption; got %v", err)
+		}
+	}
+
+	for _, opts := range [][]Option{
+		{CompositeKey("PK", "PK", "SESSION")},
+		{CompositeKey("PK", "ttl", "SESSION")},
+	} {
+		if _, err := New(append(opts, DynamoDB(&dynastoretest.DB{}))...); !errors.Is(err, errSortKey) {
+			t.Errorf("expected errSortKey; got %v", err)
+		}
+	}
+}
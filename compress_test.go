@@ -0,0 +1,118 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"compress/gzip"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestCompression(t *testing.T) {
+	db := &dynastoretest.DB{}
+	ctx := context.Background()
+
+	plain, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store, err := New(DynamoDB(db), Compression(gzip.BestSpeed))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// sessions written before compression was enabled still load
+	legacy := sessions.NewSession(plain, "blah")
+	legacy.ID = "legacy"
+	legacy.Values["hello"] = "world"
+	if err := plain.save(ctx, "blah", legacy); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["hello"] = strings.Repeat("world", 100)
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, ok := db.Item("abc")[valuesField].(*types.AttributeValueMemberB); !ok {
+		t.Fatalf("expected values to be stored as binary; got %T", db.Item("abc")[valuesField])
+	}
+
+	for id, expected := range map[string]interface{}{"legacy": "world", "abc": session.Values["hello"]} {
+		restored := sessions.NewSession(store, "blah")
+		if err := store.load(ctx, "blah", id, restored); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if v := restored.Values["hello"]; v != expected {
+			t.Errorf("expected %v; got %v", expected, v)
+		}
+	}
+}
+
+func TestCompressionInvalidLevel(t *testing.T) {
+	_, err := New(DynamoDB(&dynastoretest.DB{}), Compression(42))
+	if err == nil {
+		t.Error("expected invalid compression level to be rejected")
+	}
+}
+
+// BenchmarkItemSize reports the stored size of a session holding ~50KB of values
+func BenchmarkItemSize(b *testing.B) {
+	session := &sessions.Session{
+		ID:      "abc",
+		Values:  map[interface{}]interface{}{},
+		Options: &sessions.Options{MaxAge: 60},
+	}
+	for i := 0; session.Values["size"] == nil; i++ {
+		key := "key-" + strconv.Itoa(i)
+		session.Values[key] = strings.Repeat("value-"+strconv.Itoa(i%10)+" ", 10)
+		if i*80 > 50*1024 {
+			session.Values["size"] = i
+		}
+	}
+
+	for _, level := range []int{gzip.NoCompression, gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+		s := &gobSerializer{primaryKey: DefaultPrimaryKey, compress: true, level: level}
+		name := "gzip-" + strconv.Itoa(level)
+		if level == gzip.NoCompression {
+			s = &gobSerializer{primaryKey: DefaultPrimaryKey}
+			name = "raw"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			var size int
+			for i := 0; i < b.N; i++ {
+				av, err := s.marshal("blah", session)
+				if err != nil {
+					b.Fatalf("expected nil; got %v", err)
+				}
+				switch v := av[valuesField].(type) {
+				case *types.AttributeValueMemberS:
+					size = len(v.Value)
+				case *types.AttributeValueMemberB:
+					size = len(v.Value)
+				}
+			}
+			b.ReportMetric(float64(size), "bytes/item")
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+type requestContextKey struct{}
+
+// requestContext holds the context GetCtx wants used while the registry calls New
+type requestContext struct {
+	mutex sync.Mutex
+	ctx   context.Context
+}
+
+// GetCtx behaves like Get, but uses ctx for any DynamoDB calls needed to load the
+// session
+func (store *Store) GetCtx(ctx context.Context, req *http.Request, name string) (*sessions.Session, error) {
+	rc, ok := req.Context().Value(requestContextKey{}).(*requestContext)
+	if !ok {
+		rc = &requestContext{}
+		*req = *req.WithContext(context.WithValue(req.Context(), requestContextKey{}, rc))
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.ctx = ctx
+	defer func() { rc.ctx = nil }()
+
+	return sessions.GetRegistry(req).Get(store, name)
+}
+
+// NewCtx behaves like New, but uses ctx for any DynamoDB calls needed to load the
+// session
+func (store *Store) NewCtx(ctx context.Context, req *http.Request, name string) (*sessions.Session, error) {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	return store.newSession(ctx, req, name)
+}
+
+// SaveCtx behaves like Save, but uses ctx for DynamoDB calls rather than the
+// request's context
+func (store *Store) SaveCtx(ctx context.Context, req *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx, cancel := store.withTimeout(ctx)
+	defer cancel()
+
+	return store.saveSession(ctx, req, w, session)
+}
+
+// contextFor returns the context for DynamoDB calls made on behalf of req.  When
+// WithRequestTimeout is set, the request's cancellation is ignored so saves
+// deferred past the end of the handler still complete.
+func (store *Store) contextFor(req *http.Request) context.Context {
+	ctx := req.Context()
+	if rc, ok := ctx.Value(requestContextKey{}).(*requestContext); ok && rc.ctx != nil {
+		return rc.ctx
+	}
+	if store.requestTimeout > 0 {
+		return context.WithoutCancel(ctx)
+	}
+	return ctx
+}
+
+// withTimeout bounds ctx by the configured request timeout, if any
+func (store *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if store.requestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, store.requestTimeout)
+}
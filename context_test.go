@@ -0,0 +1,128 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	testCases := map[string]struct {
+		Opts    []Option
+		WantErr bool
+	}{
+		"request context": {
+			WantErr: true,
+		},
+		"timeout": {
+			Opts: []Option{WithRequestTimeout(time.Second)},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			store, err := New(append([]Option{DynamoDB(db)}, tc.Opts...)...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			req, _ := http.NewRequest("GET", "http://localhost", nil)
+			req = req.WithContext(ctx)
+
+			session, err := store.New(req, "blah")
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			// handler has returned
+			cancel()
+
+			err = store.Save(req, httptest.NewRecorder(), session)
+			if tc.WantErr {
+				if err == nil {
+					t.Error("expected save with cancelled context to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if db.Len() != 1 {
+				t.Errorf("expected 1 item; got %v", db.Len())
+			}
+		})
+	}
+}
+
+func TestContextVariants(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, err := store.NewCtx(context.Background(), req, "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	if err := store.SaveCtx(context.Background(), req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("GetCtx", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(w.Result().Cookies()[0])
+
+		// a cancelled ctx must prevent the load even though the request's is live
+		got, err := store.GetCtx(cancelled, req, "blah")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled; got %v", err)
+		}
+		if !got.IsNew {
+			t.Error("expected load with cancelled ctx to yield a new session")
+		}
+
+		req, _ = http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(w.Result().Cookies()[0])
+		got, err = store.GetCtx(context.Background(), req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if got.ID != session.ID {
+			t.Errorf("expected %v; got %v", session.ID, got.ID)
+		}
+	})
+
+	t.Run("SaveCtx", func(t *testing.T) {
+		if err := store.SaveCtx(cancelled, req, httptest.NewRecorder(), session); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled; got %v", err)
+		}
+	})
+}
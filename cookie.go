@@ -0,0 +1,149 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"encoding/base32"
+	"errors"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+)
+
+// sessionIDLength is the length of the ids generated by DefaultIDGenerator
+const sessionIDLength = 52
+
+// maxCookieAttempts bounds the number of sessions New attempts to load when the
+// request holds several cookies with the session name, e.g. with different paths
+const maxCookieAttempts = 3
+
+// ErrInvalidSessionID is returned by New when the IDGenerator produces an id that
+// is empty or cannot be stored in a cookie
+var ErrInvalidSessionID = errors.New("invalid session id")
+
+// DefaultIDGenerator returns 256 random bits encoded as unpadded base32
+func DefaultIDGenerator() string {
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+}
+
+// newID returns a new session id from the IDGenerator
+func (store *Store) newID() string {
+	if store.idGenerator == nil {
+		return DefaultIDGenerator()
+	}
+	return store.idGenerator()
+}
+
+// maxAgeCodec is implemented by codecs that reject values older than a maximum
+// age, such as *securecookie.SecureCookie
+type maxAgeCodec interface {
+	MaxAge(age int) *securecookie.SecureCookie
+}
+
+// MaxAge sets the default MaxAge of new sessions along with the maximum age of the
+// cookies and values accepted by each codec supporting it, as CookieStore.MaxAge
+// does, so sessions that outlive the codec default of 30 days remain readable.  An
+// age of 0 removes the limit from the codecs.  MaxAge must be called before the
+// store serves requests; stores derived by WithOptions are not affected.
+func (store *Store) MaxAge(age int) {
+	store.options.MaxAge = age
+	if age < 0 {
+		return
+	}
+	for _, codec := range store.codecs {
+		if c, ok := codec.(maxAgeCodec); ok {
+			c.MaxAge(age)
+		}
+	}
+}
+
+// configureCodecs applies the session MaxAge and MaxLength to each codec
+// supporting them, as CookieStore.MaxAge does, so sessions that outlive the codec
+// default of 30 days remain readable
+func (store *Store) configureCodecs() {
+	for _, codec := range store.codecs {
+		if c, ok := codec.(maxAgeCodec); ok && store.options.MaxAge > 0 {
+			c.MaxAge(store.options.MaxAge)
+		}
+		if c, ok := codec.(maxLengthCodec); ok && store.maxLength >= 0 {
+			c.MaxLength(store.maxLength)
+		}
+	}
+}
+
+// validCookieValue returns true if id is non-empty and contains only characters
+// permitted in a cookie value per RFC 6265
+func validCookieValue(id string) bool {
+	if id == "" {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c <= ' ' || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeCookie returns the cookie value for the session id.  When codecs are
+// configured, the id is signed and optionally encrypted.
+func (store *Store) encodeCookie(name, id string) (string, error) {
+	if len(store.codecs) == 0 {
+		return id, nil
+	}
+
+	value, err := securecookie.EncodeMulti(name, id, store.codecs...)
+	if err != nil {
+		store.printf("dynastore: unable to encode cookie - %v\n", err)
+		return "", ErrEncodeFailed
+	}
+	return value, nil
+}
+
+// decodeCookie returns the session id held by the cookie value.  False is returned
+// if the value cannot be verified, in which case it must not be used for lookups.
+func (store *Store) decodeCookie(name, value string) (string, bool) {
+	if len(store.codecs) == 0 {
+		return value, value != ""
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, value, &id, store.codecs...); err == nil {
+		return id, true
+	}
+
+	if store.unsignedCookies && validSessionID(value) {
+		return value, true
+	}
+
+	store.printf("dynastore: unable to verify cookie, %v\n", name)
+	return "", false
+}
+
+// validSessionID returns true if id has the form of an id generated by
+// DefaultIDGenerator
+func validSessionID(id string) bool {
+	if len(id) != sessionIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; !(c >= 'A' && c <= 'Z' || c >= '2' && c <= '7') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,624 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestSignedCookies(t *testing.T) {
+	codec := securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+
+	newStore := func(t *testing.T, opts ...Option) (*Store, *dynastoretest.DB, string, *http.Cookie) {
+		db := &dynastoretest.DB{}
+		store, err := New(append([]Option{DynamoDB(db), Codecs(codec)}, opts...)...)
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		session, _ := store.New(req, "blah")
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		return store, db, session.ID, w.Result().Cookies()[0]
+	}
+
+	load := func(store *Store, value string) (string, bool) {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(&http.Cookie{Name: "blah", Value: value})
+		session, _ := store.New(req, "blah")
+		return session.ID, session.IsNew
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		store, _, id, cookie := newStore(t)
+		if cookie.Value == id {
+			t.Fatal("expected cookie to hold a signed value")
+		}
+		if got, isNew := load(store, cookie.Value); isNew || got != id {
+			t.Errorf("expected %v; got %v", id, got)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		store, db, _, cookie := newStore(t)
+		values := []string{
+			cookie.Value[:len(cookie.Value)-1] + "x",
+			cookie.Value[:len(cookie.Value)/2],
+			"",
+		}
+		for _, value := range values {
+			n := len(db.Requests())
+			if _, isNew := load(store, value); !isNew {
+				t.Errorf("expected tampered cookie to yield a new session, %q", value)
+			}
+			if len(db.Requests()) != n {
+				t.Errorf("expected tampered cookie not to reach DynamoDB, %q", value)
+			}
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		store, db, id, _ := newStore(t)
+		n := len(db.Requests())
+		if _, isNew := load(store, id); !isNew {
+			t.Error("expected unsigned cookie to be rejected")
+		}
+		if len(db.Requests()) != n {
+			t.Error("expected unsigned cookie not to reach DynamoDB")
+		}
+	})
+
+	t.Run("unsigned migration", func(t *testing.T) {
+		store, _, id, _ := newStore(t, AllowUnsignedCookies())
+
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(&http.Cookie{Name: "blah", Value: id})
+		session, _ := store.New(req, "blah")
+		if session.IsNew || session.ID != id {
+			t.Fatalf("expected %v; got %v", id, session.ID)
+		}
+
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Value == id {
+			t.Fatalf("expected a signed cookie to be reissued; got %v", cookies)
+		}
+		if got, isNew := load(store, cookies[0].Value); isNew || got != id {
+			t.Errorf("expected %v; got %v", id, got)
+		}
+	})
+}
+
+func TestSameSite(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}), SameSite(http.SameSiteNoneMode), Secure())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	if v := session.Options.SameSite; v != http.SameSiteNoneMode {
+		t.Errorf("expected SameSiteNoneMode; got %v", v)
+	}
+
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := w.Header().Get("Set-Cookie"); !strings.Contains(v, "Secure; SameSite=None") {
+		t.Errorf("expected SameSite=None; Secure; got %v", v)
+	}
+}
+
+func TestIDGenerator(t *testing.T) {
+	ids := []string{"first", "second"}
+	store, err := New(DynamoDB(&dynastoretest.DB{}), IDGenerator(func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	for _, expected := range []string{"first", "second"} {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		session, err := store.New(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if session.ID != expected {
+			t.Errorf("expected %v; got %v", expected, session.ID)
+		}
+	}
+
+	if id := DefaultIDGenerator(); !validSessionID(id) {
+		t.Errorf("expected default id to be valid; got %v", id)
+	}
+}
+
+func TestInvalidIDGenerator(t *testing.T) {
+	for _, id := range []string{"", "a b", "a;b", `a"b`, "é"} {
+		store, err := New(DynamoDB(&dynastoretest.DB{}), IDGenerator(func() string { return id }))
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		session, err := store.New(req, "blah")
+		if err != ErrInvalidSessionID {
+			t.Errorf("%q: expected ErrInvalidSessionID; got %v", id, err)
+		}
+
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != ErrInvalidSessionID {
+			t.Errorf("%q: expected ErrInvalidSessionID; got %v", id, err)
+		}
+		if v := w.Header().Get("Set-Cookie"); v != "" {
+			t.Errorf("%q: expected no cookie; got %v", id, v)
+		}
+	}
+}
+
+func TestOptionsChanged(t *testing.T) {
+	newSession := func(t *testing.T, opts ...Option) (*Store, *dynastoretest.DB, *http.Cookie) {
+		db := &dynastoretest.DB{}
+		store, err := New(append([]Option{DynamoDB(db), MaxAge(3600)}, opts...)...)
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		session, _ := store.New(req, "blah")
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		return store, db, w.Result().Cookies()[0]
+	}
+
+	save := func(t *testing.T, store *Store, cookie *http.Cookie, fn func(session *sessions.Session)) []*http.Cookie {
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(cookie)
+		session, err := store.Get(req, "blah")
+		if err != nil || session.IsNew {
+			t.Fatalf("expected existing session; got %v", err)
+		}
+		fn(session)
+
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		return w.Result().Cookies()
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		store, _, cookie := newSession(t)
+		cookies := save(t, store, cookie, func(session *sessions.Session) {
+			session.Values["hello"] = "world"
+		})
+		if v := len(cookies); v != 0 {
+			t.Errorf("expected no cookies; got %v", v)
+		}
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		store, db, cookie := newSession(t)
+		ttl := func() int64 {
+			n, _ := strconv.ParseInt(db.Item(cookie.Value)["ttl"].(*types.AttributeValueMemberN).Value, 10, 64)
+			return n
+		}
+		before := ttl()
+
+		cookies := save(t, store, cookie, func(session *sessions.Session) {
+			session.Options.MaxAge *= 2
+		})
+		if v := len(cookies); v != 1 {
+			t.Fatalf("expected 1 cookie; got %v", v)
+		}
+		if v := cookies[0].MaxAge; v != 7200 {
+			t.Errorf("expected 7200; got %v", v)
+		}
+		if v := cookies[0].Expires; v.Before(time.Now().Add(time.Hour)) {
+			t.Errorf("expected Expires to reflect the extended MaxAge; got %v", v)
+		}
+		if after := ttl(); after < before+3600 {
+			t.Errorf("expected ttl to be extended beyond %v; got %v", before, after)
+		}
+
+		// the extended options are now what the client holds
+		cookies = save(t, store, cookie, func(session *sessions.Session) {})
+		if v := len(cookies); v != 0 {
+			t.Errorf("expected no cookies; got %v", v)
+		}
+	})
+
+	t.Run("always", func(t *testing.T) {
+		store, _, cookie := newSession(t, AlwaysSetCookie())
+		cookies := save(t, store, cookie, func(session *sessions.Session) {})
+		if v := len(cookies); v != 1 {
+			t.Errorf("expected 1 cookie; got %v", v)
+		}
+	})
+}
+
+func TestPersistedOptions(t *testing.T) {
+	const rememberMe = 2592000
+
+	testCases := map[string]struct {
+		opts   []Option
+		maxAge int
+	}{
+		"persisted": {maxAge: rememberMe},
+		"ignored":   {opts: []Option{IgnorePersistedOptions()}, maxAge: 900},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			store, err := New(append([]Option{DynamoDB(db), MaxAge(900)}, tc.opts...)...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			session, _ := store.New(req, "blah")
+			session.Options.MaxAge = rememberMe
+			w := httptest.NewRecorder()
+			if err := store.Save(req, w, session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			cookie := w.Result().Cookies()[0]
+
+			req = httptest.NewRequest("GET", "http://localhost", nil)
+			req.AddCookie(cookie)
+			session, err = store.New(req, "blah")
+			if err != nil || session.IsNew {
+				t.Fatalf("expected existing session; got %v", err)
+			}
+			if v := session.Options.MaxAge; v != tc.maxAge {
+				t.Errorf("expected MaxAge %v; got %v", tc.maxAge, v)
+			}
+
+			session.Values["n"] = 1
+			w = httptest.NewRecorder()
+			if err := store.Save(req, w, session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			ttl, _ := strconv.ParseInt(db.Item(session.ID)[DefaultTTLField].(*types.AttributeValueMemberN).Value, 10, 64)
+			if d := time.Until(time.Unix(ttl, 0)); d < time.Duration(tc.maxAge-5)*time.Second || d > time.Duration(tc.maxAge)*time.Second {
+				t.Errorf("expected ttl %v seconds out; got %v", tc.maxAge, d)
+			}
+
+			cookies := w.Result().Cookies()
+			if tc.maxAge == rememberMe {
+				if len(cookies) != 0 {
+					t.Errorf("expected cookie not to be reissued; got %v", cookies)
+				}
+				cookies = []*http.Cookie{cookie}
+			}
+			if len(cookies) != 1 {
+				t.Fatalf("expected cookie to be reissued; got %v", cookies)
+			}
+			if d := time.Until(cookies[0].Expires); d < time.Duration(tc.maxAge-5)*time.Second || d > time.Duration(tc.maxAge)*time.Second {
+				t.Errorf("expected cookie to expire in %v seconds; got %v", tc.maxAge, d)
+			}
+		})
+	}
+
+	t.Run("absent", func(t *testing.T) {
+		store, err := New(DynamoDB(&dynastoretest.DB{}), MaxAge(900))
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		session := sessions.NewSession(store, "blah")
+		session.ID = "abc"
+		session.Options = nil
+		if err := store.save(context.Background(), "blah", session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(&http.Cookie{Name: "blah", Value: "abc"})
+		session, err = store.New(req, "blah")
+		if err != nil || session.IsNew {
+			t.Fatalf("expected existing session; got %v", err)
+		}
+		if v := session.Options.MaxAge; v != 900 {
+			t.Errorf("expected store default MaxAge; got %v", v)
+		}
+	})
+}
+
+func TestExpires(t *testing.T) {
+	now := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), Clock(func() time.Time { return now }), MaxAge(3600))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	header := w.Header().Get("Set-Cookie")
+	for _, want := range []string{"Max-Age=3600", "Expires=Thu, 02 Jan 2020 04:04:05 GMT"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("expected %v in %v", want, header)
+		}
+	}
+	ttl := db.Item(session.ID)[DefaultTTLField].(*types.AttributeValueMemberN).Value
+	if want := strconv.FormatInt(now.Add(time.Hour).Unix(), 10); ttl != want {
+		t.Errorf("expected ttl %v; got %v", want, ttl)
+	}
+
+	session.Options.MaxAge = -1
+	w = httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	header = w.Header().Get("Set-Cookie")
+	for _, want := range []string{"Max-Age=0", "Expires=Thu, 01 Jan 1970 00:00:01 GMT"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("expected %v in %v", want, header)
+		}
+	}
+
+	if _, err := New(DynamoDB(db), Clock(nil)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+}
+
+func TestDuplicateCookies(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "valid"
+	session.Values["hello"] = "world"
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost/app", nil)
+	req.AddCookie(&http.Cookie{Name: "blah", Value: "stale"})
+	req.AddCookie(&http.Cookie{Name: "other", Value: "valid"})
+	req.AddCookie(&http.Cookie{Name: "blah", Value: "valid"})
+
+	got, err := store.New(req, "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if got.IsNew || got.ID != "valid" || got.Values["hello"] != "world" {
+		t.Errorf("expected the second cookie to be used; got %v %v", got.ID, got.Values)
+	}
+}
+
+func TestDuplicateCookiesBounded(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	for i := 0; i < maxCookieAttempts+2; i++ {
+		req.AddCookie(&http.Cookie{Name: "blah", Value: "missing" + strconv.Itoa(i)})
+	}
+
+	session, err := store.New(req, "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if !session.IsNew {
+		t.Error("expected a new session")
+	}
+	if got := len(db.Requests()); got != maxCookieAttempts {
+		t.Errorf("expected %v requests; got %v", maxCookieAttempts, got)
+	}
+}
+
+// signedCookie returns value signed by hashKey as securecookie would have at ts
+func signedCookie(t *testing.T, hashKey []byte, name, value string, ts time.Time) string {
+	b, err := securecookie.GobEncoder{}.Serialize(value)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	payload := fmt.Sprintf("%s|%d|%s", name, ts.Unix(), base64.URLEncoding.EncodeToString(b))
+	mac := hmac.New(sha256.New, hashKey)
+	mac.Write([]byte(payload))
+	signed := append([]byte(payload+"|"), mac.Sum(nil)...)
+	return base64.URLEncoding.EncodeToString(signed[len(name)+1:])
+}
+
+func TestCodecMaxAge(t *testing.T) {
+	const ninetyDays = 90 * 86400
+	hashKey := securecookie.GenerateRandomKey(32)
+	value := signedCookie(t, hashKey, "blah", "abc", time.Now().Add(-60*24*time.Hour))
+
+	testCases := map[string]struct {
+		opts []Option
+		ok   bool
+	}{
+		"codec default": {opts: nil, ok: false},
+		"max age":       {opts: []Option{MaxAge(ninetyDays)}, ok: true},
+		"session options": {
+			opts: []Option{SessionOptions(sessions.Options{Path: "/", MaxAge: ninetyDays})},
+			ok:   true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			// MaxAge may be given before the codecs it applies to
+			opts := append(tc.opts, Codecs(securecookie.New(hashKey, nil)), DynamoDB(&dynastoretest.DB{}))
+			store, err := New(opts...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if id, ok := store.decodeCookie("blah", value); ok != tc.ok || (ok && id != "abc") {
+				t.Errorf("expected %v; got %v %v", tc.ok, id, ok)
+			}
+		})
+	}
+
+	store, err := New(Codecs(securecookie.New(hashKey, nil)), DynamoDB(&dynastoretest.DB{}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.MaxAge(ninetyDays)
+	if got := store.Options().MaxAge; got != ninetyDays {
+		t.Errorf("expected %v; got %v", ninetyDays, got)
+	}
+	if _, ok := store.decodeCookie("blah", value); !ok {
+		t.Error("expected cookie to decode after MaxAge")
+	}
+}
+
+func TestCodecSerializerMaxAge(t *testing.T) {
+	codec := securecookie.New(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32))
+	store, err := New(DynamoDB(&dynastoretest.DB{}), Codecs(codec), MaxAge(90*86400))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 90 * 86400}
+	session.Values["remember"] = true
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	restored := sessions.NewSession(store, "blah")
+	if err := store.load(ctx, "blah", "abc", restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if restored.Values["remember"] != true {
+		t.Errorf("expected true; got %v", restored.Values["remember"])
+	}
+}
+
+func TestLogoutCookieScope(t *testing.T) {
+	login := func(t *testing.T, store *Store) *http.Cookie {
+		req := httptest.NewRequest("GET", "http://www.example.com", nil)
+		session, _ := store.New(req, "blah")
+		session.Values["user"] = "alice"
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		return w.Result().Cookies()[0]
+	}
+
+	logout := func(t *testing.T, store *Store, cookie *http.Cookie, expire func(*sessions.Session)) *http.Cookie {
+		req := httptest.NewRequest("GET", "http://www.example.com/account/logout", nil)
+		req.AddCookie(cookie)
+		session, err := store.New(req, "blah")
+		if err != nil || session.IsNew {
+			t.Fatalf("expected existing session; got %v", err)
+		}
+		expire(session)
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("expected 1 cookie; got %v", cookies)
+		}
+		return cookies[0]
+	}
+
+	testCases := map[string]func(*sessions.Session){
+		"max age": func(s *sessions.Session) { s.Options.MaxAge = -1 },
+		"replaced": func(s *sessions.Session) {
+			s.Options = &sessions.Options{MaxAge: -1}
+		},
+	}
+
+	for label, expire := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store, err := New(DynamoDB(&dynastoretest.DB{}), Path("/"), Domain("example.com"))
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			want := login(t, store)
+			got := logout(t, store, want, expire)
+			if got.Name != want.Name || got.Path != want.Path || got.Domain != want.Domain {
+				t.Errorf("expected %v %v %v; got %v %v %v", want.Name, want.Path, want.Domain, got.Name, got.Path, got.Domain)
+			}
+			if got.MaxAge >= 0 {
+				t.Errorf("expected negative MaxAge; got %v", got.MaxAge)
+			}
+		})
+	}
+
+	t.Run("persisted without scope", func(t *testing.T) {
+		db := &dynastoretest.DB{}
+		store, err := New(DynamoDB(db), Path("/"), Domain("example.com"))
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		// sessions.NewSession leaves Path and Domain blank
+		session := sessions.NewSession(store, "blah")
+		session.ID = "abc"
+		if err := store.save(context.Background(), "blah", session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		value, err := store.encodeCookie("blah", "abc")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		got := logout(t, store, &http.Cookie{Name: "blah", Value: value}, func(s *sessions.Session) { s.Options.MaxAge = -1 })
+		if got.Path != "/" || got.Domain != "example.com" {
+			t.Errorf("expected / example.com; got %v %v", got.Path, got.Domain)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// PersistWithResult saves session under the given name, as Save does without
+// setting a cookie, and returns true if no session was previously stored under its
+// id, e.g. to distinguish created from updated sessions in an audit log.  Items that
+// were expired, deleted or quarantined count as absent.
+func (store *Store) PersistWithResult(ctx context.Context, name string, session *sessions.Session) (created bool, err error) {
+	if store.sharedItem {
+		return false, errSharedItemUnsupported
+	}
+	return store.persist(ctx, name, session, true)
+}
+
+// tracked inspects old, the item replaced by writing item, and returns true if the
+// session was created.  Where session replaced a stored session without knowing
+// when it was created, e.g. it was not loaded first, the createdAt attribute of the
+// old item is restored.
+func (store *Store) tracked(ctx context.Context, session *sessions.Session, item, old map[string]types.AttributeValue) bool {
+	created := !store.existed(old)
+
+	createdAt := itemTime(item, createdField)
+	if !created {
+		if prev := itemTime(old, createdField); !prev.IsZero() && !prev.Equal(createdAt) {
+			createdAt = prev
+			store.restoreCreated(ctx, session.ID, old[createdField])
+		}
+	}
+	stateOf(session).createdAt = createdAt
+
+	if store.hooks.OnSaved != nil {
+		store.hooks.OnSaved(session, created)
+	}
+	return created
+}
+
+// existed returns true if old holds a session that could have been loaded
+func (store *Store) existed(old map[string]types.AttributeValue) bool {
+	if len(old) == 0 {
+		return false
+	}
+	if _, ok := old[quarantinedField]; ok {
+		return false
+	}
+	if _, ok := old[deletedField]; ok {
+		return false
+	}
+	ttl, err := store.itemTTL(old)
+	return err != nil || ttl == 0 || ttl >= store.now().Unix()
+}
+
+// restoreCreated sets the createdAt attribute of the item holding the session with
+// the given id.  Failures are logged rather than returned as the session was saved.
+func (store *Store) restoreCreated(ctx context.Context, id string, createdAt types.AttributeValue) {
+	err := store.withRetry(ctx, func() error {
+		input := &dynamodb.UpdateItemInput{
+			TableName:           aws.String(store.tableName),
+			Key:                 store.key(id),
+			UpdateExpression:    aws.String("SET #created = :created"),
+			ConditionExpression: aws.String("attribute_exists(#id)"),
+			ExpressionAttributeNames: map[string]string{
+				"#id":      store.primaryKey,
+				"#created": createdField,
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":created": createdAt,
+			},
+		}
+		store.intercept(ctx, OpSave, input)
+		_, err := store.ddb.UpdateItem(ctx, input)
+		return err
+	})
+	if err != nil {
+		store.printf("dynastore: unable to restore createdAt of session - %v\n", err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestPersistWithResult(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(db), Clock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+
+	for i, want := range []bool{true, false, false} {
+		created, err := store.PersistWithResult(ctx, "blah", session)
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if created != want {
+			t.Errorf("save %v: expected created %v; got %v", i, want, created)
+		}
+
+		item := db.Item("abc")
+		if got := itemTime(item, createdField); !got.Equal(time.Unix(1000, 0)) {
+			t.Errorf("save %v: expected createdAt to be stable; got %v", i, got)
+		}
+		if got := itemTime(item, updatedField); !got.Equal(now) {
+			t.Errorf("save %v: expected updatedAt %v; got %v", i, now, got)
+		}
+		now = now.Add(time.Minute)
+	}
+}
+
+func TestTrackCreation(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+
+	var saved []bool
+	hooks := Hooks{
+		OnSaved: func(session *sessions.Session, created bool) {
+			saved = append(saved, created)
+		},
+	}
+	store, err := New(DynamoDB(db), TrackCreation(), Instrumentation(hooks), Clock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	first := sessions.NewSession(store, "blah")
+	first.ID = "abc"
+	if err := store.save(ctx, "blah", first); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// a session saved under the same id without being loaded
+	now = now.Add(time.Minute)
+	second := sessions.NewSession(store, "blah")
+	second.ID = "abc"
+	if err := store.save(ctx, "blah", second); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if len(saved) != 2 || !saved[0] || saved[1] {
+		t.Errorf("expected created then updated; got %v", saved)
+	}
+	if got := itemTime(db.Item("abc"), createdField); !got.Equal(time.Unix(1000, 0)) {
+		t.Errorf("expected createdAt to be restored; got %v", got)
+	}
+}
+
+func TestTrackCreationQuarantined(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	if _, err := store.PersistWithResult(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	item := db.Item("abc")
+	item[quarantinedField] = &types.AttributeValueMemberBOOL{Value: true}
+	db.SetItem(item)
+
+	if created, err := store.PersistWithResult(ctx, "blah", session); err != nil || !created {
+		t.Errorf("expected quarantined item to count as absent; got %v, %v", created, err)
+	}
+}
+
+func TestTrackCreationSharedItem(t *testing.T) {
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), SharedItem(), TrackCreation()); !errors.Is(err, errSharedItemUnsupported) {
+		t.Errorf("expected errSharedItemUnsupported; got %v", err)
+	}
+}
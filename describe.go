@@ -0,0 +1,126 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// createdField holds the time, in unix seconds, the session was first saved
+	createdField = "createdAt"
+
+	// updatedField holds the time, in unix seconds, the session was last saved
+	updatedField = "updatedAt"
+)
+
+// SessionInfo describes a stored session; see Describe
+type SessionInfo struct {
+	// ID of the session
+	ID string
+
+	// CreatedAt holds when the session was first saved.  It is zero for sessions
+	// saved before timestamps were recorded.
+	CreatedAt time.Time
+
+	// UpdatedAt holds when the session was last saved
+	UpdatedAt time.Time
+
+	// ExpiresAt holds the ttl of the item, or zero if it has none
+	ExpiresAt time.Time
+
+	// Size holds the size of the item in bytes, as counted towards the DynamoDB limit
+	Size int
+
+	// Schema holds the layout version of the item
+	Schema int64
+
+	// Values holds a copy of the session values; changes to it are not saved
+	Values map[interface{}]interface{}
+}
+
+// Describe returns what the store holds for the session with the given id, e.g.
+// for an administrative endpoint.  Unlike Load, no session is returned that could
+// be saved.  ErrNotFound is returned for sessions that are missing or expired.
+func (store *Store) Describe(ctx context.Context, id string) (info *SessionInfo, err error) {
+	done := store.startOperation(OpLoad)
+	defer func() { done(err) }()
+
+	if store.sharedItem {
+		return nil, errSharedItemUnsupported
+	}
+
+	item, _, err := store.getItem(ctx, id)
+	if err != nil {
+		return nil, wrapError(OpLoad, id, err)
+	}
+	if len(item) == 0 {
+		return nil, ErrNotFound
+	}
+
+	session, err := store.decodeItem(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+
+	info = &SessionInfo{
+		ID:        id,
+		CreatedAt: itemTime(item, createdField),
+		UpdatedAt: itemTime(item, updatedField),
+		Size:      itemSize(item),
+		Values:    map[interface{}]interface{}{},
+	}
+	info.Schema, _ = schemaOf(item)
+	if ttl, err := store.itemTTL(item); err == nil && ttl > 0 {
+		info.ExpiresAt = time.Unix(ttl, 0)
+	}
+	for k, v := range session.Values {
+		info.Values[k] = copyValue(v)
+	}
+	return info, nil
+}
+
+// itemTime returns the time held in unix seconds by the named attribute of item,
+// or zero if it is absent or malformed
+func itemTime(item map[string]types.AttributeValue, name string) time.Time {
+	n, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return time.Time{}
+	}
+	v, err := strconv.ParseInt(n.Value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
+
+// stampTimes records the time session was first and last saved in av
+func (store *Store) stampTimes(session *sessions.Session, av map[string]types.AttributeValue) {
+	now := store.now()
+	created := now
+	if st, ok := lookupState(session); ok && !st.createdAt.IsZero() {
+		created = st.createdAt
+	}
+	av[createdField] = &types.AttributeValueMemberN{Value: strconv.FormatInt(created.Unix(), 10)}
+	av[updatedField] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)}
+	if store.idleTimeout > 0 {
+		av[lastAccessField] = lastAccess(now)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestTimestamps(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(db), Clock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	restored := sessions.NewSession(store, "blah")
+	if err := store.load(ctx, "blah", "abc", restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.save(ctx, "blah", restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	item := db.Item("abc")
+	if got := item[createdField].(*types.AttributeValueMemberN).Value; got != "1000" {
+		t.Errorf("expected createdAt 1000; got %v", got)
+	}
+	if got := item[updatedField].(*types.AttributeValueMemberN).Value; got != "1060" {
+		t.Errorf("expected updatedAt 1060; got %v", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(db), MaxAge(60), Clock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["list"] = []interface{}{"a"}
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	before := db.Item("abc")
+
+	info, err := store.Describe(ctx, "abc")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if info.ID != "abc" {
+		t.Errorf("expected abc; got %v", info.ID)
+	}
+	if !info.CreatedAt.Equal(now) || !info.UpdatedAt.Equal(now) {
+		t.Errorf("expected timestamps of %v; got %v, %v", now, info.CreatedAt, info.UpdatedAt)
+	}
+	if want := now.Add(time.Minute); !info.ExpiresAt.Equal(want) {
+		t.Errorf("expected %v; got %v", want, info.ExpiresAt)
+	}
+	if info.Size != itemSize(before) {
+		t.Errorf("expected %v bytes; got %v", itemSize(before), info.Size)
+	}
+	if info.Schema != currentSchema {
+		t.Errorf("expected schema %v; got %v", currentSchema, info.Schema)
+	}
+	if want := map[interface{}]interface{}{"list": []interface{}{"a"}}; !reflect.DeepEqual(info.Values, want) {
+		t.Errorf("expected %v; got %v", want, info.Values)
+	}
+
+	info.Values["list"].([]interface{})[0] = "b"
+	info.Values["other"] = true
+	if after := db.Item("abc"); !reflect.DeepEqual(before, after) {
+		t.Errorf("expected item to be unchanged; got %v", after)
+	}
+
+	if _, err := store.Describe(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RegistrableDomain returns the eTLD+1 of host e.g. app.example.com => example.com.
+// False is returned for single label hosts such as localhost and for IP addresses.
+// RegistrableDomain is suitable for use with the DomainResolver option.
+func RegistrableDomain(host string) (string, bool) {
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return "", false
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return "", false
+	}
+
+	return domain, true
+}
+
+// cookieDomain returns the cookie Domain for the request, using the DomainResolver
+// when configured.  fallback is returned when no resolver is configured or the
+// resolver declines the host.
+func (store *Store) cookieDomain(req *http.Request, fallback string) string {
+	if store.domainResolver == nil {
+		return fallback
+	}
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	if net.ParseIP(host) != nil {
+		// browsers reject a Domain attribute for IP hosts; use a host-only cookie
+		return ""
+	}
+
+	domain, ok := store.domainResolver(host)
+	if !ok {
+		return fallback
+	}
+
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	if domain == "" {
+		return fallback
+	}
+	if suffix, _ := publicsuffix.PublicSuffix(domain); suffix == domain {
+		store.printf("dynastore: refusing to set cookie domain to public suffix, %v\n", domain)
+		return fallback
+	}
+
+	return domain
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	testCases := map[string]struct {
+		host   string
+		domain string
+		ok     bool
+	}{
+		"subdomain": {host: "app.example.com", domain: "example.com", ok: true},
+		"apex":      {host: "example.com", domain: "example.com", ok: true},
+		"multi":     {host: "api.example.co.uk", domain: "example.co.uk", ok: true},
+		"localhost": {host: "localhost"},
+		"ipv4":      {host: "127.0.0.1"},
+		"ipv6":      {host: "::1"},
+		"suffix":    {host: "co.uk"},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			domain, ok := RegistrableDomain(tc.host)
+			if ok != tc.ok {
+				t.Errorf("expected %v; got %v", tc.ok, ok)
+			}
+			if domain != tc.domain {
+				t.Errorf("expected %v; got %v", tc.domain, domain)
+			}
+		})
+	}
+}
+
+func TestDomainResolver(t *testing.T) {
+	const fallback = "fallback.example.org"
+
+	testCases := map[string]struct {
+		host     string
+		resolver func(string) (string, bool)
+		want     string
+	}{
+		"port":      {host: "app.example.com:8443", resolver: RegistrableDomain, want: "example.com"},
+		"no port":   {host: "api.example.com", resolver: RegistrableDomain, want: "example.com"},
+		"localhost": {host: "localhost:3000", resolver: RegistrableDomain, want: fallback},
+		"ipv4":      {host: "127.0.0.1:3000", resolver: RegistrableDomain, want: ""},
+		"ipv6":      {host: "[::1]:3000", resolver: RegistrableDomain, want: ""},
+		"public suffix": {
+			host:     "app.example.com",
+			resolver: func(string) (string, bool) { return ".com", true },
+			want:     fallback,
+		},
+		"none": {host: "app.example.com", want: fallback},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store := &Store{
+				printf:         func(format string, args ...interface{}) {},
+				domainResolver: tc.resolver,
+				options:        sessions.Options{Domain: fallback},
+			}
+
+			req, _ := http.NewRequest("GET", "http://"+tc.host+"/", nil)
+			session, err := store.New(req, "blah")
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if got := session.Options.Domain; got != tc.want {
+				t.Errorf("expected %q; got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastoretest
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// BatchGetItem implements dynastore.BatchGetAPI.  Every key is processed; keys
+// without an item are omitted from the responses.
+func (db *DB) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.BatchGetItemOutput{
+		Responses: map[string][]map[string]types.AttributeValue{},
+	}
+	for table, req := range input.RequestItems {
+		for _, key := range req.Keys {
+			if item, ok := db.items[db.id(key)]; ok {
+				out.Responses[table] = append(out.Responses[table], copyItem(project(item, req.ProjectionExpression, req.ExpressionAttributeNames)))
+			}
+		}
+	}
+
+	return out, nil
+}
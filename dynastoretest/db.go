@@ -0,0 +1,551 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Package dynastoretest provides an in-memory DynamoDB fake for testing code that
+// uses dynastore without network access or AWS credentials.
+package dynastoretest
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DefaultPrimaryKey is the hash key used when DB.PrimaryKey is not set
+const DefaultPrimaryKey = "id"
+
+// DB is an in-memory implementation of dynastore.DynamoDBAPI.  The zero value is
+// ready to use.  DB supports the subset of expressions dynastore generates.
+//
+//	db := &dynastoretest.DB{}
+//	store, err := dynastore.New(dynastore.DynamoDB(db))
+type DB struct {
+	// PrimaryKey holds the name of the hash key; defaults to DefaultPrimaryKey
+	PrimaryKey string
+
+	// SortKey holds the name of the sort key, if the table has one
+	SortKey string
+
+	// Err, when set, is invoked before each request; a non-nil error is returned
+	// to the caller instead of performing the request
+	Err func(input interface{}) error
+
+	// Unprocessed, when set, is invoked for each write of a BatchWriteItem request;
+	// writes for which it returns true are left unprocessed
+	Unprocessed func(req types.WriteRequest) bool
+
+	mutex    sync.Mutex
+	items    map[string]map[string]types.AttributeValue
+	requests []interface{}
+	table    *types.TableDescription
+	ttl      *types.TimeToLiveSpecification
+}
+
+// Requests returns the inputs of all requests made so far, in order
+func (db *DB) Requests() []interface{} {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return append([]interface{}(nil), db.requests...)
+}
+
+// Item returns a copy of the item stored under id, or nil if none exists.  With
+// SortKey, the first item in sort key order whose hash key is id is returned.
+func (db *DB) Item(id string) map[string]types.AttributeValue {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.SortKey == "" {
+		return copyItem(db.items[id])
+	}
+
+	var ids []string
+	for k := range db.items {
+		if strings.HasPrefix(k, id+keySeparator) {
+			ids = append(ids, k)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	return copyItem(db.items[ids[0]])
+}
+
+// ItemByKey returns a copy of the item with the given key, or nil if none exists
+func (db *DB) ItemByKey(key map[string]types.AttributeValue) map[string]types.AttributeValue {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return copyItem(db.items[db.id(key)])
+}
+
+// SetItem stores item directly, bypassing any conditions
+func (db *DB) SetItem(item map[string]types.AttributeValue) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.put(item)
+}
+
+// Len returns the number of items stored
+func (db *DB) Len() int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return len(db.items)
+}
+
+// GetItem implements dynastore.DynamoDBAPI
+func (db *DB) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	item, ok := db.items[db.id(input.Key)]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+
+	item = project(item, input.ProjectionExpression, input.ExpressionAttributeNames)
+	return &dynamodb.GetItemOutput{Item: copyItem(item)}, nil
+}
+
+// PutItem implements dynastore.DynamoDBAPI.  Only ALL_OLD of the ReturnValues
+// options is supported.
+func (db *DB) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	existing := db.items[db.id(input.Item)]
+	if err := db.check(existing, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+
+	db.put(input.Item)
+
+	out := &dynamodb.PutItemOutput{}
+	if input.ReturnValues == types.ReturnValueAllOld {
+		out.Attributes = copyItem(existing)
+	}
+	return out, nil
+}
+
+// DeleteItem implements dynastore.DynamoDBAPI
+func (db *DB) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	id := db.id(input.Key)
+	if err := db.check(db.items[id], input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+
+	delete(db.items, id)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// UpdateItem implements dynastore.DynamoDBAPI.  Only SET and REMOVE
+// actions with plain attribute names and values are supported, and only
+// ALL_NEW of the ReturnValues options.
+func (db *DB) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	id := db.id(input.Key)
+	existing := db.items[id]
+	if err := db.check(existing, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+
+	item := copyItem(existing)
+	if item == nil {
+		item = copyItem(input.Key)
+	}
+
+	for _, clause := range splitClauses(aws.ToString(input.UpdateExpression)) {
+		switch clause.action {
+		case "SET":
+			for _, assignment := range clause.args {
+				parts := strings.SplitN(assignment, "=", 2)
+				if len(parts) != 2 {
+					return nil, fmt.Errorf("dynastoretest: unsupported SET, %v", assignment)
+				}
+				name := resolve(strings.TrimSpace(parts[0]), input.ExpressionAttributeNames)
+				av, ok := input.ExpressionAttributeValues[strings.TrimSpace(parts[1])]
+				if !ok {
+					return nil, fmt.Errorf("dynastoretest: unsupported SET value, %v", parts[1])
+				}
+				item[name] = av
+			}
+		case "REMOVE":
+			for _, name := range clause.args {
+				delete(item, resolve(name, input.ExpressionAttributeNames))
+			}
+		default:
+			return nil, fmt.Errorf("dynastoretest: unsupported update action, %v", clause.action)
+		}
+	}
+
+	db.put(item)
+
+	out := &dynamodb.UpdateItemOutput{}
+	if input.ReturnValues == types.ReturnValueAllNew {
+		out.Attributes = copyItem(item)
+	}
+	return out, nil
+}
+
+// Scan implements dynastore.DynamoDBAPI.  Items are scanned in order of
+// their id; Limit, ExclusiveStartKey, Segment and TotalSegments are honoured.
+func (db *DB) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id := range db.items {
+		if total := aws.ToInt32(input.TotalSegments); total > 1 {
+			h := fnv.New32a()
+			h.Write([]byte(id))
+			if int32(h.Sum32()%uint32(total)) != aws.ToInt32(input.Segment) {
+				continue
+			}
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	if input.ExclusiveStartKey != nil {
+		start := db.id(input.ExclusiveStartKey)
+		ids = ids[sort.Search(len(ids), func(i int) bool { return ids[i] > start }):]
+	}
+
+	out := &dynamodb.ScanOutput{}
+	if limit := int(aws.ToInt32(input.Limit)); limit > 0 && limit < len(ids) {
+		ids = ids[:limit]
+		out.LastEvaluatedKey = db.key(ids[limit-1])
+	}
+
+	for _, id := range ids {
+		item := db.items[id]
+		out.ScannedCount++
+		if input.FilterExpression != nil && !matches(item, *input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues) {
+			continue
+		}
+		out.Items = append(out.Items, copyItem(project(item, input.ProjectionExpression, input.ExpressionAttributeNames)))
+	}
+	out.Count = int32(len(out.Items))
+
+	return out, nil
+}
+
+// BatchWriteItem implements dynastore.DynamoDBAPI.  Writes for which
+// Unprocessed returns true are returned as unprocessed items.
+func (db *DB) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.BatchWriteItemOutput{}
+	for table, requests := range input.RequestItems {
+		for _, req := range requests {
+			if db.Unprocessed != nil && db.Unprocessed(req) {
+				if out.UnprocessedItems == nil {
+					out.UnprocessedItems = map[string][]types.WriteRequest{}
+				}
+				out.UnprocessedItems[table] = append(out.UnprocessedItems[table], req)
+				continue
+			}
+
+			switch {
+			case req.PutRequest != nil:
+				db.put(req.PutRequest.Item)
+			case req.DeleteRequest != nil:
+				delete(db.items, db.id(req.DeleteRequest.Key))
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// begin records the request and returns any error injected via Err or ctx
+func (db *DB) begin(ctx context.Context, input interface{}) error {
+	db.requests = append(db.requests, input)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if db.Err != nil {
+		return db.Err(input)
+	}
+	return nil
+}
+
+func (db *DB) put(item map[string]types.AttributeValue) {
+	if db.items == nil {
+		db.items = map[string]map[string]types.AttributeValue{}
+	}
+	db.items[db.id(item)] = copyItem(item)
+}
+
+// keySeparator separates the hash and sort key values of an item id
+const keySeparator = "\x00"
+
+// id returns the id items are stored under: the hash key value or, with SortKey,
+// the hash and sort key values
+func (db *DB) id(item map[string]types.AttributeValue) string {
+	var id string
+	if av, ok := item[db.keyName()].(*types.AttributeValueMemberS); ok {
+		id = av.Value
+	}
+	if db.SortKey == "" {
+		return id
+	}
+	if av, ok := item[db.SortKey].(*types.AttributeValueMemberS); ok {
+		return id + keySeparator + av.Value
+	}
+	return id + keySeparator
+}
+
+// key returns the key attributes of the item stored under id
+func (db *DB) key(id string) map[string]types.AttributeValue {
+	if db.SortKey == "" {
+		return map[string]types.AttributeValue{
+			db.keyName(): &types.AttributeValueMemberS{Value: id},
+		}
+	}
+
+	hash, sortValue, _ := strings.Cut(id, keySeparator)
+	return map[string]types.AttributeValue{
+		db.keyName(): &types.AttributeValueMemberS{Value: hash},
+		db.SortKey:   &types.AttributeValueMemberS{Value: sortValue},
+	}
+}
+
+func (db *DB) keyName() string {
+	if db.PrimaryKey == "" {
+		return DefaultPrimaryKey
+	}
+	return db.PrimaryKey
+}
+
+// check evaluates a condition expression composed of attribute_exists,
+// attribute_not_exists, begins_with, equality and numeric less than comparisons
+// joined by AND or OR
+func (db *DB) check(item map[string]types.AttributeValue, condition *string, names map[string]string, values map[string]types.AttributeValue) error {
+	if condition == nil {
+		return nil
+	}
+
+	if !matches(item, *condition, names, values) {
+		return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return nil
+}
+
+// matches returns true if item satisfies expr
+func matches(item map[string]types.AttributeValue, expr string, names map[string]string, values map[string]types.AttributeValue) bool {
+	for _, or := range strings.Split(expr, " OR ") {
+		matched := true
+		for _, term := range strings.Split(or, " AND ") {
+			if !evaluate(item, trimParens(strings.TrimSpace(term)), names, values) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func evaluate(item map[string]types.AttributeValue, term string, names map[string]string, values map[string]types.AttributeValue) bool {
+	switch {
+	case strings.HasPrefix(term, "attribute_exists("):
+		name := resolve(strings.TrimSuffix(strings.TrimPrefix(term, "attribute_exists("), ")"), names)
+		_, ok := item[name]
+		return ok
+	case strings.HasPrefix(term, "attribute_not_exists("):
+		name := resolve(strings.TrimSuffix(strings.TrimPrefix(term, "attribute_not_exists("), ")"), names)
+		_, ok := item[name]
+		return !ok
+	case strings.HasPrefix(term, "begins_with("):
+		parts := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(term, "begins_with("), ")"), ",", 2)
+		if len(parts) != 2 {
+			return false
+		}
+		av, ok := item[resolve(strings.TrimSpace(parts[0]), names)].(*types.AttributeValueMemberS)
+		if !ok {
+			return false
+		}
+		prefix, ok := values[strings.TrimSpace(parts[1])].(*types.AttributeValueMemberS)
+		return ok && strings.HasPrefix(av.Value, prefix.Value)
+	case strings.Contains(term, "<") && !strings.Contains(term, "<="):
+		parts := strings.SplitN(term, "<", 2)
+		av, ok := item[resolve(strings.Trim(parts[0], " ()"), names)].(*types.AttributeValueMemberN)
+		if !ok {
+			return false
+		}
+		want, ok := values[strings.Trim(parts[1], " ()")].(*types.AttributeValueMemberN)
+		if !ok {
+			return false
+		}
+		a, errA := strconv.ParseFloat(av.Value, 64)
+		b, errB := strconv.ParseFloat(want.Value, 64)
+		return errA == nil && errB == nil && a < b
+	case strings.Contains(term, "="):
+		parts := strings.SplitN(term, "=", 2)
+		av, ok := item[resolve(strings.Trim(parts[0], " ()"), names)]
+		if !ok {
+			return false
+		}
+		want, ok := values[strings.Trim(parts[1], " ()")]
+		return ok && reflect.DeepEqual(av, want)
+	}
+	return false
+}
+
+var actionRE = regexp.MustCompile(`\b(SET|REMOVE|ADD|DELETE)\s`)
+
+type clause struct {
+	action string
+	args   []string
+}
+
+// splitClauses splits an update expression such as "SET #a = :a, #b = :b REMOVE #c"
+func splitClauses(expr string) []clause {
+	var clauses []clause
+
+	matches := actionRE.FindAllStringSubmatchIndex(expr, -1)
+	for i, m := range matches {
+		end := len(expr)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+
+		c := clause{action: expr[m[2]:m[3]]}
+		for _, arg := range strings.Split(expr[m[1]:end], ",") {
+			if arg = strings.TrimSpace(arg); arg != "" {
+				c.args = append(c.args, arg)
+			}
+		}
+		clauses = append(clauses, c)
+	}
+
+	return clauses
+}
+
+// trimParens removes a leading ( and its matching trailing )
+func trimParens(term string) string {
+	if strings.HasPrefix(term, "(") && strings.HasSuffix(term, ")") {
+		return term[1 : len(term)-1]
+	}
+	return term
+}
+
+func resolve(name string, names map[string]string) string {
+	if v, ok := names[name]; ok {
+		return v
+	}
+	return name
+}
+
+// project returns the attributes of item named by the projection expression.
+// Paths into maps, such as #a.#b, are supported.
+func project(item map[string]types.AttributeValue, expr *string, names map[string]string) map[string]types.AttributeValue {
+	if expr == nil {
+		return item
+	}
+
+	projected := map[string]types.AttributeValue{}
+	for _, path := range strings.Split(*expr, ",") {
+		var segments []string
+		for _, segment := range strings.Split(strings.TrimSpace(path), ".") {
+			segments = append(segments, resolve(segment, names))
+		}
+
+		// only paths present in item are projected
+		av := types.AttributeValue(&types.AttributeValueMemberM{Value: item})
+		for _, name := range segments {
+			m, ok := av.(*types.AttributeValueMemberM)
+			if !ok {
+				av = nil
+				break
+			}
+			if av, ok = m.Value[name]; !ok {
+				break
+			}
+		}
+		if av == nil {
+			continue
+		}
+
+		dst := projected
+		for _, name := range segments[:len(segments)-1] {
+			next, ok := dst[name].(*types.AttributeValueMemberM)
+			if !ok {
+				next = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+				dst[name] = next
+			}
+			dst = next.Value
+		}
+		dst[segments[len(segments)-1]] = av
+	}
+	return projected
+}
+
+func copyItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	dup := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		dup[k] = v
+	}
+	return dup
+}
@@ -0,0 +1,171 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastoretest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/savaki/dynastore"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestHandlerFlow(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := dynastore.New(dynastore.DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		session, err := store.Get(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		n, _ := session.Values["n"].(int)
+		session.Values["n"] = n + 1
+		if err := session.Save(req, w); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	handler.ServeHTTP(w, req)
+
+	cookies := w.Result().Cookies()
+	if v := len(cookies); v != 1 {
+		t.Fatalf("expected 1 cookie; got %v", v)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookies[0])
+	session, err := store.Get(req, "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := session.Values["n"]; v != 2 {
+		t.Errorf("expected 2; got %v", v)
+	}
+	if v := db.Len(); v != 1 {
+		t.Errorf("expected 1 item; got %v", v)
+	}
+}
+
+func TestUpdateItem(t *testing.T) {
+	db := &dynastoretest.DB{}
+	ctx := context.Background()
+
+	db.SetItem(map[string]types.AttributeValue{
+		"id":  &types.AttributeValueMemberS{Value: "abc"},
+		"a":   &types.AttributeValueMemberS{Value: "1"},
+		"ttl": &types.AttributeValueMemberN{Value: "1"},
+	})
+
+	_, err := db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "abc"}},
+		ConditionExpression: aws.String("attribute_exists(#id)"),
+		UpdateExpression:    aws.String("SET #ttl = :ttl, #b = :b REMOVE #a"),
+		ExpressionAttributeNames: map[string]string{
+			"#id":  "id",
+			"#ttl": "ttl",
+			"#a":   "a",
+			"#b":   "b",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ttl": &types.AttributeValueMemberN{Value: "2"},
+			":b":   &types.AttributeValueMemberS{Value: "2"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	item := db.Item("abc")
+	if _, ok := item["a"]; ok {
+		t.Error("expected a to be removed")
+	}
+	if v, ok := item["ttl"].(*types.AttributeValueMemberN); !ok || v.Value != "2" {
+		t.Errorf("expected 2; got %#v", item["ttl"])
+	}
+	if v, ok := item["b"].(*types.AttributeValueMemberS); !ok || v.Value != "2" {
+		t.Errorf("expected 2; got %#v", item["b"])
+	}
+
+	_, err = db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                      map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "missing"}},
+		ConditionExpression:      aws.String("attribute_exists(#id)"),
+		UpdateExpression:         aws.String("SET #ttl = :ttl"),
+		ExpressionAttributeNames: map[string]string{"#id": "id", "#ttl": "ttl"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ttl": &types.AttributeValueMemberN{Value: "2"},
+		},
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		t.Errorf("expected ConditionalCheckFailedException; got %v", err)
+	}
+	if v := db.Len(); v != 1 {
+		t.Errorf("expected 1 item; got %v", v)
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	db := &dynastoretest.DB{PrimaryKey: "PK", SortKey: "SK"}
+	ctx := context.Background()
+
+	for _, sk := range []string{"b", "a"} {
+		_, err := db.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String("blah"),
+			Item: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: "abc"},
+				"SK": &types.AttributeValueMemberS{Value: sk},
+			},
+		})
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+	if v := db.Len(); v != 2 {
+		t.Fatalf("expected 2 items; got %v", v)
+	}
+	if v := db.Item("abc")["SK"].(*types.AttributeValueMemberS).Value; v != "a" {
+		t.Errorf("expected first item in sort key order; got %v", v)
+	}
+
+	key := map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: "abc"},
+		"SK": &types.AttributeValueMemberS{Value: "a"},
+	}
+	if _, err := db.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String("blah"), Key: key}); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if db.ItemByKey(key) != nil {
+		t.Error("expected item to be deleted")
+	}
+	if v := db.Len(); v != 1 {
+		t.Errorf("expected 1 item; got %v", v)
+	}
+}
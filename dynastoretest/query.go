@@ -0,0 +1,66 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastoretest
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Query implements dynastore.QueryAPI.  Every index is treated as projecting all
+// attributes; items matching KeyConditionExpression are returned in order of
+// their id.  Limit, ExclusiveStartKey and FilterExpression are honoured.
+func (db *DB) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id, item := range db.items {
+		if matches(item, aws.ToString(input.KeyConditionExpression), input.ExpressionAttributeNames, input.ExpressionAttributeValues) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	if input.ExclusiveStartKey != nil {
+		start := db.id(input.ExclusiveStartKey)
+		ids = ids[sort.Search(len(ids), func(i int) bool { return ids[i] > start }):]
+	}
+
+	out := &dynamodb.QueryOutput{}
+	if limit := int(aws.ToInt32(input.Limit)); limit > 0 && limit < len(ids) {
+		ids = ids[:limit]
+		out.LastEvaluatedKey = db.key(ids[limit-1])
+	}
+
+	for _, id := range ids {
+		item := db.items[id]
+		out.ScannedCount++
+		if input.FilterExpression != nil && !matches(item, *input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues) {
+			continue
+		}
+		out.Items = append(out.Items, copyItem(project(item, input.ProjectionExpression, input.ExpressionAttributeNames)))
+	}
+	out.Count = int32(len(out.Items))
+
+	return out, nil
+}
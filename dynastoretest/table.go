@@ -0,0 +1,108 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastoretest
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The table management requests model a single table that does not exist until
+// CreateTable is called.  Item requests do not require the table to exist.
+
+// DescribeTable implements dynastore.TableAPI
+func (db *DB) DescribeTable(ctx context.Context, input *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	if db.table == nil || aws.ToString(db.table.TableName) != aws.ToString(input.TableName) {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("table not found")}
+	}
+
+	table := *db.table
+	return &dynamodb.DescribeTableOutput{Table: &table}, nil
+}
+
+// CreateTable implements dynastore.TableAPI.  Tables are ACTIVE immediately.
+func (db *DB) CreateTable(ctx context.Context, input *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	if db.table != nil {
+		return nil, &types.ResourceInUseException{Message: aws.String("table already exists")}
+	}
+
+	db.table = &types.TableDescription{
+		TableName:            input.TableName,
+		TableStatus:          types.TableStatusActive,
+		KeySchema:            input.KeySchema,
+		AttributeDefinitions: input.AttributeDefinitions,
+		BillingModeSummary: &types.BillingModeSummary{
+			BillingMode: input.BillingMode,
+		},
+	}
+	for _, key := range input.KeySchema {
+		switch key.KeyType {
+		case types.KeyTypeHash:
+			db.PrimaryKey = aws.ToString(key.AttributeName)
+		case types.KeyTypeRange:
+			db.SortKey = aws.ToString(key.AttributeName)
+		}
+	}
+
+	table := *db.table
+	return &dynamodb.CreateTableOutput{TableDescription: &table}, nil
+}
+
+// UpdateTimeToLive implements dynastore.TableAPI
+func (db *DB) UpdateTimeToLive(ctx context.Context, input *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	if db.table == nil {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("table not found")}
+	}
+
+	spec := *input.TimeToLiveSpecification
+	db.ttl = &spec
+	return &dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: &spec}, nil
+}
+
+// TimeToLive returns the ttl specification set by UpdateTimeToLive, or nil if none
+func (db *DB) TimeToLive() *types.TimeToLiveSpecification {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.ttl == nil {
+		return nil
+	}
+	spec := *db.ttl
+	return &spec
+}
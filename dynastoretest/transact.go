@@ -0,0 +1,78 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastoretest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TransactWriteItems implements dynastore.TransactAPI.  Put, Delete and
+// ConditionCheck items are supported.  When any condition fails, nothing is
+// written and a TransactionCanceledException listing the reasons is returned.
+func (db *DB) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.begin(ctx, input); err != nil {
+		return nil, err
+	}
+
+	var (
+		reasons   = make([]types.CancellationReason, len(input.TransactItems))
+		cancelled bool
+	)
+	for i, item := range input.TransactItems {
+		var err error
+		switch {
+		case item.Put != nil:
+			err = db.check(db.items[db.id(item.Put.Item)], item.Put.ConditionExpression, item.Put.ExpressionAttributeNames, item.Put.ExpressionAttributeValues)
+		case item.Delete != nil:
+			err = db.check(db.items[db.id(item.Delete.Key)], item.Delete.ConditionExpression, item.Delete.ExpressionAttributeNames, item.Delete.ExpressionAttributeValues)
+		case item.ConditionCheck != nil:
+			err = db.check(db.items[db.id(item.ConditionCheck.Key)], item.ConditionCheck.ConditionExpression, item.ConditionCheck.ExpressionAttributeNames, item.ConditionCheck.ExpressionAttributeValues)
+		default:
+			return nil, fmt.Errorf("dynastoretest: unsupported transaction item, %v", i)
+		}
+
+		reasons[i].Code = aws.String("None")
+		if err != nil {
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			cancelled = true
+		}
+	}
+
+	if cancelled {
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled"),
+			CancellationReasons: reasons,
+		}
+	}
+
+	for _, item := range input.TransactItems {
+		switch {
+		case item.Put != nil:
+			db.put(item.Put.Item)
+		case item.Delete != nil:
+			delete(db.items, db.id(item.Delete.Key))
+		}
+	}
+
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
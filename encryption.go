@@ -0,0 +1,174 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// keyIDField holds the id of the key that encrypted the values attribute
+const keyIDField = "key_id"
+
+// tags identifying the type of the values attribute within the plaintext
+const (
+	plaintextString byte = 'S'
+	plaintextBinary byte = 'B'
+)
+
+var (
+	// ErrDecryptFailed is returned when session values cannot be decrypted e.g.
+	// because the key that encrypted them is unknown
+	ErrDecryptFailed = errors.New("unable to decrypt session")
+
+	errEncryptionUnsupported = errors.New("encryption cannot be combined with JSON or ValueAttributes")
+)
+
+// EncryptionProvider encrypts session values at rest.  Encrypt returns the id of
+// the key it used, which is stored alongside the ciphertext and passed to Decrypt
+// so keys may be rotated.
+type EncryptionProvider interface {
+	Encrypt(ctx context.Context, plaintext []byte) (ciphertext []byte, keyID string, err error)
+	Decrypt(ctx context.Context, ciphertext []byte, keyID string) (plaintext []byte, err error)
+}
+
+// encrypt replaces the values attribute of av with its ciphertext
+func (store *Store) encrypt(ctx context.Context, av map[string]types.AttributeValue) error {
+	var plaintext []byte
+	switch v := av[valuesField].(type) {
+	case *types.AttributeValueMemberS:
+		plaintext = append([]byte{plaintextString}, v.Value...)
+	case *types.AttributeValueMemberB:
+		plaintext = append([]byte{plaintextBinary}, v.Value...)
+	default:
+		return errEncryptionUnsupported
+	}
+
+	ciphertext, keyID, err := store.encryption.Encrypt(ctx, plaintext)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrEncodeFailed, err)
+	}
+
+	av[valuesField] = &types.AttributeValueMemberB{Value: ciphertext}
+	av[keyIDField] = &types.AttributeValueMemberS{Value: keyID}
+	return nil
+}
+
+// decrypt returns a copy of item with its values attribute decrypted.  Items
+// written before encryption was enabled are returned unchanged.
+func (store *Store) decrypt(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	keyID, ok := item[keyIDField].(*types.AttributeValueMemberS)
+	if !ok {
+		return item, nil
+	}
+	if store.encryption == nil {
+		return nil, ErrDecryptFailed
+	}
+
+	ciphertext, ok := item[valuesField].(*types.AttributeValueMemberB)
+	if !ok {
+		return nil, ErrMalformedSession
+	}
+
+	plaintext, err := store.encryption.Decrypt(ctx, ciphertext.Value, keyID.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+	if len(plaintext) == 0 {
+		return nil, ErrMalformedSession
+	}
+
+	decrypted := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		decrypted[k] = v
+	}
+	switch plaintext[0] {
+	case plaintextString:
+		decrypted[valuesField] = &types.AttributeValueMemberS{Value: string(plaintext[1:])}
+	case plaintextBinary:
+		decrypted[valuesField] = &types.AttributeValueMemberB{Value: plaintext[1:]}
+	default:
+		return nil, ErrMalformedSession
+	}
+
+	return decrypted, nil
+}
+
+// AESGCM is an EncryptionProvider using AES-GCM with locally held keys.  Values
+// are encrypted with the current key and may be decrypted with any known key, so
+// keys are rotated by introducing a new current key while retaining the old ones.
+type AESGCM struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewAESGCM returns an AESGCM that encrypts with the key named current.  keys maps
+// key ids to AES keys of 16, 24 or 32 bytes.
+func NewAESGCM(current string, keys map[string][]byte) (*AESGCM, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("no key with id, %v", current)
+	}
+
+	aeads := map[string]cipher.AEAD{}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key, %v: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		aeads[id] = aead
+	}
+
+	return &AESGCM{
+		current: current,
+		aeads:   aeads,
+	}, nil
+}
+
+// Encrypt implements EncryptionProvider
+func (a *AESGCM) Encrypt(ctx context.Context, plaintext []byte) ([]byte, string, error) {
+	aead := a.aeads[a.current]
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, "", err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, []byte(a.current)), a.current, nil
+}
+
+// Decrypt implements EncryptionProvider
+func (a *AESGCM) Decrypt(ctx context.Context, ciphertext []byte, keyID string) ([]byte, error) {
+	aead, ok := a.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key, %v", keyID)
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(keyID))
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func newAESGCM(t *testing.T, current string, keys map[string][]byte) *AESGCM {
+	provider, err := NewAESGCM(current, keys)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	return provider
+}
+
+func TestEncryption(t *testing.T) {
+	key := securecookie.GenerateRandomKey(32)
+
+	testCases := map[string][]Option{
+		"gob":        {},
+		"compressed": {Compression(0)},
+	}
+
+	for label, opts := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			provider := newAESGCM(t, "k1", map[string][]byte{"k1": key})
+			store, err := New(append(opts, DynamoDB(db), Encryption(provider))...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			ctx := context.Background()
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			session.Values["secret"] = "plaintext-marker"
+			if err := store.save(ctx, "blah", session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			item := db.Item("abc")
+			values, ok := item[valuesField].(*types.AttributeValueMemberB)
+			if !ok {
+				t.Fatalf("expected values to be binary; got %T", item[valuesField])
+			}
+			if bytes.Contains(values.Value, []byte("plaintext-marker")) {
+				t.Error("expected values to be encrypted")
+			}
+			if v, ok := item[keyIDField].(*types.AttributeValueMemberS); !ok || v.Value != "k1" {
+				t.Errorf("expected k1; got %#v", item[keyIDField])
+			}
+
+			restored := sessions.NewSession(store, "blah")
+			if err := store.load(ctx, "blah", "abc", restored); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if v := restored.Values["secret"]; v != "plaintext-marker" {
+				t.Errorf("expected plaintext-marker; got %v", v)
+			}
+		})
+	}
+}
+
+func TestEncryptionWrongKey(t *testing.T) {
+	db := &dynastoretest.DB{}
+	ctx := context.Background()
+
+	store, err := New(DynamoDB(db), Encryption(newAESGCM(t, "k1", map[string][]byte{"k1": securecookie.GenerateRandomKey(32)})))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	other, err := New(DynamoDB(db), Encryption(newAESGCM(t, "k1", map[string][]byte{"k1": securecookie.GenerateRandomKey(32)})))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	err = other.load(ctx, "blah", "abc", sessions.NewSession(other, "blah"))
+	if !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("expected ErrDecryptFailed; got %v", err)
+	}
+	if _, ok := db.Item("abc")[quarantinedField]; ok {
+		t.Error("expected decryption failures not to quarantine the session")
+	}
+
+	plain, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := plain.load(ctx, "blah", "abc", sessions.NewSession(plain, "blah")); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("expected ErrDecryptFailed; got %v", err)
+	}
+}
+
+func TestEncryptionRotation(t *testing.T) {
+	var (
+		db   = &dynastoretest.DB{}
+		ctx  = context.Background()
+		key1 = securecookie.GenerateRandomKey(32)
+		key2 = securecookie.GenerateRandomKey(32)
+	)
+
+	old, err := New(DynamoDB(db), Encryption(newAESGCM(t, "k1", map[string][]byte{"k1": key1})))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	session := sessions.NewSession(old, "blah")
+	session.ID = "abc"
+	session.Values["hello"] = "world"
+	if err := old.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	rotated, err := New(DynamoDB(db), Encryption(newAESGCM(t, "k2", map[string][]byte{"k1": key1, "k2": key2})))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	restored := sessions.NewSession(rotated, "blah")
+	if err := rotated.load(ctx, "blah", "abc", restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := restored.Values["hello"]; v != "world" {
+		t.Errorf("expected world; got %v", v)
+	}
+
+	if err := rotated.save(ctx, "blah", restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v, ok := db.Item("abc")[keyIDField].(*types.AttributeValueMemberS); !ok || v.Value != "k2" {
+		t.Errorf("expected k2; got %#v", db.Item("abc")[keyIDField])
+	}
+}
+
+func TestEncryptionUnsupported(t *testing.T) {
+	provider := newAESGCM(t, "k1", map[string][]byte{"k1": securecookie.GenerateRandomKey(32)})
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), Encryption(provider), JSON()); err != errEncryptionUnsupported {
+		t.Errorf("expected errEncryptionUnsupported; got %v", err)
+	}
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), Encryption(provider), ValueAttributes()); err != errEncryptionUnsupported {
+		t.Errorf("expected errEncryptionUnsupported; got %v", err)
+	}
+	if _, err := NewAESGCM("k1", map[string][]byte{"k1": []byte("short")}); err == nil {
+		t.Error("expected invalid key to be rejected")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// ErrTableNotFound wraps errors caused by the session table not existing
+	ErrTableNotFound = errors.New("session table not found")
+
+	// ErrThrottled wraps errors caused by DynamoDB throttling the request
+	ErrThrottled = errors.New("request throttled")
+)
+
+// isThrottled returns true if err indicates DynamoDB rejected the request due to
+// throughput limits
+func isThrottled(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "ProvisionedThroughputExceededException", "RequestLimitExceeded", "ThrottlingException":
+		return true
+	default:
+		return false
+	}
+}
+
+// itemError returns true if err was caused by the stored item, e.g. it is missing
+// or cannot be decoded, rather than by a failure to read it
+func itemError(err error) bool {
+	return errors.Is(err, ErrNotFound) ||
+		errors.Is(err, ErrMalformedSession) ||
+		errors.Is(err, ErrDecodeFailed) ||
+		errors.Is(err, ErrDecryptFailed) ||
+		errors.Is(err, ErrSessionRevoked)
+}
+
+// shortID abbreviates a session id for errors and logs
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8] + "..."
+	}
+	return id
+}
+
+// wrapError annotates an error returned by DynamoDB with the operation and an
+// abbreviated session id.  ErrTableNotFound or ErrThrottled is additionally wrapped
+// when applicable.  The full id is omitted as it grants access to the session.
+func wrapError(op, id string, err error) error {
+	id = shortID(id)
+
+	var notFound *types.ResourceNotFoundException
+	switch {
+	case errors.As(err, &notFound):
+		return fmt.Errorf("dynastore: %v session %v: %w: %w", op, id, ErrTableNotFound, err)
+	case isThrottled(err):
+		return fmt.Errorf("dynastore: %v session %v: %w: %w", op, id, ErrThrottled, err)
+	default:
+		return fmt.Errorf("dynastore: %v session %v: %w", op, id, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+func TestWrappedErrors(t *testing.T) {
+	testCases := map[string]struct {
+		Err      error
+		Sentinel error
+	}{
+		"throttled": {
+			Err:      &types.ProvisionedThroughputExceededException{},
+			Sentinel: ErrThrottled,
+		},
+		"table not found": {
+			Err:      &types.ResourceNotFoundException{},
+			Sentinel: ErrTableNotFound,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			ddb := newTestDynamoDB(func(input interface{}) (interface{}, error) {
+				return nil, tc.Err
+			})
+			store, err := New(DynamoDB(ddb))
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			req, _ := http.NewRequest("GET", "http://localhost", nil)
+			session, _ := store.New(req, "blah")
+			ctx := context.Background()
+
+			errs := map[string]error{
+				"save":   store.Save(req, httptest.NewRecorder(), session),
+				"load":   store.load(ctx, "blah", session.ID, sessions.NewSession(store, "blah")),
+				"delete": store.delete(ctx, session.ID),
+			}
+			for op, err := range errs {
+				if !errors.Is(err, tc.Sentinel) {
+					t.Errorf("%v: expected %v; got %v", op, tc.Sentinel, err)
+				}
+				if !errors.Is(err, tc.Err) {
+					t.Errorf("%v: expected underlying error to be preserved; got %v", op, err)
+				}
+				if v := err.Error(); !strings.Contains(v, op) || strings.Contains(v, session.ID) {
+					t.Errorf("%v: expected operation and abbreviated id; got %v", op, v)
+				}
+			}
+		})
+	}
+}
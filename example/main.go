@@ -1,38 +1,52 @@
 package main
 
 import (
+	"expvar"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/gorilla/sessions"
 	"github.com/savaki/dynastore"
 )
 
 func main() {
-	store, err := dynastore.New(dynastore.Path("/"), dynastore.HTTPOnly(), dynastore.MaxAge(900))
+	store, err := dynastore.New(
+		dynastore.Path("/"),
+		dynastore.HTTPOnly(),
+		dynastore.MaxAge(900),
+		dynastore.Instrumentation(hooks()),
+	)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	router := mux.NewRouter()
-	router.Path("/").HandlerFunc(withSession(store, "blah", hello))
+	router.Path("/").Handler(dynastore.Middleware(store, "blah")(http.HandlerFunc(hello)))
+	router.Path("/debug/vars").Handler(expvar.Handler())
 
 	fmt.Println("Starting server on port 3001")
 	log.Fatalln(http.ListenAndServe(":3001", router))
 }
 
-func withSession(store sessions.Store, name string, fn http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, req *http.Request) {
-		session, _ := store.Get(req, name)
-		if session.IsNew {
-			session.Save(req, w)
-		}
-		defer session.Save(req, w)
-
-		fn(w, req)
+// hooks counts session store operations and errors, published at /debug/vars
+func hooks() dynastore.Hooks {
+	var (
+		operations = expvar.NewMap("dynastore.operations")
+		errors     = expvar.NewMap("dynastore.errors")
+	)
+
+	return dynastore.Hooks{
+		OnOperationStart: func(op string) func(error, time.Duration) {
+			return func(err error, _ time.Duration) {
+				operations.Add(op, 1)
+				if err != nil {
+					errors.Add(op, 1)
+				}
+			}
+		},
 	}
 }
 
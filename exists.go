@@ -0,0 +1,124 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ReadOption configures Exists and TTLRemaining
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	eventual bool
+}
+
+// EventuallyConsistent reads with eventual consistency, at half the read capacity
+// of the default strongly consistent read, at the risk of missing a write made
+// moments earlier
+func EventuallyConsistent() ReadOption {
+	return func(o *readOptions) {
+		o.eventual = true
+	}
+}
+
+// Exists returns true if the session with the given id is stored and has not
+// expired.  Only the key and ttl attributes are read; the session is not decoded.
+func (store *Store) Exists(ctx context.Context, id string, opts ...ReadOption) (bool, error) {
+	item, err := store.readExpiry(ctx, id, opts)
+	if err != nil {
+		return false, err
+	}
+	if len(item) == 0 {
+		return false, nil
+	}
+
+	ttl, err := store.itemTTL(item)
+	if err != nil {
+		return false, err
+	}
+	return ttl == 0 || ttl >= store.now().Unix(), nil
+}
+
+// readExpiry reads the key and ttl attributes of the session with the given id,
+// along with the markers left on quarantined and deleted items.  Nil is returned
+// for missing, quarantined and deleted sessions.
+func (store *Store) readExpiry(ctx context.Context, id string, opts []ReadOption) (map[string]types.AttributeValue, error) {
+	var options readOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	input := &dynamodb.GetItemInput{
+		TableName:            aws.String(store.tableName),
+		ConsistentRead:       aws.Bool(!options.eventual && !store.eventualReads),
+		ProjectionExpression: aws.String("#id, #quarantined, #deleted"),
+		ExpressionAttributeNames: map[string]string{
+			"#id":          store.primaryKey,
+			"#quarantined": quarantinedField,
+			"#deleted":     deletedField,
+		},
+		Key:                    store.key(id),
+		ReturnConsumedCapacity: store.returnConsumedCapacity(),
+	}
+	if store.ttlField != "" {
+		input.ProjectionExpression = aws.String("#id, #ttl, #quarantined, #deleted")
+		input.ExpressionAttributeNames["#ttl"] = store.ttlField
+	}
+
+	var out *dynamodb.GetItemOutput
+	err := store.withRetry(ctx, func() (err error) {
+		store.intercept(ctx, OpLoad, input)
+		out, err = store.reader().GetItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpLoad, out.ConsumedCapacity)
+		}
+		return err
+	})
+	if err != nil {
+		store.printf("dynastore: GetItem failed - %v\n", err)
+		return nil, wrapError(OpLoad, id, err)
+	}
+
+	if _, ok := out.Item[quarantinedField]; ok {
+		return nil, nil
+	}
+	if _, ok := out.Item[deletedField]; ok {
+		return nil, nil
+	}
+	return out.Item, nil
+}
+
+// itemTTL returns the ttl of item in unix seconds, or zero if it has none
+func (store *Store) itemTTL(item map[string]types.AttributeValue) (int64, error) {
+	av, ok := item[store.ttlField]
+	if !ok || store.ttlField == "" {
+		return 0, nil
+	}
+	n, ok := av.(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, ErrMalformedSession
+	}
+	ttl, err := strconv.ParseInt(n.Value, 10, 64)
+	if err != nil {
+		return 0, ErrMalformedSession
+	}
+	return ttl, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestExists(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	testCases := map[string]struct {
+		item map[string]types.AttributeValue
+		want bool
+	}{
+		"live": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+				DefaultTTLField:   &types.AttributeValueMemberN{Value: "1500000120"},
+			},
+			want: true,
+		},
+		"expired": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+				DefaultTTLField:   &types.AttributeValueMemberN{Value: "1499999000"},
+			},
+		},
+		"no ttl": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+			},
+			want: true,
+		},
+		"quarantined": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+				quarantinedField:  &types.AttributeValueMemberBOOL{Value: true},
+			},
+		},
+		"not found": {},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var input *dynamodb.GetItemInput
+			ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+				input = in.(*dynamodb.GetItemInput)
+				return &dynamodb.GetItemOutput{Item: tc.item}, nil
+			})
+
+			store, err := New(DynamoDB(ddb))
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			store.now = func() time.Time { return now }
+
+			got, err := store.Exists(context.Background(), "abc")
+			if err != nil {
+				t.Errorf("expected nil; got %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %v; got %v", tc.want, got)
+			}
+			if v := aws.ToString(input.ProjectionExpression); v != "#id, #ttl, #quarantined, #deleted" {
+				t.Errorf("expected projection of key and ttl; got %v", v)
+			}
+			if !aws.ToBool(input.ConsistentRead) {
+				t.Error("expected consistent read")
+			}
+		})
+	}
+}
+
+func TestEventuallyConsistent(t *testing.T) {
+	var input *dynamodb.GetItemInput
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		input = in.(*dynamodb.GetItemInput)
+		return &dynamodb.GetItemOutput{}, nil
+	})
+
+	store, err := New(DynamoDB(ddb))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if _, err := store.TTLRemaining(context.Background(), "abc", EventuallyConsistent()); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+	if aws.ToBool(input.ConsistentRead) {
+		t.Error("expected eventually consistent read")
+	}
+}
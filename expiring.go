@@ -0,0 +1,110 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"encoding/gob"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func init() {
+	gob.Register(expiringValue{})
+}
+
+// expiringValue wraps a session value that should be treated as absent after
+// ExpiresAt.  The names written by JSON and Msgpack are reserved so the value can
+// be told apart from application maps when read back; see restoreValue.
+type expiringValue struct {
+	Value     interface{} `dynamodbav:"dynastore.value" msgpack:"dynastore.value"`
+	ExpiresAt int64       `dynamodbav:"dynastore.expiresAt" msgpack:"dynastore.expiresAt"` // unix seconds
+}
+
+func (v expiringValue) expired(now time.Time) bool {
+	return v.ExpiresAt <= now.Unix()
+}
+
+// SetWithTTL stores value under key, to be treated as absent once d has elapsed.
+// Expiry has a precision of seconds.  Expired values are dropped when the
+// session is next loaded or saved.  Use GetWithTTL to read the value back.
+func SetWithTTL(session *sessions.Session, key string, value interface{}, d time.Duration) {
+	if session.Values == nil {
+		session.Values = map[interface{}]interface{}{}
+	}
+	session.Values[key] = expiringValue{
+		Value:     value,
+		ExpiresAt: sessionNow(session).Add(d).Unix(),
+	}
+}
+
+// GetWithTTL returns the value stored under key, unwrapping values written by
+// SetWithTTL.  False is returned if the key is absent or has expired.
+func GetWithTTL(session *sessions.Session, key string) (interface{}, bool) {
+	v, ok := session.Values[key]
+	if !ok {
+		return nil, false
+	}
+
+	ev, ok := v.(expiringValue)
+	if !ok {
+		return v, true
+	}
+	if ev.expired(sessionNow(session)) {
+		return nil, false
+	}
+
+	return ev.Value, true
+}
+
+// removeExpired deletes all values written by SetWithTTL that have expired
+func removeExpired(values map[interface{}]interface{}, now time.Time) {
+	for k, v := range values {
+		if ev, ok := v.(expiringValue); ok && ev.expired(now) {
+			delete(values, k)
+		}
+	}
+}
+
+// restoreValue rebuilds a value written by SetWithTTL, or the activity log stored
+// under key, from the plain maps and slices JSON and Msgpack decode it as.  Other values are
+// returned as is.
+func restoreValue(key string, v interface{}) interface{} {
+	if key == activityKey {
+		if entries, ok := decodeActivity(v); ok {
+			return entries
+		}
+		return v
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 2 {
+		return v
+	}
+	expiresAt, ok := m["dynastore.expiresAt"].(int)
+	value, present := m["dynastore.value"]
+	if !ok || !present {
+		return v
+	}
+	return expiringValue{Value: restoreValue("", value), ExpiresAt: int64(expiresAt)}
+}
+
+// sessionNow returns the current time according to the store that owns the session
+func sessionNow(session *sessions.Session) time.Time {
+	if store, ok := session.Store().(*Store); ok && store.now != nil {
+		return store.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	hashKey := securecookie.GenerateRandomKey(64)
+	blockKey := securecookie.GenerateRandomKey(32)
+	codec := securecookie.New(hashKey, blockKey)
+	name := "blah"
+
+	testCases := map[string]struct {
+		serializer serializer
+	}{
+		"secure": {
+			serializer: &codecSerializer{codecs: []securecookie.Codec{codec}},
+		},
+		"plainText": {
+			serializer: &gobSerializer{},
+		},
+		"json": {
+			serializer: &jsonSerializer{},
+		},
+		"msgpack": {
+			serializer: &msgpackSerializer{},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			now := time.Unix(1500000000, 0)
+			store := &Store{now: func() time.Time { return now }}
+
+			session := sessions.NewSession(store, name)
+			session.Values["forever"] = "value"
+			SetWithTTL(session, "state", "abc", time.Minute)
+
+			av, err := tc.serializer.marshal(name, session)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			restored := sessions.NewSession(store, name)
+			if err := tc.serializer.unmarshal(name, av, restored); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			if v, ok := GetWithTTL(restored, "state"); !ok || v != "abc" {
+				t.Errorf("expected abc; got %v", v)
+			}
+			if v, ok := GetWithTTL(restored, "forever"); !ok || v != "value" {
+				t.Errorf("expected plain values to be returned as is; got %v", v)
+			}
+
+			now = now.Add(time.Minute)
+			if v, ok := GetWithTTL(restored, "state"); ok {
+				t.Errorf("expected expired value to be absent; got %v", v)
+			}
+
+			removeExpired(restored.Values, store.now())
+			if _, ok := restored.Values["state"]; ok {
+				t.Error("expected expired value to be removed")
+			}
+			if _, ok := restored.Values["forever"]; !ok {
+				t.Error("expected plain value to be retained")
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+var (
+	errGSIDisabled = errors.New("no gsi configured")
+	errQueryAPI    = errors.New("dynamodb client does not support query")
+)
+
+// QueryAPI holds the call used by QueryByAttribute and DeleteByAttribute.  The
+// *dynamodb.Client satisfies both DynamoDBAPI and QueryAPI.
+type QueryAPI interface {
+	Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// SessionRecord describes a session found by QueryByAttribute
+type SessionRecord struct {
+	// ID holds the session id
+	ID string
+	// TTL holds when the session expires; zero if it has no expiry
+	TTL time.Time
+	// Values holds the decoded session values
+	Values map[interface{}]interface{}
+}
+
+// indexValue returns the string form of the session value indexed by GSI
+func (store *Store) indexValue(session *sessions.Session) (string, bool) {
+	if store.gsiIndex == "" {
+		return "", false
+	}
+
+	v, ok := session.Values[store.gsiAttribute]
+	if !ok || v == nil {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, s != ""
+	}
+	return fmt.Sprint(v), true
+}
+
+// QueryByAttribute returns the unexpired sessions whose GSI attribute equals
+// value.  The index must project all attributes.  Sessions that cannot be decoded
+// are skipped.
+func (store *Store) QueryByAttribute(ctx context.Context, value string) ([]SessionRecord, error) {
+	var records []SessionRecord
+	err := store.query(ctx, value, nil, func(items []map[string]types.AttributeValue) error {
+		for _, item := range items {
+			record, ok := store.sessionRecord(ctx, item)
+			if ok {
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// DeleteByAttribute deletes every session whose GSI attribute equals value and
+// returns the number deleted.  Only keys are read from the index.
+func (store *Store) DeleteByAttribute(ctx context.Context, value string) (int, error) {
+	if store.readOnly {
+		return 0, ErrReadOnlyStore
+	}
+
+	deleted := 0
+	err := store.query(ctx, value, aws.String(store.keyProjection(map[string]string{})), func(items []map[string]types.AttributeValue) error {
+		keys := make([]map[string]types.AttributeValue, 0, len(items))
+		for _, item := range items {
+			keys = append(keys, store.keyOf(item))
+		}
+
+		for i := 0; i < len(keys); i += batchWriteSize {
+			end := i + batchWriteSize
+			if end > len(keys) {
+				end = len(keys)
+			}
+
+			if err := store.batchDelete(ctx, keys[i:end], 50*time.Millisecond); err != nil {
+				return err
+			}
+			deleted += end - i
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// query pages through the sessions whose GSI attribute equals value, passing each
+// page of items to fn
+func (store *Store) query(ctx context.Context, value string, projection *string, fn func(items []map[string]types.AttributeValue) error) error {
+	if store.gsiIndex == "" {
+		return errGSIDisabled
+	}
+	api, ok := store.reader().(QueryAPI)
+	if !ok {
+		return errQueryAPI
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(store.tableName),
+		IndexName:              aws.String(store.gsiIndex),
+		KeyConditionExpression: aws.String("#attr = :value"),
+		ProjectionExpression:   projection,
+		ExpressionAttributeNames: map[string]string{
+			"#attr": store.gsiAttribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":value": &types.AttributeValueMemberS{Value: value},
+		},
+	}
+	if projection != nil {
+		store.keyProjection(input.ExpressionAttributeNames)
+	}
+
+	var filter []string
+	if store.keyPrefix != "" {
+		filter = append(filter, "begins_with(#id, :prefix)")
+		input.ExpressionAttributeNames["#id"] = store.primaryKey
+		input.ExpressionAttributeValues[":prefix"] = &types.AttributeValueMemberS{Value: store.itemPrefix()}
+	}
+	if condition := store.sortKeyFilter(input.ExpressionAttributeNames, input.ExpressionAttributeValues); condition != "" {
+		// other items of a single-table design may share the GSI value
+		filter = append(filter, condition)
+	}
+	if len(filter) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filter, " AND "))
+	}
+
+	for {
+		out, err := api.Query(ctx, input)
+		if err != nil {
+			store.printf("dynastore: Query failed - %v\n", err)
+			return err
+		}
+
+		if len(out.Items) > 0 {
+			if err := fn(out.Items); err != nil {
+				return err
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// sessionRecord decodes item; false is returned for expired, quarantined or
+// undecodable items
+func (store *Store) sessionRecord(ctx context.Context, item map[string]types.AttributeValue) (SessionRecord, bool) {
+	session, err := store.decodeItem(ctx, item)
+	if err != nil {
+		return SessionRecord{}, false
+	}
+
+	record := SessionRecord{
+		ID:     session.ID,
+		Values: session.Values,
+	}
+	if n, ok := item[store.ttlField].(*types.AttributeValueMemberN); ok {
+		if ttl, err := strconv.ParseInt(n.Value, 10, 64); err == nil && ttl > 0 {
+			record.TTL = time.Unix(ttl, 0)
+		}
+	}
+
+	return record, true
+}
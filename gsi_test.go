@@ -0,0 +1,154 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestGSI(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(db), GSI("user_id-index", "user_id"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		id, user string
+	}{
+		{id: "a", user: "alice"},
+		{id: "b", user: "alice"},
+		{id: "c", user: "bob"},
+		{id: "d"},
+	} {
+		session := sessions.NewSession(store, "blah")
+		session.ID = tc.id
+		session.Options = &sessions.Options{MaxAge: 60}
+		if tc.user != "" {
+			session.Values["user_id"] = tc.user
+		}
+		if err := store.save(ctx, "blah", session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+
+	if v, ok := db.Item("a")["user_id"].(*types.AttributeValueMemberS); !ok || v.Value != "alice" {
+		t.Errorf("expected top-level user_id; got %#v", db.Item("a")["user_id"])
+	}
+	if _, ok := db.Item("d")["user_id"]; ok {
+		t.Error("expected no user_id attribute for anonymous session")
+	}
+
+	records, err := store.QueryByAttribute(ctx, "alice")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	if v := len(records); v != 2 {
+		t.Fatalf("expected 2 records; got %v", v)
+	}
+	if records[0].ID != "a" || records[1].ID != "b" {
+		t.Errorf("expected a and b; got %v and %v", records[0].ID, records[1].ID)
+	}
+	if v := records[0].Values["user_id"]; v != "alice" {
+		t.Errorf("expected alice; got %v", v)
+	}
+	if v := len(records[0].Values); v != 1 {
+		t.Errorf("expected only application values; got %#v", records[0].Values)
+	}
+	if v := records[0].TTL; !v.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected %v; got %v", now.Add(time.Minute), v)
+	}
+
+	n, err := store.DeleteByAttribute(ctx, "alice")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 deleted; got %v", n)
+	}
+	if v := db.Len(); v != 2 {
+		t.Errorf("expected 2 items to remain; got %v", v)
+	}
+}
+
+func TestGSIPagination(t *testing.T) {
+	var inputs []*dynamodb.QueryInput
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		input, ok := in.(*dynamodb.QueryInput)
+		if !ok {
+			return nil, nil
+		}
+		inputs = append(inputs, input)
+
+		id := "first"
+		out := &dynamodb.QueryOutput{}
+		if input.ExclusiveStartKey == nil {
+			out.LastEvaluatedKey = map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}}
+		} else {
+			id = "second"
+		}
+		out.Items = []map[string]types.AttributeValue{
+			{"id": &types.AttributeValueMemberS{Value: id}},
+		}
+		return out, nil
+	})
+	store, err := New(DynamoDB(ddb), GSI("user_id-index", "user_id"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	n, err := store.DeleteByAttribute(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 deleted; got %v", n)
+	}
+	if v := len(inputs); v != 2 {
+		t.Fatalf("expected 2 queries; got %v", v)
+	}
+	if v := aws.ToString(inputs[0].IndexName); v != "user_id-index" {
+		t.Errorf("expected user_id-index; got %v", v)
+	}
+	if v := aws.ToString(inputs[0].ProjectionExpression); v != "#id" {
+		t.Errorf("expected keys only projection; got %v", v)
+	}
+}
+
+func TestGSIDisabled(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, err := store.QueryByAttribute(context.Background(), "alice"); err != errGSIDisabled {
+		t.Errorf("expected errGSIDisabled; got %v", err)
+	}
+	if _, err := store.DeleteByAttribute(context.Background(), "alice"); err != errGSIDisabled {
+		t.Errorf("expected errGSIDisabled; got %v", err)
+	}
+}
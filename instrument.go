@@ -0,0 +1,218 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// Operation names passed to Hooks
+const (
+	OpLoad       = "load"
+	OpSave       = "save"
+	OpDelete     = "delete"
+	OpTouch      = "touch"
+	OpQuarantine = "quarantine"
+)
+
+// Hooks receive callbacks about the requests the store makes so latency, errors
+// and capacity can be reported to a metrics or tracing system.  Any field may be
+// nil.  See OnRetry for observing retries.
+type Hooks struct {
+	// OnOperationStart is called as an operation (OpLoad, OpSave, OpDelete, OpTouch
+	// or OpQuarantine) begins.  The returned func, if non-nil, is called with the outcome
+	// of the operation and its duration.  ErrNotFound is reported for sessions
+	// that do not exist.
+	OnOperationStart func(op string) func(err error, duration time.Duration)
+
+	// OnConsumedCapacity receives the capacity consumed by each request of an
+	// operation.  Setting it causes requests to ask for the consumed capacity.
+	OnConsumedCapacity func(op string, capacity *types.ConsumedCapacity)
+
+	// OnSaved is called once a session has been saved with TrackCreation or by
+	// PersistWithResult.  created is true if no session was previously stored under
+	// its id.
+	OnSaved func(session *sessions.Session, created bool)
+}
+
+// Stats summarizes the operations performed by a store; see WithConsumedCapacity
+type Stats struct {
+	// ReadCapacityUnits holds the total read capacity consumed
+	ReadCapacityUnits float64
+	// WriteCapacityUnits holds the total write capacity consumed
+	WriteCapacityUnits float64
+	// Operations holds the number of operations performed, keyed by operation name
+	Operations map[string]int
+	// LastItemSize holds the approximate size in bytes of the item last loaded or saved
+	LastItemSize int
+	// SavedItemSizes summarizes the sizes of the most recently saved items
+	SavedItemSizes SizeSummary
+}
+
+// SizeSummary summarizes the approximate sizes, in bytes, of the items last saved
+type SizeSummary struct {
+	// Count holds the number of saves summarized, at most sizeWindow
+	Count int
+	Min   int
+	Max   int
+	Avg   int
+}
+
+// sizeWindow holds the number of saves summarized by Stats.SavedItemSizes
+const sizeWindow = 100
+
+// stats accumulates Stats under a mutex as handlers run concurrently
+type stats struct {
+	mutex sync.Mutex
+	Stats
+
+	// sizes holds the sizes of the last sizeWindow saves, overwritten from next
+	sizes []int
+	next  int
+}
+
+// Stats returns a snapshot of the statistics gathered since the store was
+// created.  Statistics are only gathered with WithConsumedCapacity, except for
+// SavedItemSizes which is also gathered with WarnItemSize.
+func (store *Store) Stats() Stats {
+	store.stats.mutex.Lock()
+	defer store.stats.mutex.Unlock()
+
+	snapshot := store.stats.Stats
+	snapshot.Operations = map[string]int{}
+	for op, n := range store.stats.Operations {
+		snapshot.Operations[op] = n
+	}
+	snapshot.SavedItemSizes = summarize(store.stats.sizes)
+	return snapshot
+}
+
+// summarize returns the SizeSummary of sizes
+func summarize(sizes []int) SizeSummary {
+	if len(sizes) == 0 {
+		return SizeSummary{}
+	}
+
+	summary := SizeSummary{Count: len(sizes), Min: sizes[0], Max: sizes[0]}
+	total := 0
+	for _, size := range sizes {
+		total += size
+		summary.Min = min(summary.Min, size)
+		summary.Max = max(summary.Max, size)
+	}
+	summary.Avg = total / len(sizes)
+	return summary
+}
+
+// startOperation notifies the hooks that op has begun and returns a func to be
+// called with its outcome
+func (store *Store) startOperation(op string) func(err error) {
+	if store.collectStats {
+		store.stats.mutex.Lock()
+		if store.stats.Operations == nil {
+			store.stats.Operations = map[string]int{}
+		}
+		store.stats.Operations[op]++
+		store.stats.mutex.Unlock()
+	}
+
+	if store.hooks.OnOperationStart == nil {
+		return func(error) {}
+	}
+
+	done := store.hooks.OnOperationStart(op)
+	if done == nil {
+		return func(error) {}
+	}
+
+	begin := time.Now()
+	return func(err error) {
+		done(err, time.Since(begin))
+	}
+}
+
+// returnConsumedCapacity returns the ReturnConsumedCapacity setting for requests
+func (store *Store) returnConsumedCapacity() types.ReturnConsumedCapacity {
+	if store.hooks.OnConsumedCapacity == nil && !store.collectStats {
+		return ""
+	}
+	return types.ReturnConsumedCapacityTotal
+}
+
+// consumedCapacity passes the capacity consumed by a request of op to the hooks
+// and adds it to the store's Stats
+func (store *Store) consumedCapacity(op string, capacity *types.ConsumedCapacity) {
+	if capacity == nil {
+		return
+	}
+
+	if store.collectStats {
+		read, write := capacity.ReadCapacityUnits, capacity.WriteCapacityUnits
+		if read == nil && write == nil {
+			// only the total is reported; attribute it by operation
+			if op == OpLoad {
+				read = capacity.CapacityUnits
+			} else {
+				write = capacity.CapacityUnits
+			}
+		}
+
+		store.stats.mutex.Lock()
+		if read != nil {
+			store.stats.ReadCapacityUnits += *read
+		}
+		if write != nil {
+			store.stats.WriteCapacityUnits += *write
+		}
+		store.stats.mutex.Unlock()
+	}
+
+	if store.hooks.OnConsumedCapacity != nil {
+		store.hooks.OnConsumedCapacity(op, capacity)
+	}
+}
+
+// recordSaveSize adds the size of a saved item to Stats.SavedItemSizes
+func (store *Store) recordSaveSize(size int) {
+	if !store.collectStats && store.warnSize <= 0 {
+		return
+	}
+
+	store.stats.mutex.Lock()
+	defer store.stats.mutex.Unlock()
+
+	if len(store.stats.sizes) < sizeWindow {
+		store.stats.sizes = append(store.stats.sizes, size)
+		return
+	}
+	store.stats.sizes[store.stats.next] = size
+	store.stats.next = (store.stats.next + 1) % sizeWindow
+}
+
+// recordItemSize notes the size of the item last loaded or saved
+func (store *Store) recordItemSize(item map[string]types.AttributeValue) {
+	if !store.collectStats {
+		return
+	}
+
+	size := itemSize(item)
+	store.stats.mutex.Lock()
+	store.stats.LastItemSize = size
+	store.stats.mutex.Unlock()
+}
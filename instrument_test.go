@@ -0,0 +1,215 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+type operation struct {
+	Op  string
+	Err error
+}
+
+func TestInstrumentation(t *testing.T) {
+	failure := errors.New("boom")
+
+	testCases := map[string]struct {
+		Err      error
+		Expected []operation
+	}{
+		"success": {
+			Expected: []operation{
+				{Op: OpSave},
+				{Op: OpLoad},
+				{Op: OpDelete},
+			},
+		},
+		"error": {
+			Err: failure,
+			Expected: []operation{
+				{Op: OpSave, Err: failure},
+				{Op: OpLoad, Err: failure},
+				{Op: OpDelete, Err: failure},
+			},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				saved      map[string]types.AttributeValue
+				operations []operation
+				capacity   []string
+			)
+
+			ddb := newTestDynamoDB(func(input interface{}) (interface{}, error) {
+				if tc.Err != nil {
+					return nil, tc.Err
+				}
+
+				cc := &types.ConsumedCapacity{CapacityUnits: aws.Float64(1)}
+				switch v := input.(type) {
+				case *dynamodb.PutItemInput:
+					if v.ReturnConsumedCapacity != types.ReturnConsumedCapacityTotal {
+						t.Errorf("expected consumed capacity to be requested")
+					}
+					saved = v.Item
+					return &dynamodb.PutItemOutput{ConsumedCapacity: cc}, nil
+				case *dynamodb.GetItemInput:
+					return &dynamodb.GetItemOutput{Item: saved, ConsumedCapacity: cc}, nil
+				case *dynamodb.DeleteItemInput:
+					return &dynamodb.DeleteItemOutput{ConsumedCapacity: cc}, nil
+				}
+				return nil, nil
+			})
+
+			store, err := New(DynamoDB(ddb), Instrumentation(Hooks{
+				OnOperationStart: func(op string) func(error, time.Duration) {
+					return func(err error, duration time.Duration) {
+						if err != nil {
+							err = errors.Unwrap(err)
+						}
+						operations = append(operations, operation{Op: op, Err: err})
+						if duration < 0 {
+							t.Errorf("expected non-negative duration; got %v", duration)
+						}
+					}
+				},
+				OnConsumedCapacity: func(op string, cc *types.ConsumedCapacity) {
+					capacity = append(capacity, op)
+				},
+			}))
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			ctx := context.Background()
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			store.save(ctx, "blah", session)
+			store.load(ctx, "blah", "abc", sessions.NewSession(store, "blah"))
+			store.delete(ctx, "abc")
+
+			if !reflect.DeepEqual(tc.Expected, operations) {
+				t.Errorf("expected %v; got %v", tc.Expected, operations)
+			}
+			if tc.Err == nil && !reflect.DeepEqual([]string{OpSave, OpLoad, OpDelete}, capacity) {
+				t.Errorf("expected capacity for each operation; got %v", capacity)
+			}
+		})
+	}
+}
+
+func TestInstrumentationNotFound(t *testing.T) {
+	var got error
+	store, err := New(DynamoDB(newTestDynamoDB(nil)), Instrumentation(Hooks{
+		OnOperationStart: func(op string) func(error, time.Duration) {
+			return func(err error, _ time.Duration) { got = err }
+		},
+	}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	store.load(context.Background(), "blah", "missing", sessions.NewSession(store, "blah"))
+	if got != ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", got)
+	}
+}
+
+func TestStats(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		saved   = map[string]types.AttributeValue{}
+		missing []string
+	)
+	ddb := newTestDynamoDB(func(input interface{}) (interface{}, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch v := input.(type) {
+		case *dynamodb.PutItemInput:
+			if v.ReturnConsumedCapacity != types.ReturnConsumedCapacityTotal {
+				missing = append(missing, "PutItem")
+			}
+			saved = v.Item
+			return &dynamodb.PutItemOutput{ConsumedCapacity: &types.ConsumedCapacity{CapacityUnits: aws.Float64(1)}}, nil
+		case *dynamodb.GetItemInput:
+			if v.ReturnConsumedCapacity != types.ReturnConsumedCapacityTotal {
+				missing = append(missing, "GetItem")
+			}
+			return &dynamodb.GetItemOutput{Item: saved, ConsumedCapacity: &types.ConsumedCapacity{CapacityUnits: aws.Float64(0.5)}}, nil
+		case *dynamodb.DeleteItemInput:
+			if v.ReturnConsumedCapacity != types.ReturnConsumedCapacityTotal {
+				missing = append(missing, "DeleteItem")
+			}
+			return &dynamodb.DeleteItemOutput{ConsumedCapacity: &types.ConsumedCapacity{
+				CapacityUnits:      aws.Float64(2),
+				WriteCapacityUnits: aws.Float64(2),
+			}}, nil
+		}
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), WithConsumedCapacity())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			session.Values["hello"] = "world"
+			store.save(ctx, "blah", session)
+			store.load(ctx, "blah", "abc", sessions.NewSession(store, "blah"))
+		}()
+	}
+	wg.Wait()
+	store.delete(ctx, "abc")
+
+	if len(missing) > 0 {
+		t.Errorf("expected consumed capacity to be requested; missing from %v", missing)
+	}
+
+	stats := store.Stats()
+	if v := stats.ReadCapacityUnits; v != 5 {
+		t.Errorf("expected 5 RCU; got %v", v)
+	}
+	if v := stats.WriteCapacityUnits; v != 12 {
+		t.Errorf("expected 12 WCU; got %v", v)
+	}
+	if expected := map[string]int{OpSave: 10, OpLoad: 10, OpDelete: 1}; !reflect.DeepEqual(expected, stats.Operations) {
+		t.Errorf("expected %v; got %v", expected, stats.Operations)
+	}
+	if v := stats.LastItemSize; v != itemSize(saved) {
+		t.Errorf("expected %v; got %v", itemSize(saved), v)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build integration
+
+package dynastore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/securecookie"
+)
+
+// The integration tests run against the DynamoDB compatible endpoint named by
+// DYNASTORE_ENDPOINT, typically DynamoDB Local:
+//
+//	docker run -p 8000:8000 amazon/dynamodb-local
+//	DYNASTORE_ENDPOINT=http://localhost:8000 go test -tags integration
+var endpoint = os.Getenv("DYNASTORE_ENDPOINT")
+
+func TestMain(m *testing.M) {
+	if endpoint == "" {
+		fmt.Println("DYNASTORE_ENDPOINT not set; skipping integration tests")
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// localConfig returns a config with static credentials, which DynamoDB Local accepts
+func localConfig() aws.Config {
+	return aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local"}, nil
+		}),
+	}
+}
+
+// newTable creates a throwaway table, deleting it once the test completes
+func newTable(t *testing.T) string {
+	tableName := "dynastore-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	store, err := New(AWSConfig(localConfig()), Endpoint(endpoint), TableName(tableName), CreateTableTimeout(time.Minute))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// creating twice verifies existing tables are tolerated
+	for i := 0; i < 2; i++ {
+		if err := store.CreateTableIfNotExists(context.Background()); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		store.ddb.(*dynamodb.Client).DeleteTable(context.Background(), &dynamodb.DeleteTableInput{
+			TableName: aws.String(tableName),
+		})
+	})
+
+	return tableName
+}
+
+func TestLifecycle(t *testing.T) {
+	codec := securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	name := "blah"
+	tableName := newTable(t)
+
+	testCases := map[string][]Option{
+		"gob":   {},
+		"codec": {Codecs(codec)},
+		"json":  {JSON()},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store, err := New(append(tc, AWSConfig(localConfig()), Endpoint(endpoint), TableName(tableName), MaxAge(3600))...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			// New Session ------------------------
+
+			req, _ := http.NewRequest("GET", "http://localhost", nil)
+			session, err := store.New(req, name)
+			if err != nil {
+				t.Fatalf("expected New returns nil; got %v", err)
+			}
+			if !session.IsNew {
+				t.Fatal("expected new session")
+			}
+			session.Values["hello"] = "world"
+
+			// Save -------------------------------
+
+			w := httptest.NewRecorder()
+			if err := store.Save(req, w, session); err != nil {
+				t.Fatalf("expected Save returns nil; got %v", err)
+			}
+			cookies := w.Result().Cookies()
+			if v := len(cookies); v != 1 {
+				t.Fatalf("expected Save sets 1 cookie; got %v", v)
+			}
+
+			// TTL --------------------------------
+
+			out, err := store.ddb.GetItem(context.Background(), &dynamodb.GetItemInput{
+				TableName:      aws.String(tableName),
+				Key:            store.key(session.ID),
+				ConsistentRead: aws.Bool(true),
+			})
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			n, ok := out.Item[DefaultTTLField].(*types.AttributeValueMemberN)
+			if !ok {
+				t.Fatalf("expected numeric ttl attribute; got %#v", out.Item[DefaultTTLField])
+			}
+			ttl, _ := strconv.ParseInt(n.Value, 10, 64)
+			if expected := time.Now().Add(time.Hour).Unix(); ttl < expected-60 || ttl > expected+60 {
+				t.Errorf("expected ttl near %v; got %v", expected, ttl)
+			}
+
+			// Existing Session -------------------
+
+			req, _ = http.NewRequest("GET", "http://localhost", nil)
+			req.AddCookie(cookies[0])
+			found, err := store.New(req, name)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if found.IsNew {
+				t.Fatal("expected existing session; got new session")
+			}
+			if v := found.Values["hello"]; v != "world" {
+				t.Errorf("expected world; got %v", v)
+			}
+
+			// Delete Session ---------------------
+
+			found.Options.MaxAge = -1
+			w = httptest.NewRecorder()
+			if err := store.Save(req, w, found); err != nil {
+				t.Fatalf("expected Save returns nil; got %v", err)
+			}
+			cookies = w.Result().Cookies()
+			if v := len(cookies); v != 1 {
+				t.Fatalf("expected Save sets 1 cookie; got %v", v)
+			}
+			if cookie := cookies[0]; cookie.Value != "" {
+				t.Errorf("expected cookie to be cleared; got %v", cookie.Value)
+			}
+
+			// Verify Session Deleted -------------
+
+			found, err = store.New(req, name)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if !found.IsNew {
+				t.Error("expected new session; got existing session")
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import "context"
+
+// RequestInterceptorFunc receives the input of each GetItem, PutItem, UpdateItem
+// and DeleteItem request made by the store, along with the operation (OpLoad,
+// OpSave, OpDelete or OpTouch) it serves, and may modify it; see RequestInterceptor
+type RequestInterceptorFunc func(ctx context.Context, op string, input interface{})
+
+// intercept passes input, a *dynamodb.GetItemInput, *dynamodb.PutItemInput,
+// *dynamodb.UpdateItemInput or *dynamodb.DeleteItemInput, to the interceptor
+func (store *Store) intercept(ctx context.Context, op string, input interface{}) {
+	if store.interceptor != nil {
+		store.interceptor(ctx, op, input)
+	}
+}
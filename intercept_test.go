@@ -0,0 +1,100 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestRequestInterceptor(t *testing.T) {
+	var calls []string
+	interceptor := func(ctx context.Context, op string, input interface{}) {
+		calls = append(calls, fmt.Sprintf("%v %T", op, input))
+		if in, ok := input.(*dynamodb.PutItemInput); ok {
+			in.ReturnValuesOnConditionCheckFailure = types.ReturnValuesOnConditionCheckFailureAllOld
+		}
+	}
+
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), RequestInterceptor(interceptor))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err = store.New(req, "blah")
+	if err != nil || session.IsNew {
+		t.Fatalf("expected existing session; got %v", err)
+	}
+	if err := store.touch(context.Background(), session.ID, "1"); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.delete(context.Background(), session.ID); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	want := []string{
+		"save *dynamodb.PutItemInput",
+		"load *dynamodb.GetItemInput",
+		"touch *dynamodb.UpdateItemInput",
+		"delete *dynamodb.DeleteItemInput",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected %v; got %v", want, calls)
+	}
+
+	for _, req := range db.Requests() {
+		if in, ok := req.(*dynamodb.PutItemInput); ok {
+			if v := in.ReturnValuesOnConditionCheckFailure; v != types.ReturnValuesOnConditionCheckFailureAllOld {
+				t.Errorf("expected interceptor change to be sent; got %v", v)
+			}
+		}
+	}
+}
+
+func TestRequestInterceptorRetry(t *testing.T) {
+	ddb, _ := newThrottledDynamoDB(2)
+
+	var n int
+	store, err := New(DynamoDB(ddb), Retry(3, time.Millisecond), RequestInterceptor(func(ctx context.Context, op string, input interface{}) {
+		n++
+	}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.delete(context.Background(), "abc"); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected interceptor to be called for each attempt; got %v", n)
+	}
+}
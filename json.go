@@ -0,0 +1,192 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// jsonSerializer stores session.Values as a native DynamoDB map so other languages
+// can read individual values.  Only string keys are supported.
+type jsonSerializer struct {
+	primaryKey string
+}
+
+func (j *jsonSerializer) marshal(name string, session *sessions.Session) (map[string]types.AttributeValue, error) {
+	values := make(map[string]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		key, ok := k.(string)
+		if !ok {
+			return nil, ErrEncodeFailed
+		}
+		values[key] = v
+	}
+
+	m, err := attributevalue.MarshalMap(values)
+	if err != nil {
+		return nil, ErrEncodeFailed
+	}
+
+	av := map[string]types.AttributeValue{
+		keyName(j.primaryKey): &types.AttributeValueMemberS{Value: session.ID},
+		valuesField:           &types.AttributeValueMemberM{Value: m},
+	}
+
+	if session.Options != nil {
+		options, err := attributevalue.Marshal(session.Options)
+		if err != nil {
+			return nil, err
+		}
+		av[optionsField] = options
+	}
+
+	return av, nil
+}
+
+func (j *jsonSerializer) unmarshal(name string, in map[string]types.AttributeValue, session *sessions.Session) error {
+	if len(in) == 0 {
+		return ErrNotFound
+	}
+
+	// id
+	id, ok := in[keyName(j.primaryKey)].(*types.AttributeValueMemberS)
+	if !ok {
+		return ErrMalformedSession
+	}
+
+	// payload
+
+	m, ok := in[valuesField].(*types.AttributeValueMemberM)
+	if !ok {
+		return ErrMalformedSession
+	}
+
+	values := make(map[interface{}]interface{}, len(m.Value))
+	for k, v := range m.Value {
+		value, err := decodeJSONValue(v)
+		if err != nil {
+			return err
+		}
+		values[k] = restoreValue(k, value)
+	}
+
+	session.IsNew = false
+	session.ID = id.Value
+	session.Values = values
+
+	// options
+
+	av, ok := in[optionsField]
+	if ok {
+		options := &sessions.Options{}
+		err := attributevalue.Unmarshal(av, options)
+		if err != nil {
+			return err
+		}
+		session.Options = options
+	}
+
+	return nil
+}
+
+func (j *jsonSerializer) marshalValue(name string, value interface{}) (types.AttributeValue, error) {
+	av, err := attributevalue.Marshal(value)
+	if err != nil {
+		return nil, ErrEncodeFailed
+	}
+	return av, nil
+}
+
+func (j *jsonSerializer) unmarshalValue(name string, av types.AttributeValue) (interface{}, error) {
+	if av == nil {
+		return nil, ErrMalformedSession
+	}
+	return decodeJSONValue(av)
+}
+
+// decodeJSONValue converts av into plain Go values.  Numbers without a fraction or
+// exponent are returned as int and all others as float64.
+func decodeJSONValue(av types.AttributeValue) (interface{}, error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberNULL:
+		return nil, nil
+	case *types.AttributeValueMemberS:
+		return v.Value, nil
+	case *types.AttributeValueMemberN:
+		return decodeJSONNumber(v.Value)
+	case *types.AttributeValueMemberBOOL:
+		return v.Value, nil
+	case *types.AttributeValueMemberB:
+		return append([]byte(nil), v.Value...), nil
+	case *types.AttributeValueMemberM:
+		m := make(map[string]interface{}, len(v.Value))
+		for k, item := range v.Value {
+			value, err := decodeJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = value
+		}
+		return m, nil
+	case *types.AttributeValueMemberL:
+		l := make([]interface{}, 0, len(v.Value))
+		for _, item := range v.Value {
+			value, err := decodeJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, value)
+		}
+		return l, nil
+	case *types.AttributeValueMemberSS:
+		return append([]string(nil), v.Value...), nil
+	case *types.AttributeValueMemberNS:
+		ns := make([]interface{}, 0, len(v.Value))
+		for _, n := range v.Value {
+			value, err := decodeJSONNumber(n)
+			if err != nil {
+				return nil, err
+			}
+			ns = append(ns, value)
+		}
+		return ns, nil
+	case *types.AttributeValueMemberBS:
+		bs := make([][]byte, 0, len(v.Value))
+		for _, b := range v.Value {
+			bs = append(bs, append([]byte(nil), b...))
+		}
+		return bs, nil
+	}
+	return nil, ErrDecodeFailed
+}
+
+func decodeJSONNumber(n string) (interface{}, error) {
+	if !strings.ContainsAny(n, ".eE") {
+		if v, err := strconv.Atoi(n); err == nil {
+			return v, nil
+		}
+	}
+
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return nil, ErrDecodeFailed
+	}
+	return v, nil
+}
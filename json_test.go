@@ -0,0 +1,129 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestJSONSerializer(t *testing.T) {
+	s := &jsonSerializer{}
+
+	session := &sessions.Session{
+		ID: "abc",
+		Values: map[interface{}]interface{}{
+			"hello": "world",
+			"int":   42,
+			"float": 3.25,
+			"bool":  true,
+			"null":  nil,
+			"nested": map[string]interface{}{
+				"count": -7,
+				"ratio": 0.5,
+				"tags":  []interface{}{"a", 1, 2.5, nil},
+				"inner": map[string]interface{}{"ok": false},
+			},
+		},
+		Options: &sessions.Options{MaxAge: 60},
+	}
+
+	av, err := s.marshal("blah", session)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	m, ok := av[valuesField].(*types.AttributeValueMemberM)
+	if !ok {
+		t.Fatalf("expected values to be stored as a map; got %T", av[valuesField])
+	}
+	if v, ok := m.Value["hello"].(*types.AttributeValueMemberS); !ok || v.Value != "world" {
+		t.Errorf("expected hello to be readable natively; got %#v", m.Value["hello"])
+	}
+
+	restored := &sessions.Session{}
+	if err := s.unmarshal("blah", av, restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if !reflect.DeepEqual(session.Values, restored.Values) {
+		t.Errorf("expected %#v; got %#v", session.Values, restored.Values)
+	}
+	if restored.ID != "abc" || restored.Options.MaxAge != 60 {
+		t.Errorf("expected id and options to be restored; got %v %v", restored.ID, restored.Options)
+	}
+
+	// non-string keys are rejected
+	session.Values[42] = "answer"
+	if _, err := s.marshal("blah", session); err != ErrEncodeFailed {
+		t.Errorf("expected ErrEncodeFailed; got %v", err)
+	}
+}
+
+func TestJSONOption(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), JSON())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, ok := store.serializer.(*jsonSerializer); !ok {
+		t.Fatalf("expected jsonSerializer; got %T", store.serializer)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["n"] = 1
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	restored := sessions.NewSession(store, "blah")
+	if err := store.load(context.Background(), "blah", "abc", restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v, ok := restored.Values["n"].(int); !ok || v != 1 {
+		t.Errorf("expected int 1; got %#v", restored.Values["n"])
+	}
+}
+
+func TestJSONBinaryCopied(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), JSON())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["b"] = []byte("hello")
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		restored := sessions.NewSession(store, "blah")
+		if err := store.load(context.Background(), "blah", "abc", restored); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		b, ok := restored.Values["b"].([]byte)
+		if !ok || string(b) != "hello" {
+			t.Fatalf("expected hello; got %#v", restored.Values["b"])
+		}
+		b[0] = 'J'
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// KeyDeriverFunc maps the token carried by the cookie to the id under which the
+// session is stored; see KeyDeriver
+type KeyDeriverFunc func(token string) string
+
+// HMACKeyDeriver returns a KeyDeriverFunc that stores sessions under the hex
+// encoded HMAC-SHA256 of the token so cookie values never appear in the table.
+// Changing secret orphans existing sessions.
+func HMACKeyDeriver(secret []byte) KeyDeriverFunc {
+	secret = append([]byte(nil), secret...)
+	return func(token string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(token))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+}
+
+// deriveKey returns the id under which the session with the given token is stored
+func (store *Store) deriveKey(token string) string {
+	if store.keyDeriver == nil {
+		return token
+	}
+	return store.keyDeriver(token)
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestKeyDeriver(t *testing.T) {
+	db := &dynastoretest.DB{}
+	derive := HMACKeyDeriver([]byte("secret"))
+	store, err := New(DynamoDB(db), KeyDeriver(derive), KeyPrefix("app"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["user"] = "joe"
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+	token := session.ID
+
+	if item := db.Item(token); item != nil {
+		t.Error("expected no item keyed by the cookie token")
+	}
+	if item := db.Item("app#" + token); item != nil {
+		t.Error("expected no item keyed by the prefixed cookie token")
+	}
+	key := "app#" + derive(token)
+	if item := db.Item(key); item == nil {
+		t.Fatalf("expected item at %v", key)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookie)
+	loaded, err := store.New(req, "blah")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("expected existing session; got %v", err)
+	}
+	if loaded.ID != token {
+		t.Errorf("expected %v; got %v", token, loaded.ID)
+	}
+	if v := loaded.Values["user"]; v != "joe" {
+		t.Errorf("expected joe; got %v", v)
+	}
+
+	found, err := store.LoadMulti(context.Background(), []string{token})
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if found[token] == nil {
+		t.Errorf("expected session keyed by %v", token)
+	}
+
+	loaded.Options.MaxAge = -1
+	if err := store.Save(req, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := db.Len(); v != 0 {
+		t.Errorf("expected 0 items; got %v", v)
+	}
+}
+
+func TestHMACKeyDeriver(t *testing.T) {
+	a, b := HMACKeyDeriver([]byte("a")), HMACKeyDeriver([]byte("b"))
+	if a("token") != a("token") {
+		t.Error("expected deriver to be deterministic")
+	}
+	if a("token") == b("token") {
+		t.Error("expected keys to differ by secret")
+	}
+	if a("token") == "token" {
+		t.Error("expected key to differ from token")
+	}
+
+	store, err := New(DynamoDB(&dynastoretest.DB{}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := store.itemID("token"); v != "token" {
+		t.Errorf("expected token; got %v", v)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// keyPrefixSeparator separates the KeyPrefix from the session id in the hash key
+const keyPrefixSeparator = "#"
+
+// itemID returns the hash key value of the item holding the session with the given id
+func (store *Store) itemID(id string) string {
+	return store.itemPrefix() + store.deriveKey(id)
+}
+
+// itemPrefix returns the prefix shared by the hash keys of all items written by
+// the store
+func (store *Store) itemPrefix() string {
+	if store.keyPrefix == "" {
+		return ""
+	}
+	return store.keyPrefix + keyPrefixSeparator
+}
+
+// legacyKey returns the un-prefixed key of a session written before KeyPrefix was
+// configured, or nil if such items are not consulted
+func (store *Store) legacyKey(id string) map[string]types.AttributeValue {
+	if store.keyPrefix == "" || !store.fallbackUnprefixed {
+		return nil
+	}
+	return store.itemKey(id)
+}
+
+// getItem reads the item holding the session with the given id, falling back to
+// the un-prefixed item when FallbackToUnprefixed is set.  True is returned if the
+// un-prefixed item was read.
+func (store *Store) getItem(ctx context.Context, id string) (map[string]types.AttributeValue, bool, error) {
+	item, err := store.loadItem(ctx, store.key(id))
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := store.legacyKey(id)
+	if len(item) > 0 || key == nil {
+		return item, false, nil
+	}
+
+	item, err = store.loadItem(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	return item, len(item) > 0, nil
+}
+
+// loadItem reads the item with the given key to load a session, using the
+// ReadClient.  Loads are strongly consistent, unless EventuallyConsistentReads is
+// set, so a session saved by one instance is visible to the next request
+// regardless of which instance serves it; this costs twice the read capacity of an
+// eventually consistent read.
+func (store *Store) loadItem(ctx context.Context, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	return store.getItemFrom(ctx, store.reader(), store.consistentRead(), key)
+}
+
+// readItem performs a strongly consistent read of the item with the given key
+// using the write client, e.g. to confirm the outcome of a failed write
+func (store *Store) readItem(ctx context.Context, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	return store.getItemFrom(ctx, store.ddb, aws.Bool(true), key)
+}
+
+// getItemFrom reads the item with the given key using api
+func (store *Store) getItemFrom(ctx context.Context, api DynamoDBAPI, consistent *bool, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	var out *dynamodb.GetItemOutput
+	err := store.withRetry(ctx, func() (err error) {
+		input := &dynamodb.GetItemInput{
+			TableName:              aws.String(store.tableName),
+			ConsistentRead:         consistent,
+			Key:                    key,
+			ReturnConsumedCapacity: store.returnConsumedCapacity(),
+		}
+		store.intercept(ctx, OpLoad, input)
+		out, err = api.GetItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpLoad, out.ConsumedCapacity)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Item, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestKeyPrefix(t *testing.T) {
+	db := &dynastoretest.DB{}
+	appA, err := New(DynamoDB(db), KeyPrefix("a"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	appB, err := New(DynamoDB(db), KeyPrefix("b"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := appA.New(req, "blah")
+	session.Values["hello"] = "world"
+	w := httptest.NewRecorder()
+	if err := appA.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if db.Item("a#"+session.ID) == nil {
+		t.Fatalf("expected item to be stored under prefixed key")
+	}
+	cookie := w.Result().Cookies()[0]
+	if cookie.Value != session.ID {
+		t.Errorf("expected cookie to hold the bare id; got %v", cookie.Value)
+	}
+
+	load := func(store *Store) *sessions.Session {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(cookie)
+		session, _ := store.New(req, "blah")
+		return session
+	}
+
+	if got := load(appA); got.IsNew || got.ID != session.ID || got.Values["hello"] != "world" {
+		t.Errorf("expected session to load; got %v %v", got.ID, got.Values)
+	}
+	if got := load(appB); !got.IsNew {
+		t.Error("expected session from another prefix not to load")
+	}
+
+	if err := appA.delete(context.Background(), session.ID); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := db.Len(); v != 0 {
+		t.Errorf("expected 0 items; got %v", v)
+	}
+}
+
+func TestFallbackToUnprefixed(t *testing.T) {
+	db := &dynastoretest.DB{}
+	legacy, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := legacy.New(req, "blah")
+	session.Values["hello"] = "world"
+	w := httptest.NewRecorder()
+	if err := legacy.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	load := func(store *Store) (*http.Request, *sessions.Session) {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(cookie)
+		session, _ := store.New(req, "blah")
+		return req, session
+	}
+
+	strict, err := New(DynamoDB(db), KeyPrefix("a"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, got := load(strict); !got.IsNew {
+		t.Error("expected un-prefixed session not to load without fallback")
+	}
+
+	store, err := New(DynamoDB(db), KeyPrefix("a"), FallbackToUnprefixed())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	req, got := load(store)
+	if got.IsNew || got.ID != session.ID || got.Values["hello"] != "world" {
+		t.Fatalf("expected un-prefixed session to load; got %v %v", got.ID, got.Values)
+	}
+
+	// saving migrates the session to the prefixed key
+	if err := store.Save(req, httptest.NewRecorder(), got); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if db.Item("a#"+session.ID) == nil {
+		t.Error("expected session to be written under prefixed key")
+	}
+
+	// deleting removes both items so the session cannot be revived by the fallback
+	if err := store.delete(context.Background(), session.ID); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := db.Len(); v != 0 {
+		t.Errorf("expected 0 items; got %v", v)
+	}
+}
+
+func TestKeyPrefixDeleteExpired(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+
+	for _, prefix := range []string{"a", "b"} {
+		store, err := New(DynamoDB(db), KeyPrefix(prefix), MaxAge(60))
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		store.now = func() time.Time { return now }
+
+		session := sessions.NewSession(store, "blah")
+		session.ID = "abc"
+		session.Options = &sessions.Options{MaxAge: 60}
+		if err := store.save(context.Background(), "blah", session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+
+	store, err := New(DynamoDB(db), KeyPrefix("a"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	n, err := store.DeleteExpired(context.Background(), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 deleted; got %v", n)
+	}
+	if db.Item("b#abc") == nil {
+		t.Error("expected other prefix to be untouched")
+	}
+}
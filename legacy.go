@@ -0,0 +1,46 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// decodeLegacy attempts to decode an item the configured serializer could not
+// read using the layout written by the original dynastore: the gob encoded values
+// as a base64 string and the options marshaled by dynamodbattribute.  Sessions
+// decoded this way are flagged so the next save rewrites them in full.
+func (store *Store) decodeLegacy(name string, item map[string]types.AttributeValue, session *sessions.Session, cause error) error {
+	if store.disableLegacy || (cause != ErrMalformedSession && cause != ErrDecodeFailed) {
+		return cause
+	}
+	if _, ok := store.serializer.(*gobSerializer); ok {
+		// the gob serializer already reads the legacy layout
+		return cause
+	}
+	if _, ok := item[valuesField].(*types.AttributeValueMemberS); !ok {
+		return cause
+	}
+
+	legacy := &gobSerializer{primaryKey: store.primaryKey}
+	if err := legacy.unmarshal(name, item, session); err != nil {
+		return cause
+	}
+
+	store.printf("dynastore: decoded session in legacy format\n")
+	stateOf(session).legacy = true
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/gob"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+// legacyItem returns an item in the layout written by the original dynastore
+// using the v1 SDK; empty strings were marshaled as NULL
+func legacyItem(t *testing.T, id string, values map[interface{}]interface{}) map[string]types.AttributeValue {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(values); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	return map[string]types.AttributeValue{
+		"id":     &types.AttributeValueMemberS{Value: id},
+		"values": &types.AttributeValueMemberS{Value: base64.StdEncoding.EncodeToString(buf.Bytes())},
+		"options": &types.AttributeValueMemberM{
+			Value: map[string]types.AttributeValue{
+				"Path":     &types.AttributeValueMemberS{Value: "/"},
+				"Domain":   &types.AttributeValueMemberNULL{Value: true},
+				"MaxAge":   &types.AttributeValueMemberN{Value: "86400"},
+				"Secure":   &types.AttributeValueMemberBOOL{Value: false},
+				"HttpOnly": &types.AttributeValueMemberBOOL{Value: true},
+			},
+		},
+	}
+}
+
+func TestLegacyFallback(t *testing.T) {
+	codec := securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+
+	testCases := map[string][]Option{
+		"json":  {JSON()},
+		"codec": {Codecs(codec)},
+	}
+
+	for label, opts := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			db.SetItem(legacyItem(t, "abc", map[interface{}]interface{}{"hello": "world"}))
+
+			store, err := New(append(opts, DynamoDB(db))...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			ctx := context.Background()
+			session := sessions.NewSession(store, "blah")
+			if err := store.load(ctx, "blah", "abc", session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if v := session.Values["hello"]; v != "world" {
+				t.Errorf("expected world; got %v", v)
+			}
+			if v := session.Options; v == nil || v.Path != "/" || v.MaxAge != 86400 || !v.HttpOnly || v.Domain != "" {
+				t.Errorf("expected legacy options; got %#v", v)
+			}
+			if !stateOf(session).legacy {
+				t.Fatal("expected session to be flagged as legacy")
+			}
+
+			if err := store.save(ctx, "blah", session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if stateOf(session).legacy {
+				t.Error("expected legacy flag to be cleared by save")
+			}
+
+			restored := sessions.NewSession(store, "blah")
+			if err := store.load(ctx, "blah", "abc", restored); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if stateOf(restored).legacy {
+				t.Error("expected item to be rewritten in the current format")
+			}
+			if v := restored.Values["hello"]; v != "world" {
+				t.Errorf("expected world; got %v", v)
+			}
+		})
+	}
+}
+
+func TestDisableLegacyFallback(t *testing.T) {
+	db := &dynastoretest.DB{}
+	db.SetItem(legacyItem(t, "abc", map[interface{}]interface{}{"hello": "world"}))
+
+	store, err := New(DynamoDB(db), JSON(), DisableLegacyFallback())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	if err := store.load(context.Background(), "blah", "abc", session); err != ErrMalformedSession {
+		t.Errorf("expected ErrMalformedSession; got %v", err)
+	}
+}
+
+func TestLegacyGob(t *testing.T) {
+	db := &dynastoretest.DB{}
+	db.SetItem(legacyItem(t, "abc", map[interface{}]interface{}{"hello": "world"}))
+
+	store, err := New(DynamoDB(db), Compression(0))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	if err := store.load(context.Background(), "blah", "abc", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := session.Values["hello"]; v != "world" {
+		t.Errorf("expected world; got %v", v)
+	}
+}
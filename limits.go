@@ -0,0 +1,72 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"fmt"
+
+	"github.com/gorilla/sessions"
+)
+
+// ErrTooManyValues is returned by Save when the session holds more values than
+// permitted; see MaxValues
+type ErrTooManyValues struct {
+	// Count holds the number of values in the session
+	Count int
+	// Limit holds the maximum number of values
+	Limit int
+}
+
+func (e ErrTooManyValues) Error() string {
+	return fmt.Sprintf("session holds %v values; limit is %v", e.Count, e.Limit)
+}
+
+// ErrReservedKey is returned by Save when the session holds a value under a key
+// designated by ReservedKeys
+type ErrReservedKey struct {
+	// Key holds the offending key
+	Key string
+}
+
+func (e ErrReservedKey) Error() string {
+	return fmt.Sprintf("session value key is reserved, %v", e.Key)
+}
+
+// checkValues enforces MaxValues and ReservedKeys.  Values managed by dynastore
+// itself are not counted.
+func (store *Store) checkValues(session *sessions.Session) error {
+	if store.maxValues <= 0 && len(store.reservedKeys) == 0 {
+		return nil
+	}
+
+	count := 0
+	for k := range session.Values {
+		key, ok := k.(string)
+		if ok && isReservedKey(key) {
+			continue
+		}
+		if _, reserved := store.reservedKeys[key]; ok && reserved {
+			store.printf("dynastore: session value key is reserved, %v\n", key)
+			return ErrReservedKey{Key: key}
+		}
+		count++
+	}
+
+	if store.maxValues > 0 && count > store.maxValues {
+		store.printf("dynastore: session holds %v values; limit is %v\n", count, store.maxValues)
+		return ErrTooManyValues{Count: count, Limit: store.maxValues}
+	}
+	return nil
+}
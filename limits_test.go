@@ -0,0 +1,131 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestMaxValues(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), MaxValues(3), WithVersioning())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	for i := 0; i < 3; i++ {
+		session.Values[strconv.Itoa(i)] = i
+	}
+	stateOf(session) // bookkeeping does not count towards the limit
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session.Values["3"] = 3
+	err = store.save(ctx, "blah", session)
+	var tooMany ErrTooManyValues
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("expected ErrTooManyValues; got %v", err)
+	}
+	if tooMany.Count != 4 || tooMany.Limit != 3 {
+		t.Errorf("expected 4 of 3; got %v of %v", tooMany.Count, tooMany.Limit)
+	}
+}
+
+func TestReservedKeys(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), ReservedKeys("SessionHashKey"), ValueAttributes())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["SessionHashKey"] = "x"
+
+	var reserved ErrReservedKey
+	if err := store.save(ctx, "blah", session); !errors.As(err, &reserved) || reserved.Key != "SessionHashKey" {
+		t.Fatalf("expected ErrReservedKey; got %v", err)
+	}
+
+	delete(session.Values, "SessionHashKey")
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session.IsNew = false
+	session.Values["SessionHashKey"] = "x"
+	if err := store.SaveValues(ctx, session, "SessionHashKey"); !errors.As(err, &reserved) {
+		t.Errorf("expected ErrReservedKey; got %v", err)
+	}
+}
+
+func TestLoadValuesExcludeInternalKeys(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), WithVersioning(), SlidingExpiration(), MaxAge(60))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["hello"] = "world"
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	restored, err := store.New(req, "blah")
+	if err != nil || restored.IsNew {
+		t.Fatalf("expected the session to load; got %v", err)
+	}
+	if v := len(restored.Values); v != 1 || restored.Values["hello"] != "world" {
+		t.Errorf("expected only application values; got %#v", restored.Values)
+	}
+	for k := range restored.Values {
+		if s, _ := k.(string); strings.HasPrefix(s, reservedKeyPrefix) {
+			t.Errorf("expected only application values; got %v", k)
+		}
+	}
+
+	// applications may encode the values themselves
+	if err := gob.NewEncoder(io.Discard).Encode(restored.Values); err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+
+	// the bookkeeping still applies when the session is saved again
+	if _, ok := lookupState(restored); !ok {
+		t.Error("expected the loaded session to be tracked")
+	}
+	if err := store.Save(req, httptest.NewRecorder(), restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+}
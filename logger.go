@@ -0,0 +1,41 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+)
+
+// debug emits a debug level entry to the Logger, if any.  The table name and the
+// abbreviated session id are included; session values never are.
+func (store *Store) debug(ctx context.Context, msg, id string, args ...interface{}) {
+	if store.logger == nil {
+		return
+	}
+	args = append([]interface{}{"table", store.tableName, "id", shortID(id)}, args...)
+	store.logger.DebugContext(ctx, msg, args...)
+}
+
+// logLoad records the outcome of loading the session with the given id
+func (store *Store) logLoad(ctx context.Context, id string, err error) {
+	switch err {
+	case nil:
+		store.debug(ctx, "dynastore: session loaded", id)
+	case ErrNotFound:
+		store.debug(ctx, "dynastore: session not found", id)
+	default:
+		store.debug(ctx, "dynastore: session load failed", id, "reason", err.Error())
+	}
+}
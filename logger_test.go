@@ -0,0 +1,91 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestLogger(t *testing.T) {
+	const secret = "hunter2-password"
+
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+	db := &dynastoretest.DB{}
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	store, err := New(DynamoDB(db), TableName("sessions"), Logger(logger))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abcdefghijklmnop"
+	session.Values["password"] = secret
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.load(ctx, "blah", session.ID, sessions.NewSession(store, "blah")); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.load(ctx, "blah", "missing", sessions.NewSession(store, "blah")); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound; got %v", err)
+	}
+	db.SetItem(map[string]types.AttributeValue{
+		DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "corrupt"},
+		valuesField:       &types.AttributeValueMemberS{Value: "!" + secret},
+	})
+	if err := store.load(ctx, "blah", "corrupt", sessions.NewSession(store, "blah")); err == nil {
+		t.Fatal("expected decode failure")
+	}
+	if err := store.delete(ctx, session.ID); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`msg="dynastore: session saved" table=sessions id=abcdefgh... bytes=`,
+		`msg="dynastore: session loaded" table=sessions id=abcdefgh...`,
+		`msg="dynastore: session not found" table=sessions id=missing`,
+		`msg="dynastore: session load failed" table=sessions id=corrupt reason="failed to decode data"`,
+		`msg="dynastore: session deleted" table=sessions id=abcdefgh...`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %v; got %v", want, out)
+		}
+	}
+	if strings.Contains(out, secret) {
+		t.Errorf("expected session values never to be logged; got %v", out)
+	}
+	if strings.Contains(out, session.ID) {
+		t.Errorf("expected session ids to be abbreviated; got %v", out)
+	}
+
+	// entries are only emitted at debug level
+	buf.Reset()
+	logger = slog.New(slog.NewTextHandler(buf, nil))
+	store, _ = New(DynamoDB(db), Logger(logger))
+	store.load(ctx, "blah", "missing", sessions.NewSession(store, "blah"))
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be logged; got %v", buf.String())
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Package memstore provides a dynastore session store that keeps sessions in
+// memory, for handler tests that should not require DynamoDB.
+package memstore
+
+import (
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+// NewMemoryStore returns a session store holding sessions in memory.  It is a
+// dynastore.Store backed by a dynastoretest.DB so cookies, session ids, MaxAge
+// and serialization behave exactly as they do against DynamoDB; sessions past their
+// ttl are treated as absent as they would be once DynamoDB deleted them.  Options
+// are applied as by dynastore.New; any DynamoDB option is ignored.  If the options
+// are invalid, every request fails with the error, which Validate also returns.
+//
+//	store := memstore.NewMemoryStore(dynastore.MaxAge(3600))
+//	handler := NewHandler(store)
+func NewMemoryStore(opts ...dynastore.Option) sessions.Store {
+	db := &dynastoretest.DB{}
+	base, _ := dynastore.New(dynastore.DynamoDB(db)) // the default options are valid
+	store := base.WithOptions(append(opts, dynastore.DynamoDB(db))...)
+
+	// the options may name other key attributes, e.g. with PrimaryKey or CompositeKey
+	db.PrimaryKey, db.SortKey = store.PrimaryKey(), store.SortKey()
+	return store
+}
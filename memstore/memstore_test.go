@@ -0,0 +1,232 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package memstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore"
+)
+
+// mockDynamoDB is a minimal DynamoDB supporting the requests made by a store with
+// the default options; it is independent of dynastoretest so the two stores
+// compared by the conformance suite share none of their storage code
+type mockDynamoDB struct {
+	mutex      sync.Mutex
+	items      map[string]map[string]types.AttributeValue
+	primaryKey string
+	sortKey    string
+}
+
+func (m *mockDynamoDB) id(key map[string]types.AttributeValue) string {
+	id := key[m.primaryKey].(*types.AttributeValueMemberS).Value
+	if m.sortKey != "" {
+		id += "/" + key[m.sortKey].(*types.AttributeValueMemberS).Value
+	}
+	return id
+}
+
+func (m *mockDynamoDB) GetItem(_ context.Context, input *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return &dynamodb.GetItemOutput{Item: m.items[m.id(input.Key)]}, nil
+}
+
+func (m *mockDynamoDB) PutItem(_ context.Context, input *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.items == nil {
+		m.items = map[string]map[string]types.AttributeValue{}
+	}
+	m.items[m.id(input.Item)] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDB) DeleteItem(_ context.Context, input *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.items, m.id(input.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+var errUnsupported = errors.New("unsupported by mockDynamoDB")
+
+func (m *mockDynamoDB) UpdateItem(context.Context, *dynamodb.UpdateItemInput, ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return nil, errUnsupported
+}
+
+func (m *mockDynamoDB) Scan(context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return nil, errUnsupported
+}
+
+func (m *mockDynamoDB) BatchWriteItem(context.Context, *dynamodb.BatchWriteItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	return nil, errUnsupported
+}
+
+// conformance verifies the behavior every store must share
+func conformance(t *testing.T, newStore func(opts ...dynastore.Option) sessions.Store) {
+	// roundTrip saves session values with a new store and returns the session as
+	// loaded by a later request along with the cookie set by the save
+	roundTrip := func(t *testing.T, store sessions.Store, values map[interface{}]interface{}) (*sessions.Session, *http.Cookie) {
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		session, err := store.New(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if !session.IsNew || session.ID == "" {
+			t.Fatalf("expected a new session with an id; got %v %v", session.IsNew, session.ID)
+		}
+		for k, v := range values {
+			session.Values[k] = v
+		}
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("expected 1 cookie; got %v", len(cookies))
+		}
+
+		req = httptest.NewRequest("GET", "http://localhost/", nil)
+		req.AddCookie(cookies[0])
+		restored, err := store.New(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if restored.IsNew || restored.ID != session.ID {
+			t.Fatalf("expected session %v to load; got %v", session.ID, restored.ID)
+		}
+		return restored, cookies[0]
+	}
+
+	t.Run("values", func(t *testing.T) {
+		restored, _ := roundTrip(t, newStore(), map[interface{}]interface{}{"user": "joe", "n": 42})
+		if restored.Values["user"] != "joe" || restored.Values["n"] != 42 {
+			t.Errorf("expected values to round trip; got %v", restored.Values)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		restored, _ := roundTrip(t, newStore(dynastore.JSON()), map[interface{}]interface{}{"user": "joe"})
+		if restored.Values["user"] != "joe" {
+			t.Errorf("expected values to round trip; got %v", restored.Values)
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		restored, cookie := roundTrip(t, newStore(dynastore.Path("/app"), dynastore.MaxAge(60), dynastore.HTTPOnly()), nil)
+		if cookie.Path != "/app" || cookie.MaxAge != 60 || !cookie.HttpOnly {
+			t.Errorf("expected cookie options to be applied; got %v", cookie)
+		}
+		if restored.Options.Path != "/app" || restored.Options.MaxAge != 60 {
+			t.Errorf("expected session options to be applied; got %+v", restored.Options)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		store := newStore()
+		restored, cookie := roundTrip(t, store, map[interface{}]interface{}{"user": "joe"})
+
+		restored.Options.MaxAge = -1
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, restored); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+			t.Errorf("expected the cookie to be cleared; got %v", cookies)
+		}
+
+		req = httptest.NewRequest("GET", "http://localhost/", nil)
+		req.AddCookie(cookie)
+		session, err := store.New(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if !session.IsNew {
+			t.Error("expected deleted session not to load")
+		}
+	})
+
+	for label, opts := range map[string][]dynastore.Option{
+		"primary key":   {dynastore.PrimaryKey("pk")},
+		"composite key": {dynastore.CompositeKey("PK", "SK", "SESSION#{id}")},
+	} {
+		t.Run(label, func(t *testing.T) {
+			store := newStore(opts...)
+			_, alice := roundTrip(t, store, map[interface{}]interface{}{"user": "alice"})
+			_, bob := roundTrip(t, store, map[interface{}]interface{}{"user": "bob"})
+
+			for user, cookie := range map[string]*http.Cookie{"alice": alice, "bob": bob} {
+				req := httptest.NewRequest("GET", "http://localhost/", nil)
+				req.AddCookie(cookie)
+				session, err := store.New(req, "blah")
+				if err != nil || session.IsNew {
+					t.Fatalf("expected existing session; got %v", err)
+				}
+				if v := session.Values["user"]; v != user {
+					t.Errorf("expected %v; got %v", user, v)
+				}
+			}
+		})
+	}
+
+	t.Run("unknown cookie", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		req.AddCookie(&http.Cookie{Name: "blah", Value: "missing"})
+		session, err := newStore().New(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if !session.IsNew || session.ID == "missing" {
+			t.Errorf("expected a new session with a new id; got %v %v", session.IsNew, session.ID)
+		}
+	})
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		conformance(t, NewMemoryStore)
+	})
+
+	t.Run("dynamodb", func(t *testing.T) {
+		conformance(t, func(opts ...dynastore.Option) sessions.Store {
+			db := &mockDynamoDB{}
+			store, err := dynastore.New(append(opts, dynastore.DynamoDB(db))...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			db.primaryKey, db.sortKey = store.PrimaryKey(), store.SortKey()
+			return store
+		})
+	})
+}
+
+func TestNewMemoryStoreInvalid(t *testing.T) {
+	store := NewMemoryStore(dynastore.TableName(""))
+	if err := store.(*dynastore.Store).Validate(); !errors.Is(err, dynastore.ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+}
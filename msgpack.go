@@ -0,0 +1,229 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackSerializer stores session.Values as a msgpack encoded map in a Binary
+// attribute so services written in other languages can decode it compactly.  Only
+// string keys are supported.
+type msgpackSerializer struct {
+	primaryKey string
+}
+
+func (m *msgpackSerializer) marshal(name string, session *sessions.Session) (map[string]types.AttributeValue, error) {
+	values, err := msgpackMap(session.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := encodeMsgpack(values)
+	if err != nil {
+		return nil, err
+	}
+
+	av := map[string]types.AttributeValue{
+		keyName(m.primaryKey): &types.AttributeValueMemberS{Value: session.ID},
+		valuesField:           &types.AttributeValueMemberB{Value: data},
+	}
+
+	if session.Options != nil {
+		options, err := attributevalue.Marshal(session.Options)
+		if err != nil {
+			return nil, err
+		}
+		av[optionsField] = options
+	}
+
+	return av, nil
+}
+
+func (m *msgpackSerializer) unmarshal(name string, in map[string]types.AttributeValue, session *sessions.Session) error {
+	if len(in) == 0 {
+		return ErrNotFound
+	}
+
+	// id
+	id, ok := in[keyName(m.primaryKey)].(*types.AttributeValueMemberS)
+	if !ok {
+		return ErrMalformedSession
+	}
+
+	// payload
+
+	payload, ok := in[valuesField].(*types.AttributeValueMemberB)
+	if !ok {
+		return ErrMalformedSession
+	}
+
+	decoded, err := decodeMsgpack(payload.Value)
+	if err != nil {
+		return err
+	}
+	payloadValues, ok := decoded.(map[string]interface{})
+	if !ok && decoded != nil {
+		return ErrDecodeFailed
+	}
+
+	values := make(map[interface{}]interface{}, len(payloadValues))
+	for k, v := range payloadValues {
+		values[k] = restoreValue(k, v)
+	}
+
+	session.IsNew = false
+	session.ID = id.Value
+	session.Values = values
+
+	// options
+
+	av, ok := in[optionsField]
+	if ok {
+		options := &sessions.Options{}
+		err := attributevalue.Unmarshal(av, options)
+		if err != nil {
+			return err
+		}
+		session.Options = options
+	}
+
+	return nil
+}
+
+func (m *msgpackSerializer) marshalValue(name string, value interface{}) (types.AttributeValue, error) {
+	value, err := msgpackValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := encodeMsgpack(value)
+	if err != nil {
+		return nil, err
+	}
+	return &types.AttributeValueMemberB{Value: data}, nil
+}
+
+func (m *msgpackSerializer) unmarshalValue(name string, av types.AttributeValue) (interface{}, error) {
+	encoded, ok := av.(*types.AttributeValueMemberB)
+	if !ok {
+		return nil, ErrMalformedSession
+	}
+	return decodeMsgpack(encoded.Value)
+}
+
+func encodeMsgpack(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buf)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEncodeFailed, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeMsgpack decodes data into plain Go values.  Integers are returned as int
+// when they fit and floats as float64.
+func decodeMsgpack(data []byte) (interface{}, error) {
+	v, err := msgpack.NewDecoder(bytes.NewReader(data)).DecodeInterface()
+	if err != nil {
+		return nil, ErrDecodeFailed
+	}
+	return normalizeMsgpack(v), nil
+}
+
+// msgpackMap converts values to a map with string keys, failing on other key types
+func msgpackMap(values map[interface{}]interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: msgpack requires string keys; got %T key %v", ErrEncodeFailed, k, k)
+		}
+
+		value, err := msgpackValue(v)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// msgpackValue converts nested maps keyed by interface{} to maps keyed by string
+func msgpackValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		return msgpackMap(v)
+	case []interface{}:
+		l := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			value, err := msgpackValue(item)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, value)
+		}
+		return l, nil
+	default:
+		return v, nil
+	}
+}
+
+// normalizeMsgpack converts the sized integers produced by decoding to int where
+// they fit and float32 to float64
+func normalizeMsgpack(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		if v >= math.MinInt && v <= math.MaxInt {
+			return int(v)
+		}
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	case uint64:
+		if v <= math.MaxInt {
+			return int(v)
+		}
+	case float32:
+		return float64(v)
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeMsgpack(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeMsgpack(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestMsgpackSerializer(t *testing.T) {
+	s := &msgpackSerializer{}
+
+	session := &sessions.Session{
+		ID: "abc",
+		Values: map[interface{}]interface{}{
+			"hello": "world",
+			"int":   42,
+			"big":   1 << 40,
+			"neg":   -7,
+			"float": 3.25,
+			"bool":  true,
+			"null":  nil,
+			"bytes": []byte("raw"),
+			"nested": map[string]interface{}{
+				"tags":  []interface{}{"a", 1, 2.5, nil},
+				"inner": map[string]interface{}{"ok": false},
+			},
+		},
+		Options: &sessions.Options{MaxAge: 60},
+	}
+
+	av, err := s.marshal("blah", session)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, ok := av[valuesField].(*types.AttributeValueMemberB); !ok {
+		t.Fatalf("expected values to be stored as binary; got %T", av[valuesField])
+	}
+
+	restored := &sessions.Session{}
+	if err := s.unmarshal("blah", av, restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if !reflect.DeepEqual(session.Values, restored.Values) {
+		t.Errorf("expected %#v; got %#v", session.Values, restored.Values)
+	}
+	if restored.ID != "abc" || restored.Options.MaxAge != 60 {
+		t.Errorf("expected id and options to be restored; got %v %v", restored.ID, restored.Options)
+	}
+
+	// nested maps keyed by interface{} are coerced to string keys
+	session.Values = map[interface{}]interface{}{
+		"nested": map[interface{}]interface{}{"a": 1},
+	}
+	av, err = s.marshal("blah", session)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := s.unmarshal("blah", av, restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := restored.Values["nested"]; !reflect.DeepEqual(v, map[string]interface{}{"a": 1}) {
+		t.Errorf("expected nested map with string keys; got %#v", v)
+	}
+
+	// other key types are rejected
+	session.Values = map[interface{}]interface{}{42: "answer"}
+	if _, err := s.marshal("blah", session); !errors.Is(err, ErrEncodeFailed) {
+		t.Errorf("expected ErrEncodeFailed; got %v", err)
+	}
+	session.Values = map[interface{}]interface{}{"nested": map[interface{}]interface{}{1.5: "x"}}
+	if _, err := s.marshal("blah", session); !errors.Is(err, ErrEncodeFailed) {
+		t.Errorf("expected ErrEncodeFailed; got %v", err)
+	}
+}
+
+func TestMsgpackSize(t *testing.T) {
+	session := &sessions.Session{
+		ID: "abc",
+		Values: map[interface{}]interface{}{
+			"user_id":  "7d9c2f0e-6b1a-4c3e-9f8d-2a5b7c1e4d60",
+			"email":    "joe@example.com",
+			"role":     "admin",
+			"login_at": 1700000000,
+			"mfa":      true,
+			"cart":     3,
+			"theme":    "dark",
+			"locale":   "en-US",
+		},
+	}
+
+	packed, err := (&msgpackSerializer{}).marshal("blah", session)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	gobbed, err := (&gobSerializer{}).marshal("blah", session)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if m, g := attributeSize(packed[valuesField]), attributeSize(gobbed[valuesField]); m >= g {
+		t.Errorf("expected msgpack to be smaller than gob; got %v and %v bytes", m, g)
+	}
+}
+
+func TestMsgpackOption(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), Msgpack())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, ok := store.serializer.(*msgpackSerializer); !ok {
+		t.Fatalf("expected msgpackSerializer; got %T", store.serializer)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["n"] = 1
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	restored := sessions.NewSession(store, "blah")
+	if err := store.load(context.Background(), "blah", "abc", restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v, ok := restored.Values["n"].(int); !ok || v != 1 {
+		t.Errorf("expected int 1; got %#v", restored.Values["n"])
+	}
+
+	if _, err := New(DynamoDB(db), Msgpack(), JSON()); !errors.Is(err, errSerializers) {
+		t.Errorf("expected errSerializers; got %v", err)
+	}
+}
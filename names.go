@@ -0,0 +1,146 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+// DefaultMaxSessionsPerRequest is the default number of distinct session names
+// that may be used within a single request
+const DefaultMaxSessionsPerRequest = 16
+
+var (
+	// ErrTooManySessionNames is returned by Get and New when a request uses more
+	// distinct session names than allowed by MaxSessionsPerRequest
+	ErrTooManySessionNames = errors.New("too many session names used in request")
+
+	// ErrInvalidSessionName is returned by Get and New when the session name is not
+	// a legal cookie name or is not permitted by AllowedNames
+	ErrInvalidSessionName = errors.New("invalid session name")
+
+	// ErrInvalidCookieOptions is returned by New and Save when the session options
+	// would produce a cookie browsers reject e.g. a __Host- cookie without Secure
+	ErrInvalidCookieOptions = errors.New("invalid cookie options")
+)
+
+type sessionNamesKey struct{}
+
+// sessionNames tracks the distinct session names used within a request
+type sessionNames struct {
+	mutex sync.Mutex
+	names map[string]struct{}
+}
+
+// add records name and returns the number of distinct names seen
+func (s *sessionNames) add(name string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.names[name] = struct{}{}
+	return len(s.names)
+}
+
+// getSessionNames returns the names tracked for req, attaching a new tracker to the
+// request if necessary in the same manner as sessions.GetRegistry
+func getSessionNames(req *http.Request) *sessionNames {
+	ctx := req.Context()
+	if v, ok := ctx.Value(sessionNamesKey{}).(*sessionNames); ok {
+		return v
+	}
+
+	names := &sessionNames{names: map[string]struct{}{}}
+	*req = *req.WithContext(context.WithValue(ctx, sessionNamesKey{}, names))
+	return names
+}
+
+// checkName verifies the session name may be used with req
+func (store *Store) checkName(req *http.Request, name string) error {
+	if !validCookieName(name) {
+		store.printf("dynastore: illegal session name, %q\n", name)
+		return ErrInvalidSessionName
+	}
+
+	if store.allowedNames != nil {
+		if _, ok := store.allowedNames[name]; !ok {
+			store.printf("dynastore: session name not allowed, %q\n", name)
+			return ErrInvalidSessionName
+		}
+	}
+
+	if store.maxSessionNames > 0 {
+		if n := getSessionNames(req).add(name); n > store.maxSessionNames {
+			store.printf("dynastore: too many session names in request, %v\n", n)
+			return ErrTooManySessionNames
+		}
+	}
+
+	return nil
+}
+
+// checkCookieOptions verifies browsers will accept the cookie name with opts.  Names
+// prefixed with __Secure- require Secure; names prefixed with __Host- additionally
+// require Path "/" and no Domain.  Partitioned cookies require Secure.
+func checkCookieOptions(name string, opts *sessions.Options) error {
+	if opts == nil {
+		opts = &sessions.Options{}
+	}
+
+	switch {
+	case strings.HasPrefix(name, "__Host-"):
+		if !opts.Secure {
+			return fmt.Errorf("%w: cookie %q requires Secure", ErrInvalidCookieOptions, name)
+		}
+		if opts.Path != "/" {
+			return fmt.Errorf("%w: cookie %q requires Path \"/\"; got %q", ErrInvalidCookieOptions, name, opts.Path)
+		}
+		if opts.Domain != "" {
+			return fmt.Errorf("%w: cookie %q must not set Domain; got %q", ErrInvalidCookieOptions, name, opts.Domain)
+		}
+	case strings.HasPrefix(name, "__Secure-"):
+		if !opts.Secure {
+			return fmt.Errorf("%w: cookie %q requires Secure", ErrInvalidCookieOptions, name)
+		}
+	}
+
+	if opts.Partitioned && !opts.Secure {
+		return fmt.Errorf("%w: partitioned cookie %q requires Secure", ErrInvalidCookieOptions, name)
+	}
+
+	return nil
+}
+
+// validCookieName returns true if name is a legal cookie name token per RFC 6265
+func validCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, c) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
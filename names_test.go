@@ -0,0 +1,170 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMaxSessionsPerRequest(t *testing.T) {
+	store, err := New(DynamoDB(newTestDynamoDB(nil)), MaxSessionsPerRequest(3))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	for i := 0; i < 3; i++ {
+		if _, err := store.Get(req, "name"+strconv.Itoa(i)); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+
+	// repeated names don't count against the limit
+	if _, err := store.New(req, "name0"); err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+
+	session, err := store.Get(req, "name3")
+	if err != ErrTooManySessionNames {
+		t.Errorf("expected ErrTooManySessionNames; got %v", err)
+	}
+	if session == nil {
+		t.Error("expected non-nil session")
+	}
+
+	// limit is scoped to the request
+	other, _ := http.NewRequest("GET", "http://localhost", nil)
+	if _, err := store.Get(other, "name3"); err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+}
+
+func TestAllowedNames(t *testing.T) {
+	store, err := New(DynamoDB(newTestDynamoDB(nil)), AllowedNames([]string{"auth"}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	if _, err := store.New(req, "auth"); err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+	if _, err := store.New(req, "workspace-123"); err != ErrInvalidSessionName {
+		t.Errorf("expected ErrInvalidSessionName; got %v", err)
+	}
+}
+
+func TestIllegalSessionName(t *testing.T) {
+	store, err := New(DynamoDB(newTestDynamoDB(nil)))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	for _, name := range []string{"", "a b", "a;b", "a=b", "a\x01b", "é"} {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		if _, err := store.New(req, name); err != ErrInvalidSessionName {
+			t.Errorf("%q: expected ErrInvalidSessionName; got %v", name, err)
+		}
+	}
+}
+
+func TestCookiePrefixes(t *testing.T) {
+	testCases := map[string]struct {
+		Name  string
+		Opts  []Option
+		Valid bool
+	}{
+		"host": {
+			Name:  "__Host-sid",
+			Opts:  []Option{Path("/"), Secure()},
+			Valid: true,
+		},
+		"host without secure": {
+			Name: "__Host-sid",
+			Opts: []Option{Path("/")},
+		},
+		"host with path": {
+			Name: "__Host-sid",
+			Opts: []Option{Path("/app"), Secure()},
+		},
+		"host with domain": {
+			Name: "__Host-sid",
+			Opts: []Option{Path("/"), Domain("example.com"), Secure()},
+		},
+		"secure": {
+			Name:  "__Secure-sid",
+			Opts:  []Option{Secure()},
+			Valid: true,
+		},
+		"secure without secure": {
+			Name: "__Secure-sid",
+		},
+		"partitioned without secure": {
+			Name: "sid",
+			Opts: []Option{Partitioned()},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store, err := New(append(tc.Opts, DynamoDB(newTestDynamoDB(nil)))...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			req, _ := http.NewRequest("GET", "http://localhost", nil)
+			session, err := store.New(req, tc.Name)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			err = store.Save(req, httptest.NewRecorder(), session)
+			if tc.Valid && err != nil {
+				t.Errorf("expected nil; got %v", err)
+			}
+			if !tc.Valid && !errors.Is(err, ErrInvalidCookieOptions) {
+				t.Errorf("expected ErrInvalidCookieOptions; got %v", err)
+			}
+
+			// allowed names are validated up front
+			_, err = New(append(tc.Opts, DynamoDB(newTestDynamoDB(nil)), AllowedNames([]string{tc.Name}))...)
+			if tc.Valid != (err == nil) {
+				t.Errorf("expected valid %v; got %v", tc.Valid, err)
+			}
+		})
+	}
+}
+
+func TestPartitioned(t *testing.T) {
+	store, err := New(DynamoDB(newTestDynamoDB(nil)), Partitioned(), Secure())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := w.Header().Get("Set-Cookie"); !strings.Contains(v, "; Partitioned") {
+		t.Errorf("expected Partitioned attribute; got %v", v)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+const namespaceSeparator = ":"
+
+// ValueBag provides a namespaced view over the Values of a session.  Keys
+// written through the bag are stored in session.Values as prefix + ":" + key
+// so independent components can share a single session without colliding.
+type ValueBag struct {
+	session *sessions.Session
+	prefix  string
+}
+
+// Namespace returns a ValueBag whose keys are scoped to the given prefix
+func Namespace(session *sessions.Session, prefix string) ValueBag {
+	return ValueBag{
+		session: session,
+		prefix:  prefix + namespaceSeparator,
+	}
+}
+
+// Get returns the value associated with key and whether it was present
+func (b ValueBag) Get(key string) (interface{}, bool) {
+	if b.session.Values == nil {
+		return nil, false
+	}
+	v, ok := b.session.Values[b.prefix+key]
+	return v, ok
+}
+
+// Set associates value with key within the namespace
+func (b ValueBag) Set(key string, value interface{}) {
+	if b.session.Values == nil {
+		b.session.Values = map[interface{}]interface{}{}
+	}
+	b.session.Values[b.prefix+key] = value
+}
+
+// Delete removes key from the namespace
+func (b ValueBag) Delete(key string) {
+	delete(b.session.Values, b.prefix+key)
+}
+
+// Keys returns the sorted, unprefixed keys held by the namespace
+func (b ValueBag) Keys() []string {
+	var keys []string
+	for k := range b.session.Values {
+		s, ok := k.(string)
+		if !ok || isReservedKey(s) || !strings.HasPrefix(s, b.prefix) {
+			continue
+		}
+		keys = append(keys, strings.TrimPrefix(s, b.prefix))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Clear removes every key in the namespace, leaving other namespaces untouched
+func (b ValueBag) Clear() {
+	for _, key := range b.Keys() {
+		b.Delete(key)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestNamespace(t *testing.T) {
+	name := "blah"
+	session := &sessions.Session{
+		ID: "abc",
+		Values: map[interface{}]interface{}{
+			"legacy": "value",
+		},
+	}
+
+	auth := Namespace(session, "auth")
+	auth.Set("user", "joe")
+	auth.Set("role", "admin")
+
+	ab := Namespace(session, "ab")
+	ab.Set("user", "variant-a")
+
+	// Save and Load -----------------------
+
+	s := &gobSerializer{}
+	av, err := s.marshal(name, session)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	restored := &sessions.Session{}
+	if err := s.unmarshal(name, av, restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	auth = Namespace(restored, "auth")
+	ab = Namespace(restored, "ab")
+
+	if v, _ := auth.Get("user"); v != "joe" {
+		t.Errorf("expected joe; got %v", v)
+	}
+	if v, _ := ab.Get("user"); v != "variant-a" {
+		t.Errorf("expected variant-a; got %v", v)
+	}
+	if v := restored.Values["legacy"]; v != "value" {
+		t.Errorf("expected legacy key to remain readable; got %v", v)
+	}
+	if got, want := auth.Keys(), []string{"role", "user"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v; got %v", want, got)
+	}
+
+	// Clear ------------------------------
+
+	auth.Clear()
+	if v := auth.Keys(); len(v) != 0 {
+		t.Errorf("expected empty namespace; got %v", v)
+	}
+	if v, ok := ab.Get("user"); !ok || v != "variant-a" {
+		t.Errorf("expected Clear to leave other namespaces untouched; got %v", v)
+	}
+	if v := restored.Values["legacy"]; v != "value" {
+		t.Errorf("expected Clear to leave legacy keys untouched; got %v", v)
+	}
+}
+
+func TestNamespaceKeysSkipsReserved(t *testing.T) {
+	session := &sessions.Session{
+		Values: map[interface{}]interface{}{
+			reservedKeyPrefix + "ab:internal": "x",
+		},
+	}
+
+	if v := Namespace(session, reservedKeyPrefix+"ab").Keys(); len(v) != 0 {
+		t.Errorf("expected reserved keys to be excluded; got %v", v)
+	}
+}
@@ -17,55 +17,162 @@ package dynastore
 import (
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 )
 
-// Option provides options to creating a dynastore
+// Option provides options to creating a dynastore.  Options that are given invalid
+// values record an error wrapping ErrInvalidOption, which New returns, rather than
+// being applied.  Options are only applied by New and WithOptions; a Store must not
+// be modified once created as it is used concurrently by every request.
 type Option func(*Store)
 
-// Codecs uses the specified codecs to encrypt the cookie data
+// Codecs uses the specified codecs to encrypt the session data and to sign the
+// session id written to the cookie.  Cookies that fail verification are treated
+// as absent.
 func Codecs(codecs ...securecookie.Codec) Option {
 	return func(s *Store) {
-		s.codecs = codecs
+		s.codecs = append([]securecookie.Codec(nil), codecs...)
+	}
+}
+
+// MaxLength bounds the encoded size of session values in bytes, as MaxLength does
+// for other gorilla stores; 0 means unlimited.  The limit is applied to each codec
+// supporting it, replacing securecookie's default of 4096, and checked before the
+// session is written by the other serializers.
+func MaxLength(n int) Option {
+	return func(s *Store) {
+		s.maxLength = n
 	}
 }
 
 // AWSConfig allows the complete AWS configuration to be specified
-func AWSConfig(config *aws.Config) Option {
+func AWSConfig(cfg aws.Config) Option {
 	return func(s *Store) {
-		s.config = config
+		s.config = &cfg
 	}
 }
 
-// DynamoDB allows a pre-configured dynamodb client to be supplied
-func DynamoDB(ddb *dynamodb.DynamoDB) Option {
+// Endpoint directs requests to the given url rather than the regional AWS endpoint
+// e.g. http://localhost:8000 for DynamoDB Local.  It has no effect when a client is
+// supplied via DynamoDB.
+func Endpoint(url string) Option {
 	return func(s *Store) {
+		s.endpoint = url
+	}
+}
+
+// DynamoDB allows a pre-configured dynamodb client to be supplied.  Any DynamoDBAPI
+// implementation may be used e.g. the in-memory fake from dynastoretest.
+func DynamoDB(ddb DynamoDBAPI) Option {
+	return func(s *Store) {
+		if isNil(ddb) {
+			s.invalidOption(fmt.Errorf("%w: DynamoDB client must not be nil", ErrInvalidOption))
+			return
+		}
 		s.ddb = ddb
 	}
 }
 
+// ReadClient loads sessions using api, e.g. a DynamoDB Accelerator (DAX) client,
+// rather than the client given to DynamoDB.  GetItem, BatchGetItem and Query are
+// sent to api; writes, scans, transactions and table management are not.  DAX
+// passes strongly consistent reads through to DynamoDB, so combine ReadClient with
+// EventuallyConsistentReads to benefit from its cache.
+func ReadClient(api DynamoDBAPI) Option {
+	return func(s *Store) {
+		s.reads = api
+	}
+}
+
+// WriteClient sets the client used for writes, scans, transactions and table
+// management, and for loads unless ReadClient is set.  It is equivalent to DynamoDB.
+func WriteClient(api DynamoDBAPI) Option {
+	return DynamoDB(api)
+}
+
+// EventuallyConsistentReads loads sessions with eventually consistent reads,
+// halving their read capacity and allowing DAX to serve them from its cache.  A
+// request may then observe a session as it was before a save made moments
+// earlier, possibly by another instance.
+func EventuallyConsistentReads() Option {
+	return func(s *Store) {
+		s.eventualReads = true
+	}
+}
+
+// Clock replaces time.Now as the source of the current time, used to compute the
+// ttl attribute, cookie Expires and the expiry of values set with SetWithTTL
+func Clock(now func() time.Time) Option {
+	return func(s *Store) {
+		if now == nil {
+			s.invalidOption(fmt.Errorf("%w: clock must not be nil", ErrInvalidOption))
+			return
+		}
+		s.now = now
+	}
+}
+
 // TableName allows a custom table name to be specified
 func TableName(tableName string) Option {
 	return func(s *Store) {
+		if strings.TrimSpace(tableName) == "" {
+			s.invalidOption(fmt.Errorf("%w: table name must not be empty; got %q", ErrInvalidOption, tableName))
+			return
+		}
 		s.tableName = tableName
-		s.ttlField = "ttl"
+	}
+}
+
+// PrimaryKey sets the name of the table's hash key attribute; defaults to
+// DefaultPrimaryKey.  Changing the key of a table that already holds sessions
+// requires migrating the existing items.
+func PrimaryKey(name string) Option {
+	return func(s *Store) {
+		s.primaryKey = name
+	}
+}
+
+// CompositeKey configures a table whose key has both a hash key, pkAttr, and a
+// sort key, skAttr, as in a single-table design.  The hash key holds the session
+// id as with PrimaryKey; the sort key holds skValue with any {id} replaced by the
+// session id, e.g. "SESSION" or "SESSION#{id}".  DeleteExpired only removes items
+// whose sort key matches skValue, or the part of it before {id}.
+func CompositeKey(pkAttr, skAttr, skValue string) Option {
+	return func(s *Store) {
+		if skAttr == "" || skValue == "" {
+			s.invalidOption(fmt.Errorf("%w: sort key and value must not be empty", ErrInvalidOption))
+			return
+		}
+		s.primaryKey = pkAttr
+		s.sortKey = skAttr
+		s.sortValue = skValue
 	}
 }
 
 // SessionOptions allows the default session options to be specified in a single command
 func SessionOptions(options sessions.Options) Option {
 	return func(s *Store) {
+		if s.invalidOption(checkPath(options.Path), checkMaxAge(options.MaxAge)) {
+			return
+		}
 		s.options = options
 	}
 }
 
-// Path sets the default session option of the same name
+// Path sets the default session option of the same name; v must be empty or begin
+// with a slash
 func Path(v string) Option {
 	return func(s *Store) {
+		if s.invalidOption(checkPath(v)) {
+			return
+		}
 		s.options.Path = v
 	}
 }
@@ -77,6 +184,44 @@ func Domain(v string) Option {
 	}
 }
 
+// DomainResolver computes the cookie Domain from the request's Host (port removed).
+// When fn returns false, the Domain option is used instead.  Public suffixes such
+// as com are never used as a cookie domain.  See RegistrableDomain.
+func DomainResolver(fn func(host string) (domain string, ok bool)) Option {
+	return func(s *Store) {
+		s.domainResolver = fn
+	}
+}
+
+// CookiePolicy calls fn with the options of each session when it is created or
+// loaded by New and again before Save writes its cookie, so Domain, Secure,
+// SameSite and the like can be chosen per request.  See
+// AutoSecureFromForwardedProto.
+func CookiePolicy(fn CookiePolicyFunc) Option {
+	return func(s *Store) {
+		s.cookiePolicy = fn
+	}
+}
+
+// ActivityLog records the time, path and client IP of the last n requests that
+// saved the session.  Entries are stored within the session payload and can be
+// read with Activity.  Use SkipActivity to exclude individual requests.
+func ActivityLog(n int) Option {
+	return func(s *Store) {
+		s.activityLimit = n
+	}
+}
+
+// Logger emits debug level entries to l for session loads, including misses and
+// decode failures with their reason, saves with the item size, and deletes.
+// Entries name the table and an abbreviated session id but never session values.
+// Nothing is logged by default.
+func Logger(l *slog.Logger) Option {
+	return func(s *Store) {
+		s.logger = l
+	}
+}
+
 // Output
 func Output(w io.Writer) Option {
 	return func(s *Store) {
@@ -86,9 +231,13 @@ func Output(w io.Writer) Option {
 	}
 }
 
-// MaxAge sets the default session option of the same name
+// MaxAge sets the default session option of the same name and, when positive, the
+// maximum age accepted by the codecs as Store.MaxAge does
 func MaxAge(v int) Option {
 	return func(s *Store) {
+		if s.invalidOption(checkMaxAge(v)) {
+			return
+		}
 		s.options.MaxAge = v
 	}
 }
@@ -107,9 +256,513 @@ func HTTPOnly() Option {
 	}
 }
 
+// SameSite sets the default session option of the same name.  Browsers reject
+// SameSite=None cookies that are not also Secure.
+func SameSite(v http.SameSite) Option {
+	return func(s *Store) {
+		s.options.SameSite = v
+	}
+}
+
+// Partitioned sets the default session option of the same name, marking cookies
+// for partitioned storage (CHIPS).  Partitioned cookies must also be Secure.
+func Partitioned() Option {
+	return func(s *Store) {
+		s.options.Partitioned = true
+	}
+}
+
 // TTLField sets the field used to store the ttl value
 func TTLField(ttlField string) Option {
 	return func(s *Store) {
 		s.ttlField = ttlField
 	}
 }
+
+// QuarantineCorrupt marks items that fail to decode as quarantined and rewrites
+// their ttl to now+ttl so DynamoDB reaps them soon.  Quarantined items are
+// subsequently treated as not found without attempting to decode them.  Items are
+// quarantined in the background, at most QuarantineLimit per minute, and each is
+// reported to Hooks as an OpQuarantine operation.  The CLI's -quarantine-report
+// lists the quarantined items by format.
+func QuarantineCorrupt(ttl time.Duration) Option {
+	return func(s *Store) {
+		s.quarantineTTL = ttl
+	}
+}
+
+// QuarantineLimit caps the number of items QuarantineCorrupt quarantines per
+// minute so a systemic decoding bug cannot rewrite every session.  Undecodable
+// items beyond the limit are left in place.  Defaults to DefaultQuarantineLimit.
+func QuarantineLimit(n int) Option {
+	return func(s *Store) {
+		if n < 1 {
+			s.invalidOption(fmt.Errorf("%w: quarantine limit must be at least 1, got %v", ErrInvalidOption, n))
+			return
+		}
+		s.quarantineLimit = n
+	}
+}
+
+// MaxSessionsPerRequest limits the number of distinct session names that may be
+// used within a single request.  Beyond the limit, Get and New return
+// ErrTooManySessionNames.  Defaults to DefaultMaxSessionsPerRequest; 0 disables
+// the limit.
+func MaxSessionsPerRequest(n int) Option {
+	return func(s *Store) {
+		s.maxSessionNames = n
+	}
+}
+
+// AllowedNames restricts the session names that may be used with the store.  Get
+// and New return ErrInvalidSessionName for any other name.
+func AllowedNames(names []string) Option {
+	return func(s *Store) {
+		s.allowedNames = map[string]struct{}{}
+		for _, name := range names {
+			s.allowedNames[name] = struct{}{}
+		}
+	}
+}
+
+// TouchConcurrency sets the number of concurrent UpdateItem calls made by TouchBatch.
+// Defaults to DefaultTouchConcurrency.
+func TouchConcurrency(n int) Option {
+	return func(s *Store) {
+		s.touchConcurrency = n
+	}
+}
+
+// TouchRate limits TouchBatch to at most n UpdateItem calls per second.  By default
+// the rate is unlimited.
+func TouchRate(n int) Option {
+	return func(s *Store) {
+		s.touchRate = n
+	}
+}
+
+// TouchDedupWindow causes TouchBatch to skip ids this store touched within the last d
+func TouchDedupWindow(d time.Duration) Option {
+	return func(s *Store) {
+		s.touchWindow = d
+	}
+}
+
+// PrincipalKey designates the session value identifying who the session belongs to.
+// The value is additionally written as a top-level attribute so Store.Principal can
+// read it without decoding the session.
+func PrincipalKey(key string) Option {
+	return func(s *Store) {
+		s.principalKey = key
+	}
+}
+
+// GSI indexes sessions by the session value named attributeName, e.g. "user_id".
+// The value is written as a top-level attribute of the same name so the global
+// secondary index, indexName, can serve QueryByAttribute and DeleteByAttribute.
+// CreateTableIfNotExists creates the index along with the table.
+func GSI(indexName, attributeName string) Option {
+	return func(s *Store) {
+		s.gsiIndex = indexName
+		s.gsiAttribute = attributeName
+	}
+}
+
+// WithVersioning enables optimistic locking.  Each item carries a version that is
+// checked and incremented by Save; when the item was modified by another writer
+// since the session was loaded, Save returns ErrVersionConflict and the caller
+// should reload and retry.
+func WithVersioning() Option {
+	return func(s *Store) {
+		s.versioning = true
+	}
+}
+
+// MaxValues limits the number of values a session may hold; Save returns
+// ErrTooManyValues once session.Values exceeds n
+func MaxValues(n int) Option {
+	return func(s *Store) {
+		s.maxValues = n
+	}
+}
+
+// ReservedKeys designates session value keys the application considers internal;
+// Save returns ErrReservedKey when session.Values holds any of them
+func ReservedKeys(keys ...string) Option {
+	return func(s *Store) {
+		if s.reservedKeys == nil {
+			s.reservedKeys = map[string]struct{}{}
+		}
+		for _, key := range keys {
+			s.reservedKeys[key] = struct{}{}
+		}
+	}
+}
+
+// SharedItem stores every session of a request, whatever its name, as a separate
+// attribute of one item so a request using several session names reads and writes
+// a single item.  One cookie, SharedCookieName, holds the item id for all of them.
+// Deleting a session removes only its attribute; the item and cookie are deleted
+// with the last session.  SharedItem cannot be combined with ValueAttributes,
+// WithVersioning, SlidingExpiration, IdleTimeout, GSI, FallbackToUnprefixed,
+// TrackCreation, Transact or Regenerate.
+func SharedItem() Option {
+	return func(s *Store) {
+		s.sharedItem = true
+	}
+}
+
+// AlwaysSetCookie causes Save to send the session cookie on every save rather than
+// only for new sessions or when the session options have changed since load.
+func AlwaysSetCookie() Option {
+	return func(s *Store) {
+		s.alwaysSetCookie = true
+	}
+}
+
+// Encryption encrypts the session values attribute with provider before it is
+// written, in addition to any encryption DynamoDB applies at rest.  The id of the
+// key used is stored alongside so sessions written under a previous key remain
+// readable.  Encryption cannot be combined with JSON or ValueAttributes.
+func Encryption(provider EncryptionProvider) Option {
+	return func(s *Store) {
+		s.encryption = provider
+	}
+}
+
+// DisableLegacyFallback prevents Load from falling back to the layout written by
+// the original dynastore when the configured serializer cannot decode an item.
+// Fresh deployments with no legacy items may use it to skip the second attempt.
+func DisableLegacyFallback() Option {
+	return func(s *Store) {
+		s.disableLegacy = true
+	}
+}
+
+// ValueAttributes stores each string keyed value in session.Values as its own
+// attribute rather than within a single encoded attribute.  This allows SaveValues
+// to update individual keys with UpdateItem.  Values with non-string keys remain in
+// the shared attribute.
+func ValueAttributes() Option {
+	return func(s *Store) {
+		s.valueAttributes = true
+	}
+}
+
+// WithRequestTimeout bounds each DynamoDB call made by Get, New and Save by d.  The
+// calls no longer inherit the cancellation of the request's context, so a Save
+// deferred until after the handler returns still completes.  The Ctx variants use
+// the context provided, bounded by d.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *Store) {
+		s.requestTimeout = d
+	}
+}
+
+// AllowUnsignedCookies accepts cookies holding a raw session id, as written before
+// Codecs were configured, to ease migration.  Such cookies are replaced with signed
+// ones the next time the session is saved.
+func AllowUnsignedCookies() Option {
+	return func(s *Store) {
+		s.unsignedCookies = true
+	}
+}
+
+// JSON stores session.Values as a native DynamoDB map rather than an encoded string
+// so services written in other languages can read individual values.  Keys must be
+// strings.  Values are restored as strings, numbers, bools, nil, maps and slices;
+// integral numbers are restored as int and others as float64.  JSON cannot be
+// combined with Codecs as the values would be stored unencrypted.
+func JSON() Option {
+	return func(s *Store) {
+		s.jsonValues = true
+	}
+}
+
+// Msgpack stores session.Values msgpack encoded in a Binary attribute, a compact
+// format services written in other languages can decode.  Keys must be strings,
+// including those of nested maps.  Values are restored as JSON restores them,
+// with []byte also supported.  Msgpack cannot be combined with JSON or Codecs.
+func Msgpack() Option {
+	return func(s *Store) {
+		s.msgpackValues = true
+	}
+}
+
+// RegisterTypes registers the concrete types of vals with encoding/gob so values
+// of those types may be stored in session.Values by the default gob encoding, as
+// well as by Codecs.  Registration is process wide.  time.Time, map[string]string
+// and json.RawMessage are registered by the package.
+func RegisterTypes(vals ...interface{}) Option {
+	return func(s *Store) {
+		for _, v := range vals {
+			s.invalidOption(registerType(v))
+		}
+	}
+}
+
+// Compression gzips the encoded session values at the given level, e.g.
+// gzip.BestSpeed, and stores them as a Binary attribute.  Sessions written without
+// compression continue to load.  Compression applies only to the default gob
+// encoding; values encrypted with Codecs or stored with JSON are not compressed.
+func Compression(level int) Option {
+	return func(s *Store) {
+		s.compress = true
+		s.compressionLevel = level
+	}
+}
+
+// MaxItemSize sets the largest session item, in bytes, Save will write; larger
+// sessions fail with ErrSessionTooLarge before any request is made.  Defaults to
+// DefaultMaxItemSize, the DynamoDB limit.
+func MaxItemSize(bytes int) Option {
+	return func(s *Store) {
+		s.maxItemSize = bytes
+	}
+}
+
+// WarnItemSize calls fn whenever a session larger than bytes is saved so growing
+// sessions can be found before they slow requests down or reach MaxItemSize.  The
+// save proceeds regardless.  A nil fn logs a warning to the Logger or, if none is
+// set, to Output.  Sizes of recent saves are summarized by Store.Stats.
+func WarnItemSize(bytes int, fn func(id string, size int)) Option {
+	return func(s *Store) {
+		if bytes <= 0 {
+			s.invalidOption(fmt.Errorf("%w: warn item size must be positive, got %v", ErrInvalidOption, bytes))
+			return
+		}
+		s.warnSize = bytes
+		s.onWarnSize = fn
+	}
+}
+
+// CreateTableTimeout sets how long CreateTableIfNotExists waits for the table to
+// become ACTIVE.  Defaults to DefaultCreateTableTimeout.
+func CreateTableTimeout(d time.Duration) Option {
+	return func(s *Store) {
+		s.createTableTimeout = d
+	}
+}
+
+// PromoteAttributes additionally writes the session values of the given keys as
+// top-level attributes of the item, e.g. so sessions can be queried by plan or
+// country in DynamoDB or a table export without decoding them.  Strings, numbers
+// and bools are written as the corresponding DynamoDB types; other values are not
+// promoted.  The session payload remains authoritative and the promoted copies are
+// ignored by Load.  Promoted values are neither encrypted nor signed.  Keys naming
+// attributes written by dynastore are rejected.
+func PromoteAttributes(keys ...string) Option {
+	return func(s *Store) {
+		for _, key := range keys {
+			if s.invalidOption(checkPromoted(key)) {
+				continue
+			}
+			s.promoted = append(s.promoted, key)
+		}
+	}
+}
+
+// IdleTimeout expires sessions that have not been saved or touched for d, whatever
+// their MaxAge.  Each save records the time in a lastAccess attribute and limits the
+// ttl accordingly; sessions saved without changes are refreshed with an UpdateItem
+// as with SlidingExpiration.  Load rejects sessions idle for longer than d even if
+// DynamoDB has yet to delete them.  IdleTimeout cannot be combined with SharedItem.
+func IdleTimeout(d time.Duration) Option {
+	return func(s *Store) {
+		if d < 0 {
+			s.invalidOption(fmt.Errorf("%w: idle timeout must not be negative, got %v", ErrInvalidOption, d))
+			return
+		}
+		s.idleTimeout = d
+	}
+}
+
+// AbsoluteTimeout expires sessions d after they were first saved however often
+// they are used.  The ttl is limited accordingly and Load rejects older sessions
+// even if DynamoDB has yet to delete them.  Sessions saved before createdAt was
+// recorded are not limited.
+func AbsoluteTimeout(d time.Duration) Option {
+	return func(s *Store) {
+		if d < 0 {
+			s.invalidOption(fmt.Errorf("%w: absolute timeout must not be negative, got %v", ErrInvalidOption, d))
+			return
+		}
+		s.absoluteTimeout = d
+	}
+}
+
+// SlidingExpiration extends the ttl of sessions saved without changes using an
+// UpdateItem of the ttl alone rather than rewriting the session.  The cookie is
+// reissued on each save so it expires with the ttl.  Combine with
+// TouchDedupWindow to skip the update for sessions extended within the window;
+// call Store.Close to stop the background pruning this requires.
+func SlidingExpiration() Option {
+	return func(s *Store) {
+		s.sliding = true
+	}
+}
+
+// IgnorePersistedOptions applies the store default options to every session
+// loaded rather than the options it was saved with, e.g. a longer MaxAge chosen
+// for "remember me".  Cookies of loaded sessions whose options differ are
+// reissued on Save.
+func IgnorePersistedOptions() Option {
+	return func(s *Store) {
+		s.ignoreOptions = true
+	}
+}
+
+// Tombstones makes deleting a session replace its item with a marker that expires
+// after grace rather than removing it.  Saving a session over its marker fails with
+// ErrSessionRevoked, so a request still in flight when the user logs out cannot
+// resurrect the session.  Tombstones requires a ttl field.
+func Tombstones(grace time.Duration) Option {
+	return func(s *Store) {
+		s.tombstoneGrace = grace
+	}
+}
+
+// FailOpen makes New return a new session without error when the existing session
+// cannot be read, e.g. because DynamoDB is throttling, as it would for a missing
+// session.  Users then appear logged out for the duration of an outage.
+func FailOpen() Option {
+	return func(s *Store) {
+		s.failOpen = true
+	}
+}
+
+// ReadOnly prevents the store from writing to DynamoDB so it may run with only
+// dynamodb:GetItem permission, plus BatchGetItem and Query for LoadMulti and
+// QueryByAttribute.  New loads sessions as usual while Save, Regenerate, SaveValues,
+// Touch, Transact and the delete operations return ErrReadOnlyStore.  Corrupt
+// items are not quarantined.
+func ReadOnly() Option {
+	return func(s *Store) {
+		s.readOnly = true
+	}
+}
+
+// WithRequestCache reuses the session loaded by an earlier call to New for the same
+// request, name and cookie rather than reading it again, as when several
+// middleware call New directly.  Each call returns its own copy of the session as
+// loaded.  The cache is held in the request's context and is invalidated when the
+// session is saved or deleted.
+func WithRequestCache() Option {
+	return func(s *Store) {
+		s.requestCache = true
+	}
+}
+
+// SkipUnchanged skips the write when a session is saved without changes to its
+// values or options since it was loaded, provided more than half of its MaxAge
+// remains before it expires.  Use ForceSave to write a session regardless.
+func SkipUnchanged() Option {
+	return func(s *Store) {
+		s.skipUnchanged = true
+	}
+}
+
+// KeyPrefix namespaces the items written by the store so several applications can
+// share a table.  The hash key holds prefix + "#" + id while session.ID and the
+// cookie hold the id alone.
+func KeyPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.keyPrefix = prefix
+	}
+}
+
+// KeyDeriver stores each session under fn(token), where token is the session.ID
+// carried by the cookie, rather than the token itself; see HMACKeyDeriver.  Sessions
+// found by a query rather than by token, e.g. QueryByAttribute, report the
+// derived id.
+func KeyDeriver(fn KeyDeriverFunc) Option {
+	return func(s *Store) {
+		s.keyDeriver = fn
+	}
+}
+
+// FallbackToUnprefixed loads sessions written before KeyPrefix was configured when
+// no prefixed item exists.  Such sessions are written back under the prefixed key
+// on Save, and Delete removes both items.
+func FallbackToUnprefixed() Option {
+	return func(s *Store) {
+		s.fallbackUnprefixed = true
+	}
+}
+
+// Retry retries GetItem, PutItem and DeleteItem requests rejected due to throttling
+// up to maxAttempts attempts in total.  The delay before each retry doubles from
+// base and is jittered.  Retries are in addition to those made by the AWS SDK.
+func Retry(maxAttempts int, base time.Duration) Option {
+	return func(s *Store) {
+		s.retryAttempts = maxAttempts
+		s.retryBase = base
+	}
+}
+
+// OnRetry registers fn to be called before each retry made due to Retry with the
+// number of the attempt that failed and its error
+func OnRetry(fn func(attempt int, err error)) Option {
+	return func(s *Store) {
+		s.onRetry = fn
+	}
+}
+
+// Instrumentation registers hooks notified of the operations and requests made by
+// the store e.g. to record metrics or traces
+func Instrumentation(hooks Hooks) Option {
+	return func(s *Store) {
+		s.hooks = hooks
+	}
+}
+
+// RequestInterceptor calls fn with the input of each GetItem, PutItem, UpdateItem
+// and DeleteItem request, including retries, just before it is sent so it may be
+// modified, e.g. to set ReturnValuesOnConditionCheckFailure.  Changes to the table,
+// key, item or expressions are at the caller's own risk.  Per-request client
+// options such as the region are set by wrapping the client passed to DynamoDB.
+func RequestInterceptor(fn RequestInterceptorFunc) Option {
+	return func(s *Store) {
+		s.interceptor = fn
+	}
+}
+
+// IDGenerator replaces DefaultIDGenerator as the source of new session ids.  Ids
+// must be unique, unguessable and legal in a cookie value; New returns
+// ErrInvalidSessionID otherwise.
+func IDGenerator(fn func() string) Option {
+	return func(s *Store) {
+		s.idGenerator = fn
+	}
+}
+
+// TrackCreation asks DynamoDB for the item replaced by each save so Hooks.OnSaved
+// can report whether the session was created or updated, e.g. for audit logging.
+// The createdAt attribute of a replaced item is kept even when the session was not
+// loaded before being saved, at the cost of an extra write in that case.
+// TrackCreation cannot be combined with SharedItem.
+func TrackCreation() Option {
+	return func(s *Store) {
+		s.trackCreation = true
+	}
+}
+
+// WithConsumedCapacity requests the capacity consumed by each request and gathers
+// it, along with operation counts and item sizes, into Store.Stats
+func WithConsumedCapacity() Option {
+	return func(s *Store) {
+		s.collectStats = true
+	}
+}
+
+// Parallelism sets the number of chunks PersistBatch writes concurrently.  The
+// default is 1.
+func Parallelism(n int) Option {
+	return func(s *Store) {
+		if n < 1 {
+			s.invalidOption(fmt.Errorf("%w: parallelism must be at least 1, got %v", ErrInvalidOption, n))
+			return
+		}
+		s.parallelism = n
+	}
+}
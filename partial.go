@@ -0,0 +1,366 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// valuePrefix prefixes the attributes holding individual values when
+// ValueAttributes is enabled
+const valuePrefix = valuesField + "."
+
+var (
+	// ErrPartialSession is returned when saving a session read by LoadPartial in
+	// full, which would discard the values that were not read
+	ErrPartialSession = errors.New("cannot save partially loaded session; use SaveValues")
+
+	errPartialUnsupported = errors.New("LoadPartial requires JSON or ValueAttributes")
+)
+
+// marshalValues serializes session with each string keyed value in its own attribute
+func (store *Store) marshalValues(name string, session *sessions.Session) (map[string]types.AttributeValue, error) {
+	shared := *session
+	shared.Values = map[interface{}]interface{}{}
+
+	attrs := map[string]types.AttributeValue{}
+	for k, v := range session.Values {
+		key, ok := k.(string)
+		if !ok {
+			shared.Values[k] = v
+			continue
+		}
+
+		av, err := store.serializer.marshalValue(name, v)
+		if err != nil {
+			return nil, err
+		}
+		attrs[valuePrefix+key] = av
+	}
+
+	av, err := store.serializer.marshal(name, &shared)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range attrs {
+		av[k] = v
+	}
+
+	return av, nil
+}
+
+// unmarshalValues merges the individually stored values in item into session
+func (store *Store) unmarshalValues(name string, item map[string]types.AttributeValue, session *sessions.Session) error {
+	for k, av := range item {
+		if !strings.HasPrefix(k, valuePrefix) {
+			continue
+		}
+
+		v, err := store.serializer.unmarshalValue(name, av)
+		if err != nil {
+			return err
+		}
+		key := strings.TrimPrefix(k, valuePrefix)
+		session.Values[key] = restoreValue(key, v)
+	}
+	return nil
+}
+
+// LoadPartial loads only the named keys of the session with the given id into
+// session, using a projection so DynamoDB reads, and charges for, just those
+// values.  Missing keys are absent from session.Values.  LoadPartial requires JSON
+// or ValueAttributes.
+//
+// A partially loaded session cannot be saved in full; Save returns
+// ErrPartialSession.  With ValueAttributes, SaveValues may write the loaded keys.
+func (store *Store) LoadPartial(ctx context.Context, id string, keys []string, session *sessions.Session) (err error) {
+	done := store.startOperation(OpLoad)
+	defer func() { done(err) }()
+
+	if store.sharedItem {
+		return errSharedItemUnsupported
+	}
+	if !store.valueAttributes && !store.jsonValues {
+		return errPartialUnsupported
+	}
+
+	names := map[string]string{
+		"#id":          store.primaryKey,
+		"#options":     optionsField,
+		"#version":     versionField,
+		"#quarantined": quarantinedField,
+		"#deleted":     deletedField,
+		"#schema":      schemaField,
+		"#values":      valuesField,
+	}
+	projection := []string{"#id", "#options", "#version", "#quarantined", "#deleted", "#schema"}
+	if store.ttlField != "" {
+		names["#ttl"] = store.ttlField
+		projection = append(projection, "#ttl")
+	}
+	if store.valueAttributes {
+		// values with non-string keys remain in the values attribute
+		projection = append(projection, "#values")
+	}
+	for i, key := range keys {
+		ref := "#k" + strconv.Itoa(i)
+		if store.valueAttributes {
+			names[ref] = valuePrefix + key
+			projection = append(projection, ref)
+		} else {
+			names[ref] = key
+			projection = append(projection, "#values."+ref)
+		}
+	}
+
+	input := &dynamodb.GetItemInput{
+		TableName:                aws.String(store.tableName),
+		ConsistentRead:           store.consistentRead(),
+		Key:                      store.key(id),
+		ProjectionExpression:     aws.String(strings.Join(projection, ", ")),
+		ExpressionAttributeNames: names,
+		ReturnConsumedCapacity:   store.returnConsumedCapacity(),
+	}
+
+	var out *dynamodb.GetItemOutput
+	err = store.withRetry(ctx, func() (err error) {
+		store.intercept(ctx, OpLoad, input)
+		out, err = store.reader().GetItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpLoad, out.ConsumedCapacity)
+		}
+		return err
+	})
+	if err != nil {
+		store.printf("dynastore: GetItem failed - %v\n", err)
+		return wrapError(OpLoad, id, err)
+	}
+
+	item := out.Item
+	if len(item) == 0 {
+		return ErrNotFound
+	}
+	if _, ok := item[quarantinedField]; ok {
+		return ErrNotFound
+	}
+	if _, ok := item[deletedField]; ok {
+		return ErrNotFound
+	}
+	if _, ok := item[valuesField]; !ok && store.jsonValues {
+		// none of the keys are present
+		item[valuesField] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+	}
+
+	if err := store.decode(ctx, session.Name(), item, session); err != nil {
+		return err
+	}
+
+	session.ID = id
+	session.IsNew = false
+	stateOf(session).partial = true
+	return nil
+}
+
+// SaveValues writes only the named keys of an existing session using UpdateItem
+// and refreshes its ttl as Save would.  Keys no longer present in session.Values,
+// or expired, are removed.  MaxItemSize is applied to the values written, as the
+// size of the rest of the item is unknown.  Cookies are not written; use Save for
+// new sessions.
+//
+// SaveValues requires ValueAttributes.  Without it, or for new sessions, the
+// entire session is saved instead.
+func (store *Store) SaveValues(ctx context.Context, session *sessions.Session, keys ...string) (err error) {
+	if st := stateOf(session); !store.valueAttributes || session.IsNew || st.unprefixed || st.legacy {
+		return store.save(ctx, session.Name(), session)
+	}
+
+	done := store.startOperation(OpSave)
+	defer func() { done(err) }()
+
+	if store.readOnly {
+		return ErrReadOnlyStore
+	}
+	removeExpired(session.Values, store.now())
+	if err := store.checkValues(session); err != nil {
+		return err
+	}
+
+	input, version, err := store.updateValues(session, keys)
+	if err != nil {
+		return err
+	}
+	if input == nil {
+		return nil
+	}
+
+	err = store.withRetry(ctx, func() error {
+		store.intercept(ctx, OpSave, input)
+		out, err := store.ddb.UpdateItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpSave, out.ConsumedCapacity)
+		}
+		return err
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			if store.revoked(ctx, session.ID) {
+				store.printf("dynastore: session revoked\n")
+				return ErrSessionRevoked
+			}
+			if store.versioning {
+				store.printf("dynastore: version conflict saving session\n")
+				return ErrVersionConflict
+			}
+			store.printf("dynastore: session not found\n")
+			return ErrNotFound
+		}
+		store.printf("dynastore: UpdateItem failed - %v\n", err)
+		return wrapError(OpSave, session.ID, err)
+	}
+
+	if store.versioning {
+		stateOf(session).version = version
+	}
+
+	return nil
+}
+
+// updateValues builds the UpdateItem request for SaveValues along with the version
+// the item will hold once written.  A nil input is returned when there is nothing
+// to write.
+func (store *Store) updateValues(session *sessions.Session, keys []string) (*dynamodb.UpdateItemInput, int64, error) {
+	var (
+		name    = session.Name()
+		now     = store.now()
+		sets    []string
+		removes []string
+		names   = map[string]string{"#id": store.primaryKey}
+		values  = map[string]types.AttributeValue{}
+		written = map[string]types.AttributeValue{}
+	)
+
+	for i, key := range keys {
+		ref := strconv.Itoa(i)
+		names["#v"+ref] = valuePrefix + key
+
+		v, ok := session.Values[key]
+		if !ok {
+			removes = append(removes, "#v"+ref)
+			continue
+		}
+
+		av, err := store.serializer.marshalValue(name, v)
+		if err != nil {
+			store.printf("dynastore: failed to marshal session - %v\n", err)
+			return nil, 0, err
+		}
+		sets = append(sets, "#v"+ref+" = :v"+ref)
+		values[":v"+ref] = av
+		written[valuePrefix+key] = av
+	}
+
+	if size := itemSize(written); store.maxItemSize > 0 && size > store.maxItemSize {
+		store.printf("dynastore: session values of %v bytes exceed limit of %v bytes\n", size, store.maxItemSize)
+		return nil, 0, ErrSessionTooLarge{Size: size, Limit: store.maxItemSize}
+	}
+
+	if expiresAt := store.expiresAt(session); !expiresAt.IsZero() {
+		sets = append(sets, "#ttl = :ttl")
+		names["#ttl"] = store.ttlField
+		values[":ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)}
+	}
+
+	sets = append(sets, "#updated = :updated")
+	names["#updated"] = updatedField
+	values[":updated"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)}
+	if store.idleTimeout > 0 {
+		sets = append(sets, "#lastAccess = :lastAccess")
+		names["#lastAccess"] = lastAccessField
+		values[":lastAccess"] = lastAccess(now)
+	}
+
+	if principal, ok := store.principal(session); ok {
+		sets = append(sets, "#principal = :principal")
+		names["#principal"] = principalField
+		values[":principal"] = &types.AttributeValueMemberS{Value: principal}
+	}
+
+	if store.gsiIndex != "" {
+		names["#attr"] = store.gsiAttribute
+		if value, ok := store.indexValue(session); ok {
+			sets = append(sets, "#attr = :attr")
+			values[":attr"] = &types.AttributeValueMemberS{Value: value}
+		} else {
+			removes = append(removes, "#attr")
+		}
+	}
+
+	for i, key := range store.promoted {
+		ref := "#p" + strconv.Itoa(i)
+		names[ref] = key
+		if av, ok := store.promotedAttribute(session, key); ok {
+			sets = append(sets, ref+" = :p"+strconv.Itoa(i))
+			values[":p"+strconv.Itoa(i)] = av
+		} else {
+			removes = append(removes, ref)
+		}
+	}
+
+	condition := "attribute_exists(#id)"
+	var version int64
+	if store.versioning {
+		st := stateOf(session)
+		version = st.version + 1
+		sets = append(sets, "#version = :version")
+		names["#version"] = versionField
+		values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)}
+		values[":expected"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(st.version, 10)}
+		condition = "attribute_exists(#id) AND attribute_not_exists(#version) OR #version = :expected"
+	}
+
+	var expr []string
+	if len(sets) > 0 {
+		expr = append(expr, "SET "+strings.Join(sets, ", "))
+	}
+	if len(removes) > 0 {
+		expr = append(expr, "REMOVE "+strings.Join(removes, ", "))
+	}
+	if len(expr) == 0 {
+		return nil, 0, nil
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(store.tableName),
+		Key:                       store.key(session.ID),
+		ConditionExpression:       aws.String(store.notRevoked(condition, names)),
+		UpdateExpression:          aws.String(strings.Join(expr, " ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnConsumedCapacity:    store.returnConsumedCapacity(),
+	}
+	if len(values) == 0 {
+		input.ExpressionAttributeValues = nil
+	}
+
+	return input, version, nil
+}
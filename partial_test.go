@@ -0,0 +1,329 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestSaveValuesExpression(t *testing.T) {
+	var input *dynamodb.UpdateItemInput
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		input = in.(*dynamodb.UpdateItemInput)
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), ValueAttributes())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return time.Unix(1000, 0) }
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["a"] = "hello"
+
+	if err := store.SaveValues(context.Background(), session, "a", "b"); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if input == nil {
+		t.Fatal("expected UpdateItem to be called")
+	}
+
+	if v := aws.ToString(input.UpdateExpression); v != "SET #v0 = :v0, #ttl = :ttl, #updated = :updated REMOVE #v1" {
+		t.Errorf("unexpected UpdateExpression; got %v", v)
+	}
+	if v := aws.ToString(input.ConditionExpression); v != "attribute_exists(#id)" {
+		t.Errorf("unexpected ConditionExpression; got %v", v)
+	}
+	if v := input.Key[DefaultPrimaryKey].(*types.AttributeValueMemberS).Value; v != "abc" {
+		t.Errorf("expected abc; got %v", v)
+	}
+
+	names := map[string]string{
+		"#id":      DefaultPrimaryKey,
+		"#v0":      "values.a",
+		"#v1":      "values.b",
+		"#ttl":     DefaultTTLField,
+		"#updated": updatedField,
+	}
+	if len(input.ExpressionAttributeNames) != len(names) {
+		t.Errorf("expected %v names; got %v", len(names), input.ExpressionAttributeNames)
+	}
+	for k, want := range names {
+		if got := input.ExpressionAttributeNames[k]; got != want {
+			t.Errorf("expected %v to be %v; got %v", k, want, got)
+		}
+	}
+
+	if len(input.ExpressionAttributeValues) != 3 {
+		t.Errorf("expected 3 values; got %v", input.ExpressionAttributeValues)
+	}
+	if v := input.ExpressionAttributeValues[":updated"].(*types.AttributeValueMemberN).Value; v != "1000" {
+		t.Errorf("expected 1000; got %v", v)
+	}
+	if v := input.ExpressionAttributeValues[":ttl"].(*types.AttributeValueMemberN).Value; v != "1060" {
+		t.Errorf("expected 1060; got %v", v)
+	}
+	if v, err := store.serializer.unmarshalValue("blah", input.ExpressionAttributeValues[":v0"]); err != nil || v != "hello" {
+		t.Errorf("expected hello; got %v, %v", v, err)
+	}
+}
+
+func TestSaveValuesTimeouts(t *testing.T) {
+	var input *dynamodb.UpdateItemInput
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		input = in.(*dynamodb.UpdateItemInput)
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), ValueAttributes(), IdleTimeout(time.Hour), AbsoluteTimeout(30*time.Second))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return time.Unix(1000, 0) }
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["a"] = "hello"
+	stateOf(session).createdAt = time.Unix(980, 0)
+
+	if err := store.SaveValues(context.Background(), session, "a"); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if input == nil {
+		t.Fatal("expected UpdateItem to be called")
+	}
+	if v := input.ExpressionAttributeValues[":ttl"].(*types.AttributeValueMemberN).Value; v != "1010" {
+		t.Errorf("expected 1010; got %v", v)
+	}
+	if v := input.ExpressionAttributeNames["#lastAccess"]; v != lastAccessField {
+		t.Errorf("expected %v; got %v", lastAccessField, v)
+	}
+	if _, ok := input.ExpressionAttributeValues[":lastAccess"]; !ok {
+		t.Errorf("expected :lastAccess to be set")
+	}
+}
+
+func TestSaveValuesLimits(t *testing.T) {
+	var calls int
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		calls++
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), ValueAttributes(), MaxItemSize(100))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return time.Unix(1000, 0) }
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["a"] = strings.Repeat("x", 200)
+	session.Values["b"] = expiringValue{Value: "stale", ExpiresAt: 900}
+
+	err = store.SaveValues(context.Background(), session, "a")
+	var tooLarge ErrSessionTooLarge
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected ErrSessionTooLarge; got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("expected 0 calls; got %v", calls)
+	}
+	if _, ok := session.Values["b"]; ok {
+		t.Errorf("expected expired value to be removed")
+	}
+}
+
+func TestSaveValues(t *testing.T) {
+	codec := securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+
+	testCases := map[string][]Option{
+		"gob":   {},
+		"codec": {Codecs(codec)},
+	}
+
+	for label, opts := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			store, err := New(append([]Option{DynamoDB(db), ValueAttributes()}, opts...)...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			ctx := context.Background()
+
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			session.IsNew = true
+			session.Options = &sessions.Options{MaxAge: 60}
+			session.Values["a"] = "1"
+			session.Values["b"] = "2"
+			session.Values[42] = "non-string key"
+
+			// new sessions are saved in full
+			if err := store.SaveValues(ctx, session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			session.IsNew = false
+
+			session.Values["a"] = "updated"
+			delete(session.Values, "b")
+			if err := store.SaveValues(ctx, session, "a", "b"); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			restored := sessions.NewSession(store, "blah")
+			if err := store.load(ctx, "blah", "abc", restored); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if v := restored.Values["a"]; v != "updated" {
+				t.Errorf("expected updated; got %v", v)
+			}
+			if _, ok := restored.Values["b"]; ok {
+				t.Error("expected b to be removed")
+			}
+			if v := restored.Values[42]; v != "non-string key" {
+				t.Errorf("expected non-string key to round trip; got %v", v)
+			}
+
+			// deleted sessions are not resurrected
+			if err := store.delete(ctx, "abc"); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if err := store.SaveValues(ctx, session, "a"); err != ErrNotFound {
+				t.Errorf("expected ErrNotFound; got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPartial(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := map[string]struct {
+		option     Option
+		projection string
+		names      map[string]string
+	}{
+		"json": {
+			option:     JSON(),
+			projection: "#id, #options, #version, #quarantined, #deleted, #schema, #ttl, #values.#k0, #values.#k1",
+			names:      map[string]string{"#k0": "user_id", "#k1": "roles"},
+		},
+		"value attributes": {
+			option:     ValueAttributes(),
+			projection: "#id, #options, #version, #quarantined, #deleted, #schema, #ttl, #values, #k0, #k1",
+			names:      map[string]string{"#k0": "values.user_id", "#k1": "values.roles"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			store, err := New(DynamoDB(db), tc.option)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			session.Values["user_id"] = "joe"
+			session.Values["profile"] = "large"
+			if err := store.save(ctx, "blah", session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			partial := sessions.NewSession(store, "blah")
+			if err := store.LoadPartial(ctx, "abc", []string{"user_id", "roles"}, partial); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if partial.ID != "abc" || partial.IsNew {
+				t.Errorf("expected loaded session abc; got %v", partial.ID)
+			}
+			if v := partial.Values["user_id"]; v != "joe" {
+				t.Errorf("expected joe; got %v", v)
+			}
+			if _, ok := partial.Values["profile"]; ok {
+				t.Error("expected profile not to be loaded")
+			}
+
+			requests := db.Requests()
+			input := requests[len(requests)-1].(*dynamodb.GetItemInput)
+			if v := aws.ToString(input.ProjectionExpression); v != tc.projection {
+				t.Errorf("expected %v; got %v", tc.projection, v)
+			}
+			for k, want := range tc.names {
+				if got := input.ExpressionAttributeNames[k]; got != want {
+					t.Errorf("expected %v to be %v; got %v", k, want, got)
+				}
+			}
+
+			partial.Values["user_id"] = "jane"
+			if err := store.save(ctx, "blah", partial); err != ErrPartialSession {
+				t.Errorf("expected ErrPartialSession; got %v", err)
+			}
+			if err := store.Save(httptest.NewRequest("GET", "http://localhost", nil), httptest.NewRecorder(), partial); err != ErrPartialSession {
+				t.Errorf("expected ErrPartialSession; got %v", err)
+			}
+
+			err = store.SaveValues(ctx, partial, "user_id")
+			if label == "json" {
+				if err != ErrPartialSession {
+					t.Errorf("expected ErrPartialSession; got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			loaded := sessions.NewSession(store, "blah")
+			if err := store.load(ctx, "blah", "abc", loaded); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if v := loaded.Values["user_id"]; v != "jane" {
+				t.Errorf("expected jane; got %v", v)
+			}
+			if v := loaded.Values["profile"]; v != "large" {
+				t.Errorf("expected unloaded values to be retained; got %v", v)
+			}
+		})
+	}
+}
+
+func TestLoadPartialUnsupported(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.LoadPartial(context.Background(), "abc", []string{"a"}, sessions.NewSession(store, "blah")); err != errPartialUnsupported {
+		t.Errorf("expected errPartialUnsupported; got %v", err)
+	}
+}
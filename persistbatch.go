@@ -0,0 +1,202 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// defaultBatchBackoff is the initial delay before retrying unprocessed items when
+// Retry is not set
+const defaultBatchBackoff = 50 * time.Millisecond
+
+// batchEntry pairs a session with its marshaled item
+type batchEntry struct {
+	session *sessions.Session
+	item    map[string]types.AttributeValue
+	version int64
+}
+
+// PersistBatch writes sessions using BatchWriteItem in chunks of 25, for bulk
+// imports and migrations, and returns the ids of the sessions that could not be
+// written.  Sessions that fail to marshal, chunks rejected outright and items
+// still unprocessed after retrying with jittered backoff are reported as failed
+// rather than aborting the batch.  Chunks are written concurrently per Parallelism.
+// The returned error is non-nil only when ctx is cancelled; ids not yet written are
+// then included in failed.
+//
+// BatchWriteItem does not support conditions, so versioning and Tombstones are
+// not enforced.  Where an id appears more than once, the last session is written.
+func (store *Store) PersistBatch(ctx context.Context, sessions []*sessions.Session) (failed []string, err error) {
+	if store.readOnly {
+		return nil, ErrReadOnlyStore
+	}
+	if store.sharedItem {
+		return nil, errSharedItemUnsupported
+	}
+
+	var (
+		entries []batchEntry
+		index   = map[string]int{}
+	)
+	for _, session := range sessions {
+		input, version, err := store.putInput(ctx, session.Name(), session)
+		if err != nil {
+			failed = append(failed, session.ID)
+			continue
+		}
+
+		entry := batchEntry{session: session, item: input.Item, version: version}
+		if i, ok := index[session.ID]; ok {
+			entries[i] = entry
+			continue
+		}
+		index[session.ID] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	parallelism := store.parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+		work  = make(chan []batchEntry)
+	)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range work {
+				unwritten := store.batchPut(ctx, chunk)
+
+				mutex.Lock()
+				failed = append(failed, unwritten...)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < len(entries); i += batchWriteSize {
+		end := i + batchWriteSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		select {
+		case work <- entries[i:end]:
+		case <-ctx.Done():
+			for _, entry := range entries[i:] {
+				failed = append(failed, entry.session.ID)
+			}
+			end = len(entries)
+		}
+		if end == len(entries) {
+			break
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	return failed, ctx.Err()
+}
+
+// batchPut writes a chunk of entries, retrying unprocessed items with jittered
+// exponential backoff, and returns the ids of the sessions left unwritten
+func (store *Store) batchPut(ctx context.Context, chunk []batchEntry) []string {
+	done := store.startOperation(OpSave)
+
+	pending := map[string]batchEntry{}
+	requests := make([]types.WriteRequest, 0, len(chunk))
+	for _, entry := range chunk {
+		pending[store.itemID(entry.session.ID)] = entry
+		requests = append(requests, types.WriteRequest{
+			PutRequest: &types.PutRequest{Item: entry.item},
+		})
+	}
+
+	backoff := store.retryBase
+	if backoff <= 0 {
+		backoff = defaultBatchBackoff
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var out *dynamodb.BatchWriteItemOutput
+		out, err = store.ddb.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				store.tableName: requests,
+			},
+			ReturnConsumedCapacity: store.returnConsumedCapacity(),
+		})
+		if err != nil {
+			store.printf("dynastore: BatchWriteItem failed - %v\n", err)
+			break
+		}
+		for i := range out.ConsumedCapacity {
+			store.consumedCapacity(OpSave, &out.ConsumedCapacity[i])
+		}
+
+		unprocessed := map[string]bool{}
+		requests = out.UnprocessedItems[store.tableName]
+		for _, req := range requests {
+			if req.PutRequest == nil {
+				continue
+			}
+			if id, ok := req.PutRequest.Item[store.primaryKey].(*types.AttributeValueMemberS); ok {
+				unprocessed[id.Value] = true
+			}
+		}
+		for id, entry := range pending {
+			if !unprocessed[id] {
+				store.saved(entry.session, entry.version)
+				delete(pending, id)
+			}
+		}
+
+		if len(requests) == 0 {
+			break
+		}
+		if attempt+1 >= maxBatchRetries {
+			store.printf("dynastore: %v items left unprocessed\n", len(requests))
+			err = errUnprocessedItems
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(jitter(backoff << uint(attempt))):
+		}
+		if err != nil {
+			break
+		}
+	}
+	done(err)
+
+	ids := make([]string, 0, len(pending))
+	for _, entry := range pending {
+		ids = append(ids, entry.session.ID)
+	}
+	return ids
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestPersistBatch(t *testing.T) {
+	ctx := context.Background()
+	db := &dynastoretest.DB{}
+
+	var (
+		mutex sync.Mutex
+		seen  = map[string]bool{}
+	)
+	db.Unprocessed = func(req types.WriteRequest) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		id := req.PutRequest.Item[DefaultPrimaryKey].(*types.AttributeValueMemberS).Value
+		switch id {
+		case "id-5":
+			return true
+		case "id-7":
+			if !seen[id] {
+				seen[id] = true
+				return true
+			}
+		}
+		return false
+	}
+	errBoom := errors.New("boom")
+	db.Err = func(input interface{}) error {
+		in, ok := input.(*dynamodb.BatchWriteItemInput)
+		if !ok {
+			return nil
+		}
+		for _, req := range in.RequestItems[DefaultTableName] {
+			if req.PutRequest.Item[DefaultPrimaryKey].(*types.AttributeValueMemberS).Value == "id-55" {
+				return errBoom
+			}
+		}
+		return nil
+	}
+
+	store, err := New(DynamoDB(db), Parallelism(3), Retry(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	var batch []*sessions.Session
+	for i := 0; i < 60; i++ {
+		session := sessions.NewSession(store, "blah")
+		session.ID = "id-" + strconv.Itoa(i)
+		session.Values["n"] = i
+		batch = append(batch, session)
+	}
+	invalid := sessions.NewSession(store, "blah")
+	invalid.ID = "invalid"
+	invalid.Values["fn"] = func() {}
+	batch = append(batch, invalid)
+
+	failed, err := store.PersistBatch(ctx, batch)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	want := []string{"id-5", "invalid"}
+	for i := 50; i < 60; i++ {
+		want = append(want, "id-"+strconv.Itoa(i))
+	}
+	sort.Strings(want)
+	sort.Strings(failed)
+	if got, expected := strings.Join(failed, ","), strings.Join(want, ","); got != expected {
+		t.Errorf("expected %v; got %v", expected, got)
+	}
+
+	if db.Item("id-7") == nil {
+		t.Errorf("expected id-7 to be written after retry")
+	}
+	if db.Item("id-5") != nil {
+		t.Errorf("expected id-5 not to be written")
+	}
+	if got, expected := db.Len(), 49; got != expected {
+		t.Errorf("expected %v; got %v", expected, got)
+	}
+	for _, req := range db.Requests() {
+		if in, ok := req.(*dynamodb.BatchWriteItemInput); ok {
+			if n := len(in.RequestItems[DefaultTableName]); n > batchWriteSize {
+				t.Errorf("expected at most %v writes per request; got %v", batchWriteSize, n)
+			}
+		}
+	}
+}
+
+func TestPersistBatchLoad(t *testing.T) {
+	ctx := context.Background()
+	db := &dynastoretest.DB{}
+
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["user"] = "joe"
+	if failed, err := store.PersistBatch(ctx, []*sessions.Session{session}); err != nil || len(failed) != 0 {
+		t.Fatalf("expected no failures; got %v, %v", failed, err)
+	}
+
+	loaded := sessions.NewSession(store, "blah")
+	loaded.ID = "abc"
+	if err := store.load(ctx, "blah", "abc", loaded); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := loaded.Values["user"]; v != "joe" {
+		t.Errorf("expected joe; got %v", v)
+	}
+}
+
+func TestPersistBatchReadOnly(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}), ReadOnly())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, err := store.PersistBatch(context.Background(), nil); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+}
+
+func TestParallelism(t *testing.T) {
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), Parallelism(0)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+}
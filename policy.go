@@ -0,0 +1,57 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// CookiePolicyFunc adjusts the options of a session for the request, e.g. to
+// choose Domain, Secure or SameSite per request; see CookiePolicy
+type CookiePolicyFunc func(req *http.Request, opts *sessions.Options)
+
+// AutoSecureFromForwardedProto returns a CookiePolicyFunc that marks cookies
+// Secure when the request arrived over TLS, either directly or at a load balancer
+// that terminated it and set X-Forwarded-Proto to https.  Only trust the header
+// when every request passes through such a proxy.
+func AutoSecureFromForwardedProto() CookiePolicyFunc {
+	return func(req *http.Request, opts *sessions.Options) {
+		opts.Secure = req.TLS != nil || forwardedProto(req) == "https"
+	}
+}
+
+// forwardedProto returns the protocol the client used as reported by the first
+// proxy, lower cased
+func forwardedProto(req *http.Request) string {
+	proto := req.Header.Get("X-Forwarded-Proto")
+	if i := strings.Index(proto, ","); i >= 0 {
+		proto = proto[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(proto))
+}
+
+// applyPolicy runs the CookiePolicy, if any, against the options of session
+func (store *Store) applyPolicy(req *http.Request, session *sessions.Session) {
+	if store.cookiePolicy == nil || req == nil {
+		return
+	}
+	if session.Options == nil {
+		session.Options = store.newOptions(req)
+	}
+	store.cookiePolicy(req, session.Options)
+}
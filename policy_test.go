@@ -0,0 +1,121 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestAutoSecureFromForwardedProto(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}), CookiePolicy(AutoSecureFromForwardedProto()))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	testCases := map[string]struct {
+		proto  string
+		tls    bool
+		secure bool
+	}{
+		"plain":         {},
+		"tls":           {tls: true, secure: true},
+		"https":         {proto: "https", secure: true},
+		"upper case":    {proto: "HTTPS", secure: true},
+		"http":          {proto: "http"},
+		"proxy chain":   {proto: "https, http", secure: true},
+		"downgraded":    {proto: "http, https"},
+		"tls overrides": {proto: "http", tls: true, secure: true},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			if tc.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			session, _ := store.New(req, "blah")
+			w := httptest.NewRecorder()
+			if err := store.Save(req, w, session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if v := strings.Contains(w.Header().Get("Set-Cookie"), "; Secure"); v != tc.secure {
+				t.Errorf("expected Secure %v; got %v", tc.secure, w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
+
+func TestCookiePolicy(t *testing.T) {
+	policy := func(req *http.Request, opts *sessions.Options) {
+		if strings.HasSuffix(req.Host, ".example.com") {
+			opts.Domain = "example.com"
+			opts.Secure = true
+			opts.SameSite = http.SameSiteNoneMode
+		}
+	}
+	store, err := New(DynamoDB(&dynastoretest.DB{}), CookiePolicy(policy))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// options are computed by New
+	req := httptest.NewRequest("GET", "http://app.example.com", nil)
+	session, _ := store.New(req, "blah")
+	if v := session.Options.Domain; v != "example.com" {
+		t.Errorf("expected example.com; got %v", v)
+	}
+
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := w.Header().Get("Set-Cookie"); !strings.Contains(v, "Domain=example.com") || !strings.Contains(v, "Secure; SameSite=None") {
+		t.Errorf("expected cross-subdomain cookie; got %v", v)
+	}
+
+	// and again by Save, after middleware may have changed them
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ = store.New(req, "blah")
+	req.Host = "sso.example.com"
+	w = httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := w.Header().Get("Set-Cookie"); !strings.Contains(v, "Domain=example.com") {
+		t.Errorf("expected policy to apply on Save; got %v", v)
+	}
+
+	// host-only cookies carry no Domain attribute
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ = store.New(req, "blah")
+	w = httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := w.Header().Get("Set-Cookie"); strings.Contains(v, "Domain=") {
+		t.Errorf("expected host-only cookie; got %v", v)
+	}
+}
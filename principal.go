@@ -0,0 +1,119 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// principalField holds a copy of the session value designated by PrincipalKey
+const principalField = "principal"
+
+// Principal returns the principal of the session with the given id along with its
+// expiry.  Only the principal and ttl attributes are read so no session payload is
+// decoded.  The returned time is zero if the session has no expiry.  Requires the
+// PrincipalKey option.
+func (store *Store) Principal(ctx context.Context, id string) (string, time.Time, error) {
+	names := map[string]string{
+		"#id":        store.primaryKey,
+		"#principal": principalField,
+	}
+	projection := "#id, #principal"
+	if store.ttlField != "" {
+		names["#ttl"] = store.ttlField
+		projection += ", #ttl"
+	}
+
+	input := &dynamodb.GetItemInput{
+		TableName:                aws.String(store.tableName),
+		ConsistentRead:           store.consistentRead(),
+		ProjectionExpression:     aws.String(projection),
+		ExpressionAttributeNames: names,
+		Key:                      store.key(id),
+	}
+	store.intercept(ctx, OpLoad, input)
+	out, err := store.reader().GetItem(ctx, input)
+	if err != nil {
+		store.printf("dynastore: GetItem failed - %v\n", err)
+		return "", time.Time{}, err
+	}
+
+	if len(out.Item) == 0 {
+		return "", time.Time{}, ErrNotFound
+	}
+
+	var expiresAt time.Time
+	if av, ok := out.Item[store.ttlField]; ok {
+		n, ok := av.(*types.AttributeValueMemberN)
+		if !ok {
+			return "", time.Time{}, ErrMalformedSession
+		}
+		ttl, err := strconv.ParseInt(n.Value, 10, 64)
+		if err != nil {
+			return "", time.Time{}, ErrMalformedSession
+		}
+		expiresAt = time.Unix(ttl, 0)
+		if ttl > 0 && expiresAt.Before(store.now()) {
+			return "", time.Time{}, ErrNotFound
+		}
+	}
+
+	var principal string
+	if av, ok := out.Item[principalField].(*types.AttributeValueMemberS); ok {
+		principal = av.Value
+	}
+
+	return principal, expiresAt, nil
+}
+
+// principal returns the string form of the session value designated by PrincipalKey
+func (store *Store) principal(session *sessions.Session) (string, bool) {
+	if store.principalKey == "" {
+		return "", false
+	}
+
+	v, ok := session.Values[store.principalKey]
+	if !ok || v == nil {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, s != ""
+	}
+	return fmt.Sprint(v), true
+}
+
+// checkPrincipal logs when the stored principal attribute disagrees with the loaded session values
+func (store *Store) checkPrincipal(item map[string]types.AttributeValue, session *sessions.Session) {
+	if store.principalKey == "" {
+		return
+	}
+
+	var stored string
+	if av, ok := item[principalField].(*types.AttributeValueMemberS); ok {
+		stored = av.Value
+	}
+
+	if current, _ := store.principal(session); current != stored {
+		store.printf("dynastore: principal attribute does not match session values\n")
+	}
+}
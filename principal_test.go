@@ -0,0 +1,130 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func newPrincipalStore(t testing.TB, opts ...Option) (*Store, *dynastoretest.DB) {
+	db := &dynastoretest.DB{}
+	store, err := New(append([]Option{DynamoDB(db), PrincipalKey("user_id")}, opts...)...)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	return store, db
+}
+
+func TestPrincipal(t *testing.T) {
+	buf := &bytes.Buffer{}
+	store, db := newPrincipalStore(t, Output(buf))
+	ctx := context.Background()
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["user_id"] = "joe"
+
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	principal, expiresAt, err := store.Principal(ctx, "abc")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if principal != "joe" {
+		t.Errorf("expected joe; got %v", principal)
+	}
+	if expiresAt.IsZero() {
+		t.Error("expected expiry to be set")
+	}
+
+	// principal follows changes to Values
+	session.Values["user_id"] = "bob"
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if principal, _, _ := store.Principal(ctx, "abc"); principal != "bob" {
+		t.Errorf("expected bob; got %v", principal)
+	}
+
+	// mismatches are reported on load
+	item := db.Item("abc")
+	item[principalField] = &types.AttributeValueMemberS{Value: "mallory"}
+	db.SetItem(item)
+	if err := store.load(ctx, "blah", "abc", sessions.NewSession(store, "blah")); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if !strings.Contains(buf.String(), "principal attribute does not match") {
+		t.Errorf("expected mismatch to be logged; got %q", buf.String())
+	}
+
+	if _, _, err := store.Principal(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+
+	store.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, _, err := store.Principal(ctx, "abc"); err != ErrNotFound {
+		t.Errorf("expected expired session to be ErrNotFound; got %v", err)
+	}
+}
+
+func newLargeSession(b *testing.B, store *Store) {
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["user_id"] = "joe"
+	for i := 0; i < 500; i++ {
+		session.Values["key-"+strconv.Itoa(i)] = strings.Repeat("x", 100)
+	}
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		b.Fatalf("expected nil; got %v", err)
+	}
+}
+
+func BenchmarkPrincipal(b *testing.B) {
+	store, _ := newPrincipalStore(b)
+	newLargeSession(b, store)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := store.Principal(ctx, "abc"); err != nil {
+			b.Fatalf("expected nil; got %v", err)
+		}
+	}
+}
+
+func BenchmarkPrincipalFullLoad(b *testing.B) {
+	store, _ := newPrincipalStore(b)
+	newLargeSession(b, store)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.load(ctx, "blah", "abc", sessions.NewSession(store, "blah")); err != nil {
+			b.Fatalf("expected nil; got %v", err)
+		}
+	}
+}
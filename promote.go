@@ -0,0 +1,106 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// errPromotedAttribute is returned by New when a promoted key collides with an
+// attribute configured on the store
+var errPromotedAttribute = errors.New("dynastore: promoted attribute collides with a key, ttl or GSI attribute")
+
+// reservedAttributes holds the attributes dynastore writes itself, which may not be
+// promoted
+var reservedAttributes = map[string]struct{}{
+	DefaultPrimaryKey: {},
+	DefaultTTLField:   {},
+	valuesField:       {},
+	optionsField:      {},
+	schemaField:       {},
+	versionField:      {},
+	nameField:         {},
+	quarantinedField:  {},
+	deletedField:      {},
+	principalField:    {},
+	createdField:      {},
+	updatedField:      {},
+	lastAccessField:   {},
+}
+
+// checkPromoted returns an error if key may not be promoted to an attribute
+func checkPromoted(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: promoted key must not be empty", ErrInvalidOption)
+	}
+	if _, ok := reservedAttributes[key]; ok || strings.HasPrefix(key, valuePrefix) || strings.HasPrefix(key, sessionFieldPrefix) {
+		return fmt.Errorf("%w: %q is reserved and cannot be promoted", ErrInvalidOption, key)
+	}
+	return nil
+}
+
+// checkPromotedFields returns an error if a promoted key names an attribute the
+// store was configured with
+func (store *Store) checkPromotedFields() error {
+	for _, key := range store.promoted {
+		if key == store.primaryKey || key == store.sortKey || key == store.ttlField || (store.gsiIndex != "" && key == store.gsiAttribute) {
+			return fmt.Errorf("%w: %q", errPromotedAttribute, key)
+		}
+	}
+	return nil
+}
+
+// promote copies the promoted session values into av as native attributes.  Values
+// other than strings, numbers and bools are skipped.
+func (store *Store) promote(session *sessions.Session, av map[string]types.AttributeValue) {
+	for _, key := range store.promoted {
+		if attr, ok := store.promotedAttribute(session, key); ok {
+			av[key] = attr
+		}
+	}
+}
+
+// promotedAttribute returns the attribute holding the session value of key, or
+// false if there is none or it cannot be promoted
+func (store *Store) promotedAttribute(session *sessions.Session, key string) (types.AttributeValue, bool) {
+	v, ok := session.Values[key]
+	if !ok {
+		return nil, false
+	}
+
+	switch v := v.(type) {
+	case string:
+		return &types.AttributeValueMemberS{Value: v}, true
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}, true
+	case int:
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(v)}, true
+	case int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return &types.AttributeValueMemberN{Value: fmt.Sprint(v)}, true
+	case float32:
+		return &types.AttributeValueMemberN{Value: strconv.FormatFloat(float64(v), 'g', -1, 32)}, true
+	case float64:
+		return &types.AttributeValueMemberN{Value: strconv.FormatFloat(v, 'g', -1, 64)}, true
+	default:
+		store.printf("dynastore: unable to promote %v of type %T\n", key, v)
+		return nil, false
+	}
+}
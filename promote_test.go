@@ -0,0 +1,142 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestPromoteAttributes(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), PromoteAttributes("plan", "seats", "admin", "ratio", "tags", "missing"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["plan"] = "pro"
+	session.Values["seats"] = 5
+	session.Values["admin"] = true
+	session.Values["ratio"] = 0.5
+	session.Values["tags"] = []string{"a"}
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	item := db.Item("abc")
+	if v, ok := item["plan"].(*types.AttributeValueMemberS); !ok || v.Value != "pro" {
+		t.Errorf("expected plan pro; got %#v", item["plan"])
+	}
+	if v, ok := item["seats"].(*types.AttributeValueMemberN); !ok || v.Value != "5" {
+		t.Errorf("expected seats 5; got %#v", item["seats"])
+	}
+	if v, ok := item["admin"].(*types.AttributeValueMemberBOOL); !ok || !v.Value {
+		t.Errorf("expected admin true; got %#v", item["admin"])
+	}
+	if v, ok := item["ratio"].(*types.AttributeValueMemberN); !ok || v.Value != "0.5" {
+		t.Errorf("expected ratio 0.5; got %#v", item["ratio"])
+	}
+	if _, ok := item["tags"]; ok {
+		t.Error("expected tags not to be promoted")
+	}
+	if _, ok := item["missing"]; ok {
+		t.Error("expected missing not to be promoted")
+	}
+	if _, ok := item[valuesField]; !ok {
+		t.Error("expected serialized values to be written")
+	}
+
+	// the payload remains authoritative
+	item["plan"] = &types.AttributeValueMemberS{Value: "free"}
+	db.SetItem(item)
+
+	loaded := sessions.NewSession(store, "blah")
+	if err := store.load(ctx, "blah", "abc", loaded); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := loaded.Values["plan"]; v != "pro" {
+		t.Errorf("expected pro; got %v", v)
+	}
+}
+
+func TestPromoteAttributesSaveValues(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), ValueAttributes(), PromoteAttributes("plan"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["plan"] = "pro"
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	loaded := sessions.NewSession(store, "blah")
+	if err := store.load(ctx, "blah", "abc", loaded); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	loaded.Values["plan"] = "team"
+	if err := store.SaveValues(ctx, loaded, "plan"); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v, ok := db.Item("abc")["plan"].(*types.AttributeValueMemberS); !ok || v.Value != "team" {
+		t.Errorf("expected plan team; got %#v", db.Item("abc")["plan"])
+	}
+
+	delete(loaded.Values, "plan")
+	if err := store.SaveValues(ctx, loaded, "plan"); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, ok := db.Item("abc")["plan"]; ok {
+		t.Error("expected plan to be removed")
+	}
+}
+
+func TestPromoteAttributesReserved(t *testing.T) {
+	for _, opts := range [][]Option{
+		{PromoteAttributes("id")},
+		{PromoteAttributes("ttl")},
+		{PromoteAttributes("values")},
+		{PromoteAttributes("options")},
+		{PromoteAttributes("schema")},
+		{PromoteAttributes("values.plan")},
+		{PromoteAttributes("")},
+	} {
+		if _, err := New(append(opts, DynamoDB(&dynastoretest.DB{}))...); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected ErrInvalidOption; got %v", err)
+		}
+	}
+
+	for _, opts := range [][]Option{
+		{PrimaryKey("pk"), PromoteAttributes("pk")},
+		{TTLField("expires"), PromoteAttributes("expires")},
+		{GSI("user-index", "user"), PromoteAttributes("user")},
+	} {
+		if _, err := New(append(opts, DynamoDB(&dynastoretest.DB{}))...); !errors.Is(err, errPromotedAttribute) {
+			t.Errorf("expected errPromotedAttribute; got %v", err)
+		}
+	}
+}
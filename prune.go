@@ -0,0 +1,207 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// batchWriteSize is the maximum number of writes per BatchWriteItem request
+	batchWriteSize = 25
+
+	// maxBatchRetries bounds the attempts to flush unprocessed items
+	maxBatchRetries = 8
+)
+
+var errUnprocessedItems = errors.New("unable to process all batch writes")
+
+// ScanOption configures DeleteExpired
+type ScanOption func(*scanOptions)
+
+type scanOptions struct {
+	pageLimit int32
+	segments  int
+	backoff   time.Duration
+}
+
+// ScanPageLimit limits the number of items evaluated by each Scan request
+func ScanPageLimit(n int) ScanOption {
+	return func(o *scanOptions) {
+		o.pageLimit = int32(n)
+	}
+}
+
+// ScanSegments sets the number of segments scanned in parallel; defaults to 1
+func ScanSegments(n int) ScanOption {
+	return func(o *scanOptions) {
+		o.segments = n
+	}
+}
+
+// DeleteExpired removes sessions whose ttl is before the given time and returns the
+// number removed.  It is intended for tables without DynamoDB TTL enabled, such as
+// those served by DynamoDB Local.
+func (store *Store) DeleteExpired(ctx context.Context, before time.Time, opts ...ScanOption) (int, error) {
+	if store.readOnly {
+		return 0, ErrReadOnlyStore
+	}
+	if store.ttlField == "" {
+		return 0, errTTLDisabled
+	}
+
+	options := scanOptions{
+		segments: 1,
+		backoff:  50 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.segments < 1 {
+		options.segments = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		total    int
+		firstErr error
+	)
+
+	for segment := 0; segment < options.segments; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+
+			n, err := store.deleteExpired(ctx, before, segment, options)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			total += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(segment)
+	}
+	wg.Wait()
+
+	return total, firstErr
+}
+
+// deleteExpired scans a single segment for expired sessions and deletes them
+func (store *Store) deleteExpired(ctx context.Context, before time.Time, segment int, options scanOptions) (int, error) {
+	names := map[string]string{
+		"#ttl": store.ttlField,
+	}
+	values := map[string]types.AttributeValue{
+		":before": &types.AttributeValueMemberN{Value: strconv.FormatInt(before.Unix(), 10)},
+	}
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(store.tableName),
+		ProjectionExpression:      aws.String(store.keyProjection(names)),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+
+	filter := []string{"#ttl < :before"}
+	if store.keyPrefix != "" {
+		filter = append(filter, "begins_with(#id, :prefix)")
+		values[":prefix"] = &types.AttributeValueMemberS{Value: store.itemPrefix()}
+	}
+	if condition := store.sortKeyFilter(names, values); condition != "" {
+		filter = append(filter, condition)
+	}
+	input.FilterExpression = aws.String(strings.Join(filter, " AND "))
+	if options.pageLimit > 0 {
+		input.Limit = aws.Int32(options.pageLimit)
+	}
+	if options.segments > 1 {
+		input.Segment = aws.Int32(int32(segment))
+		input.TotalSegments = aws.Int32(int32(options.segments))
+	}
+
+	deleted := 0
+	for {
+		out, err := store.ddb.Scan(ctx, input)
+		if err != nil {
+			store.printf("dynastore: Scan failed - %v\n", err)
+			return deleted, err
+		}
+
+		for i := 0; i < len(out.Items); i += batchWriteSize {
+			end := i + batchWriteSize
+			if end > len(out.Items) {
+				end = len(out.Items)
+			}
+
+			if err := store.batchDelete(ctx, out.Items[i:end], options.backoff); err != nil {
+				return deleted, err
+			}
+			deleted += end - i
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return deleted, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// batchDelete deletes the items with the given keys, retrying unprocessed items
+// with exponential backoff
+func (store *Store) batchDelete(ctx context.Context, keys []map[string]types.AttributeValue, backoff time.Duration) error {
+	requests := make([]types.WriteRequest, 0, len(keys))
+	for _, key := range keys {
+		requests = append(requests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{Key: key},
+		})
+	}
+
+	for attempt := 0; ; attempt++ {
+		out, err := store.ddb.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				store.tableName: requests,
+			},
+		})
+		if err != nil {
+			store.printf("dynastore: BatchWriteItem failed - %v\n", err)
+			return err
+		}
+
+		requests = out.UnprocessedItems[store.tableName]
+		if len(requests) == 0 {
+			return nil
+		}
+		if attempt+1 >= maxBatchRetries {
+			store.printf("dynastore: %v items left unprocessed\n", len(requests))
+			return errUnprocessedItems
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff << uint(attempt)):
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestDeleteExpired(t *testing.T) {
+	now := time.Unix(10000, 0)
+
+	newDB := func() *dynastoretest.DB {
+		db := &dynastoretest.DB{}
+		for i := 0; i < 100; i++ {
+			ttl := now.Add(time.Hour)
+			if i%2 == 0 {
+				ttl = now.Add(-time.Hour)
+			}
+			db.SetItem(map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "id-" + strconv.Itoa(i)},
+				DefaultTTLField:   &types.AttributeValueMemberN{Value: strconv.FormatInt(ttl.Unix(), 10)},
+			})
+		}
+		db.SetItem(map[string]types.AttributeValue{
+			DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "no-ttl"},
+		})
+		return db
+	}
+
+	testCases := map[string][]ScanOption{
+		"default":  nil,
+		"paged":    {ScanPageLimit(7)},
+		"segments": {ScanSegments(4), ScanPageLimit(10)},
+	}
+
+	for label, opts := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := newDB()
+			store, err := New(DynamoDB(db))
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			n, err := store.DeleteExpired(context.Background(), now, opts...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if n != 50 {
+				t.Errorf("expected 50 deleted; got %v", n)
+			}
+			if v := db.Len(); v != 51 {
+				t.Errorf("expected 51 remaining; got %v", v)
+			}
+			if db.Item("id-1") == nil || db.Item("no-ttl") == nil {
+				t.Error("expected unexpired sessions to remain")
+			}
+
+			for _, r := range db.Requests() {
+				if input, ok := r.(*dynamodb.BatchWriteItemInput); ok {
+					if v := len(input.RequestItems[DefaultTableName]); v > batchWriteSize {
+						t.Errorf("expected at most %v writes per batch; got %v", batchWriteSize, v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteExpiredUnprocessed(t *testing.T) {
+	now := time.Unix(10000, 0)
+	fastBackoff := func(o *scanOptions) { o.backoff = time.Millisecond }
+
+	db := &dynastoretest.DB{}
+	for i := 0; i < 30; i++ {
+		db.SetItem(map[string]types.AttributeValue{
+			DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "id-" + strconv.Itoa(i)},
+			DefaultTTLField:   &types.AttributeValueMemberN{Value: "1"},
+		})
+	}
+
+	// each write is left unprocessed on its first attempt
+	var mutex sync.Mutex
+	seen := map[string]bool{}
+	db.Unprocessed = func(req types.WriteRequest) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		id := req.DeleteRequest.Key[DefaultPrimaryKey].(*types.AttributeValueMemberS).Value
+		if seen[id] {
+			return false
+		}
+		seen[id] = true
+		return true
+	}
+
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	n, err := store.DeleteExpired(context.Background(), now, fastBackoff)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if n != 30 || db.Len() != 0 {
+		t.Errorf("expected 30 deleted; got %v with %v remaining", n, db.Len())
+	}
+
+	// items that are never processed are reported
+	db.SetItem(map[string]types.AttributeValue{
+		DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "stuck"},
+		DefaultTTLField:   &types.AttributeValueMemberN{Value: "1"},
+	})
+	db.Unprocessed = func(req types.WriteRequest) bool { return true }
+	if _, err := store.DeleteExpired(context.Background(), now, fastBackoff); err != errUnprocessedItems {
+		t.Errorf("expected errUnprocessedItems; got %v", err)
+	}
+}
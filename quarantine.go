@@ -0,0 +1,114 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DefaultQuarantineLimit holds the default number of items a store quarantines
+// per minute; see QuarantineLimit
+const DefaultQuarantineLimit = 60
+
+// quarantineLimiter counts the quarantines begun in the current minute
+type quarantineLimiter struct {
+	mutex  sync.Mutex
+	window time.Time
+	count  int
+	wg     sync.WaitGroup
+}
+
+// allow returns true if another quarantine may begin at now given limit per minute
+func (l *quarantineLimiter) allow(now time.Time, limit int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if window := now.Truncate(time.Minute); !window.Equal(l.window) {
+		l.window = window
+		l.count = 0
+	}
+	if l.count >= limit {
+		return false
+	}
+	l.count++
+	return true
+}
+
+// quarantineAsync quarantines the item with the given id in the background, unless
+// the per minute limit has been reached, so the request need not wait on it
+func (store *Store) quarantineAsync(ctx context.Context, id string) {
+	if store.quarantineTTL <= 0 || store.ttlField == "" || store.readOnly {
+		return
+	}
+
+	limit := store.quarantineLimit
+	if limit <= 0 {
+		limit = DefaultQuarantineLimit
+	}
+	if !store.quarantines.allow(store.now(), limit) {
+		store.printf("dynastore: quarantine limit reached; leaving undecodable session\n")
+		return
+	}
+
+	store.quarantines.wg.Add(1)
+	go func() {
+		defer store.quarantines.wg.Done()
+
+		ctx, cancel := store.withTimeout(context.WithoutCancel(ctx))
+		defer cancel()
+		store.quarantine(ctx, id)
+	}()
+}
+
+// quarantine marks an undecodable item so subsequent loads skip it and moves its
+// ttl forward so DynamoDB reaps it soon.  Failures are logged and reported to Hooks
+// but otherwise ignored.
+func (store *Store) quarantine(ctx context.Context, id string) {
+	var err error
+	done := store.startOperation(OpQuarantine)
+	defer func() { done(err) }()
+
+	expiresAt := store.now().Add(store.quarantineTTL).Unix()
+	input := &dynamodb.UpdateItemInput{
+		TableName:           aws.String(store.tableName),
+		Key:                 store.key(id),
+		ConditionExpression: aws.String("attribute_exists(#id)"),
+		UpdateExpression:    aws.String("SET #quarantined = :quarantined, #ttl = :ttl"),
+		ExpressionAttributeNames: map[string]string{
+			"#id":          store.primaryKey,
+			"#quarantined": quarantinedField,
+			"#ttl":         store.ttlField,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":quarantined": &types.AttributeValueMemberBOOL{Value: true},
+			":ttl":         &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)},
+		},
+	}
+	store.intercept(ctx, OpLoad, input)
+	_, err = store.ddb.UpdateItem(ctx, input)
+	if err != nil {
+		store.printf("dynastore: unable to quarantine session - %v\n", err)
+		return
+	}
+
+	store.printf("dynastore: quarantined undecodable session\n")
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestQuarantineLimit(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	var (
+		mutex   sync.Mutex
+		updates []string
+	)
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		switch input := in.(type) {
+		case *dynamodb.GetItemInput:
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: input.Key[DefaultPrimaryKey],
+				valuesField:       &types.AttributeValueMemberS{Value: "!!! not base64 !!!"},
+			}}, nil
+		case *dynamodb.UpdateItemInput:
+			mutex.Lock()
+			updates = append(updates, input.Key[DefaultPrimaryKey].(*types.AttributeValueMemberS).Value)
+			mutex.Unlock()
+		}
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), QuarantineCorrupt(time.Hour), QuarantineLimit(2))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	load := func(id string) {
+		if err := store.load(context.Background(), "blah", id, sessions.NewSession(store, "blah")); err != ErrDecodeFailed {
+			t.Errorf("expected ErrDecodeFailed; got %v", err)
+		}
+	}
+
+	load("a")
+	load("b")
+	load("c")
+	store.Close()
+	if v := len(updates); v != 2 {
+		t.Errorf("expected 2 quarantines within the minute; got %v", v)
+	}
+
+	now = now.Add(time.Minute)
+	load("c")
+	store.Close()
+	if v := len(updates); v != 3 {
+		t.Fatalf("expected quarantine after the minute elapsed; got %v", v)
+	}
+	if v := updates[2]; v != "c" {
+		t.Errorf("expected c; got %v", v)
+	}
+
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), QuarantineLimit(0)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+}
+
+func TestQuarantineHooks(t *testing.T) {
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		if input, ok := in.(*dynamodb.GetItemInput); ok {
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: input.Key[DefaultPrimaryKey],
+				valuesField:       &types.AttributeValueMemberS{Value: "!!! not base64 !!!"},
+			}}, nil
+		}
+		return nil, nil
+	})
+
+	var (
+		mutex sync.Mutex
+		ops   = map[string][]error{}
+	)
+	hooks := Hooks{
+		OnOperationStart: func(op string) func(err error, duration time.Duration) {
+			return func(err error, duration time.Duration) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				ops[op] = append(ops[op], err)
+			}
+		},
+	}
+
+	store, err := New(DynamoDB(ddb), QuarantineCorrupt(time.Hour), Instrumentation(hooks))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if err := store.load(context.Background(), "blah", "abc", sessions.NewSession(store, "blah")); err != ErrDecodeFailed {
+		t.Fatalf("expected ErrDecodeFailed; got %v", err)
+	}
+	store.Close()
+
+	if got := ops[OpQuarantine]; len(got) != 1 || got[0] != nil {
+		t.Errorf("expected one successful quarantine; got %v", got)
+	}
+	if got := ops[OpLoad]; len(got) != 1 {
+		t.Errorf("expected one load; got %v", got)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import "github.com/aws/aws-sdk-go-v2/aws"
+
+// reader returns the client used to load sessions; see ReadClient
+func (store *Store) reader() DynamoDBAPI {
+	if store.reads != nil {
+		return store.reads
+	}
+	return store.ddb
+}
+
+// consistentRead returns the ConsistentRead setting used to load sessions; see
+// EventuallyConsistentReads
+func (store *Store) consistentRead() *bool {
+	return aws.Bool(!store.eventualReads)
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestReadClient(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		writes  = &dynastoretest.DB{}
+		reads   = &dynastoretest.DB{}
+		counter = func(db *dynastoretest.DB) map[string]int {
+			counts := map[string]int{}
+			for _, req := range db.Requests() {
+				switch input := req.(type) {
+				case *dynamodb.GetItemInput:
+					counts["get"]++
+					if aws.ToBool(input.ConsistentRead) {
+						counts["consistent"]++
+					}
+				case *dynamodb.BatchGetItemInput:
+					counts["batch get"]++
+				case *dynamodb.PutItemInput:
+					counts["put"]++
+				case *dynamodb.DeleteItemInput:
+					counts["delete"]++
+				}
+			}
+			return counts
+		}
+	)
+
+	store, err := New(WriteClient(writes), ReadClient(reads), EventuallyConsistentReads())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["user"] = "joe"
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	reads.SetItem(writes.Item(session.ID)) // replicate, as DAX would on read through
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	loaded, err := store.New(req, "blah")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("expected existing session; got %v", err)
+	}
+	if v := loaded.Values["user"]; v != "joe" {
+		t.Errorf("expected joe; got %v", v)
+	}
+	if found, err := store.LoadMulti(ctx, []string{session.ID}); err != nil || len(found) != 1 {
+		t.Errorf("expected 1 session; got %v, %v", len(found), err)
+	}
+	if err := store.delete(ctx, session.ID); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if got, want := counter(writes), map[string]int{"put": 1, "delete": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected write client to receive %v; got %v", want, got)
+	}
+	if got, want := counter(reads), map[string]int{"get": 1, "batch get": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected read client to receive %v; got %v", want, got)
+	}
+}
+
+func TestReadClientDefault(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if store.reader() != DynamoDBAPI(db) {
+		t.Error("expected loads to use the DynamoDB client")
+	}
+	if !aws.ToBool(store.consistentRead()) {
+		t.Error("expected consistent reads by default")
+	}
+}
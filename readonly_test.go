@@ -0,0 +1,93 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	db := &dynastoretest.DB{}
+
+	writer, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := writer.New(req, "blah")
+	session.Values["user"] = "joe"
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	store, err := New(DynamoDB(db), ReadOnly(), MaxAge(3600))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	n := len(db.Requests())
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookie)
+	session, err = store.New(req, "blah")
+	if err != nil || session.IsNew {
+		t.Fatalf("expected existing session; got %v", err)
+	}
+	if v := session.Values["user"]; v != "joe" {
+		t.Errorf("expected joe; got %v", v)
+	}
+
+	session.Values["user"] = "jane"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+	session.Options.MaxAge = -1
+	if err := store.Save(req, httptest.NewRecorder(), session); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+	if err := store.Regenerate(req, httptest.NewRecorder(), session); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+	if err := store.SaveValues(ctx, session, "user"); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+	if err := store.Touch(ctx, session.ID); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+	if _, err := store.TouchBatch(ctx, []string{session.ID}, time.Hour); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+	if _, err := store.DeleteExpired(ctx, time.Now()); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+	if err := store.Transact(ctx, PutSession(sessions.NewSession(store, "blah"))); err != ErrReadOnlyStore {
+		t.Errorf("expected ErrReadOnlyStore; got %v", err)
+	}
+
+	for _, r := range db.Requests()[n:] {
+		if _, ok := r.(*dynamodb.GetItemInput); !ok {
+			t.Errorf("expected only GetItem; got %T", r)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// Regenerate moves session to a freshly generated id and reissues the cookie,
+// preserving its Values and Options.  Call Regenerate on login and other privilege
+// changes to protect against session fixation.
+//
+// The item under the old id is deleted before the new one is written so the two
+// are never both valid.  If the delete fails, session is left unchanged; if the
+// subsequent save fails, the session is lost and the user must log in again.
+func (store *Store) Regenerate(req *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx := store.contextFor(req)
+
+	if store.readOnly {
+		return ErrReadOnlyStore
+	}
+	if store.sharedItem {
+		return errSharedItemUnsupported
+	}
+
+	if !session.IsNew {
+		deleteCtx, cancel := store.withTimeout(ctx)
+		err := store.delete(deleteCtx, session.ID)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	id := store.newID()
+	if !validCookieValue(id) {
+		store.printf("dynastore: generated session id is not a valid cookie value\n")
+		return ErrInvalidSessionID
+	}
+
+	session.ID = id
+	session.IsNew = true
+	if st, ok := lookupState(session); ok {
+		// the session keeps its age so AbsoluteTimeout still applies, and remains
+		// managed by Middleware
+		*st = sessionState{createdAt: st.createdAt, managed: st.managed}
+	}
+
+	return store.SaveCtx(ctx, req, w, session)
+}
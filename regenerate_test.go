@@ -0,0 +1,166 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestRegenerate(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), MaxAge(60), WithVersioning())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["user"] = "joe"
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, _ = store.Get(req, "blah")
+	oldID := session.ID
+
+	w = httptest.NewRecorder()
+	if err := store.Regenerate(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if session.ID == oldID {
+		t.Fatal("expected session id to change")
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != session.ID || cookies[0].MaxAge != 60 {
+		t.Fatalf("expected cookie with new id; got %v", cookies)
+	}
+
+	ctx := context.Background()
+	if err := store.load(ctx, "blah", oldID, sessions.NewSession(store, "blah")); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+
+	restored := sessions.NewSession(store, "blah")
+	if err := store.load(ctx, "blah", session.ID, restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := restored.Values["user"]; v != "joe" {
+		t.Errorf("expected joe; got %v", v)
+	}
+	if v := db.Len(); v != 1 {
+		t.Errorf("expected 1 item; got %v", v)
+	}
+}
+
+func TestRegenerateMissing(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "gone"
+	session.Values["user"] = "joe"
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	if err := store.Regenerate(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if db.Item(session.ID) == nil {
+		t.Error("expected session to be saved under the new id")
+	}
+}
+
+func TestRegenerateDeleteFails(t *testing.T) {
+	failure := errors.New("boom")
+	db := &dynastoretest.DB{
+		Err: func(input interface{}) error {
+			if _, ok := input.(*dynamodb.DeleteItemInput); ok {
+				return failure
+			}
+			return nil
+		},
+	}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	if err := store.Regenerate(req, httptest.NewRecorder(), session); !errors.Is(err, failure) {
+		t.Fatalf("expected boom; got %v", err)
+	}
+	if session.ID != "abc" {
+		t.Errorf("expected session to be unchanged; got %v", session.ID)
+	}
+	if v := db.Len(); v != 1 {
+		t.Errorf("expected 1 item; got %v", v)
+	}
+}
+
+func TestRegenerateAbsoluteTimeout(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(&dynastoretest.DB{}), MaxAge(86400), AbsoluteTimeout(time.Hour), Clock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	now = now.Add(50 * time.Minute)
+	req, _ = http.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, _ = store.Get(req, "blah")
+	w = httptest.NewRecorder()
+	if err := store.Regenerate(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	now = now.Add(20 * time.Minute)
+	req, _ = http.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err = store.New(req, "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if !session.IsNew {
+		t.Error("expected the regenerated session to expire an hour after it was created")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// newThrottledDynamoDB returns a client that throttles the first n requests
+func newThrottledDynamoDB(n int) (*testDynamoDB, *int) {
+	calls := 0
+	return newTestDynamoDB(func(input interface{}) (interface{}, error) {
+		calls++
+		if calls <= n {
+			return nil, &types.ProvisionedThroughputExceededException{}
+		}
+		return nil, nil
+	}), &calls
+}
+
+func TestRetry(t *testing.T) {
+	ddb, calls := newThrottledDynamoDB(3)
+
+	var attempts []int
+	store, err := New(DynamoDB(ddb), Retry(5, 2*time.Millisecond), OnRetry(func(attempt int, err error) {
+		attempts = append(attempts, attempt)
+	}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+
+	begin := time.Now()
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	elapsed := time.Since(begin)
+
+	if *calls != 4 {
+		t.Errorf("expected 4 calls; got %v", *calls)
+	}
+	if len(attempts) != 3 || attempts[2] != 3 {
+		t.Errorf("expected retries after attempts 1-3; got %v", attempts)
+	}
+
+	// delays of 2ms, 4ms and 8ms, each jittered down to no less than half
+	if min, max := 7*time.Millisecond, time.Second; elapsed < min || elapsed > max {
+		t.Errorf("expected elapsed between %v and %v; got %v", min, max, elapsed)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	ddb, calls := newThrottledDynamoDB(10)
+	store, err := New(DynamoDB(ddb), Retry(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if err := store.delete(context.Background(), "abc"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("expected ErrThrottled; got %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("expected 3 calls; got %v", *calls)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	ddb, calls := newThrottledDynamoDB(10)
+	store, err := New(DynamoDB(ddb), Retry(5, time.Hour))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = store.load(ctx, "blah", "abc", sessions.NewSession(store, "blah"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded; got %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("expected 1 call; got %v", *calls)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	ddb, calls := newThrottledDynamoDB(1)
+	store, err := New(DynamoDB(ddb))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if err := store.delete(context.Background(), "abc"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("expected ErrThrottled; got %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("expected 1 call; got %v", *calls)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+// saveLocks serializes concurrent saves of the same session, e.g. from goroutines
+// a handler fans out to, so only the first save of a new session sets its cookie
+type saveLocks struct {
+	mutex sync.Mutex
+	locks map[*sessions.Session]*saveLock
+}
+
+// saveLock is held by the save in progress; refs counts the saves holding or
+// waiting for it
+type saveLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock blocks until no other save of session is in progress and returns the func
+// that releases it
+func (s *saveLocks) lock(session *sessions.Session) func() {
+	s.mutex.Lock()
+	if s.locks == nil {
+		s.locks = map[*sessions.Session]*saveLock{}
+	}
+	l, ok := s.locks[session]
+	if !ok {
+		l = &saveLock{}
+		s.locks[session] = l
+	}
+	l.refs++
+	s.mutex.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, session)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestConcurrentSaveNewSession(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["user"] = "alice"
+
+	w := httptest.NewRecorder()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Save(req, w, session); err != nil {
+				t.Errorf("expected nil; got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v := w.Header().Values("Set-Cookie"); len(v) != 1 {
+		t.Fatalf("expected 1 Set-Cookie header; got %v", v)
+	}
+	if session.IsNew {
+		t.Error("expected session not to be new once saved")
+	}
+	if v := len(store.saving.locks); v != 0 {
+		t.Errorf("expected locks to be released; got %v", v)
+	}
+
+	// later saves still persist changes
+	session.Values["user"] = "bob"
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := w.Header().Values("Set-Cookie"); len(v) != 1 {
+		t.Errorf("expected cookie not to be set again; got %v", v)
+	}
+
+	loaded, err := store.New(httptest.NewRequest("GET", "http://localhost", nil), "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.load(req.Context(), "blah", session.ID, loaded); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := loaded.Values["user"]; v != "bob" {
+		t.Errorf("expected bob; got %v", v)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// schemaField holds the layout version of the item so the layout can change
+// without a flag day migration
+const schemaField = "schema"
+
+// currentSchema is the layout version written by Persist.  Items without a schema
+// attribute predate it and are read as version 0, which shares the same layout.
+const currentSchema = 1
+
+// ErrUnsupportedSchema indicates the item was written using a layout this version
+// of dynastore cannot read, typically by a newer release during a rolling deploy
+var ErrUnsupportedSchema = errors.New("unsupported session schema")
+
+// schemaDecoder unmarshals the values and options of an item written using a
+// particular layout version into session
+type schemaDecoder func(store *Store, ctx context.Context, name string, item map[string]types.AttributeValue, session *sessions.Session) error
+
+// schemaDecoders maps each readable layout version to its decoder
+var schemaDecoders = map[int64]schemaDecoder{
+	0: decodeV1,
+	1: decodeV1,
+}
+
+// decodeV1 reads the layout written by the configured serializer, falling back to
+// the legacy layout of the original dynastore
+func decodeV1(store *Store, ctx context.Context, name string, item map[string]types.AttributeValue, session *sessions.Session) error {
+	item, err := store.decrypt(ctx, item)
+	if err != nil {
+		store.printf("dynastore: unable to decrypt session - %v\n", err)
+		return err
+	}
+
+	err = store.serializer.unmarshal(name, item, session)
+	if err != nil {
+		err = store.decodeLegacy(name, item, session, err)
+	}
+	if err != nil {
+		store.printf("dynastore: unable to unmarshal session - %v\n", err)
+		return err
+	}
+	if store.valueAttributes {
+		if session.Values == nil {
+			session.Values = map[interface{}]interface{}{}
+		}
+		if err := store.unmarshalValues(name, item, session); err != nil {
+			store.printf("dynastore: unable to unmarshal session value - %v\n", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaOf returns the layout version of item
+func schemaOf(item map[string]types.AttributeValue) (int64, error) {
+	av, ok := item[schemaField]
+	if !ok {
+		return 0, nil
+	}
+	n, ok := av.(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, ErrMalformedSession
+	}
+	v, err := strconv.ParseInt(n.Value, 10, 64)
+	if err != nil {
+		return 0, ErrMalformedSession
+	}
+	return v, nil
+}
+
+// decoderFor returns the decoder for the layout version of item
+func decoderFor(item map[string]types.AttributeValue) (schemaDecoder, error) {
+	version, err := schemaOf(item)
+	if err != nil {
+		return nil, err
+	}
+	decoder, ok := schemaDecoders[version]
+	if !ok {
+		return nil, ErrUnsupportedSchema
+	}
+	return decoder, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestSchema(t *testing.T) {
+	testCases := map[string]struct {
+		schema types.AttributeValue
+		err    error
+	}{
+		"v0": {
+			schema: nil,
+		},
+		"current": {
+			schema: &types.AttributeValueMemberN{Value: "1"},
+		},
+		"unknown": {
+			schema: &types.AttributeValueMemberN{Value: "99"},
+			err:    ErrUnsupportedSchema,
+		},
+		"malformed": {
+			schema: &types.AttributeValueMemberS{Value: "1"},
+			err:    ErrMalformedSession,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			store, err := New(DynamoDB(db))
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			session.Values["a"] = "b"
+			if err := store.save(context.Background(), "blah", session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			item := db.Item(store.itemID("abc"))
+			if got, ok := item[schemaField].(*types.AttributeValueMemberN); !ok || got.Value != "1" {
+				t.Fatalf("expected schema 1; got %#v", item[schemaField])
+			}
+			if tc.schema == nil {
+				delete(item, schemaField)
+			} else {
+				item[schemaField] = tc.schema
+			}
+			db.SetItem(item)
+
+			restored := sessions.NewSession(store, "blah")
+			err = store.load(context.Background(), "blah", "abc", restored)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v; got %v", tc.err, err)
+			}
+			if tc.err == nil && restored.Values["a"] != "b" {
+				t.Errorf("expected b; got %v", restored.Values["a"])
+			}
+		})
+	}
+}
+
+func TestUnsupportedSchemaNotReplaced(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	item := db.Item(store.itemID("abc"))
+	item[schemaField] = &types.AttributeValueMemberN{Value: "99"}
+	db.SetItem(item)
+
+	encoded, err := store.encodeCookie("blah", "abc")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Cookie", "blah="+encoded)
+
+	if _, err := store.New(req, "blah"); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("expected ErrUnsupportedSchema; got %v", err)
+	}
+	store.Close()
+	if _, ok := db.Item(store.itemID("abc"))[quarantinedField]; ok {
+		t.Error("expected item written by a newer schema not to be quarantined")
+	}
+}
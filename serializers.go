@@ -18,31 +18,50 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 )
 
+// keyName returns the name of the primary key attribute, defaulting to DefaultPrimaryKey
+func keyName(primaryKey string) string {
+	if primaryKey == "" {
+		return DefaultPrimaryKey
+	}
+	return primaryKey
+}
+
 type codecSerializer struct {
-	codecs []securecookie.Codec
+	codecs     []securecookie.Codec
+	primaryKey string
+
+	// maxLength holds the limit applied to the codecs; see MaxLength
+	maxLength int
 }
 
-func (c *codecSerializer) marshal(name string, session *sessions.Session) (map[string]*dynamodb.AttributeValue, error) {
+func (c *codecSerializer) marshal(name string, session *sessions.Session) (map[string]types.AttributeValue, error) {
 	values, err := securecookie.EncodeMulti(name, session.Values, c.codecs...)
 	if err != nil {
-		return nil, errEncodeFailed
+		if strings.Contains(err.Error(), "value is too long") {
+			return nil, ErrValueTooLong{Size: encodedLength(err), Limit: c.maxLength}
+		}
+		return nil, ErrEncodeFailed
 	}
 
-	av := map[string]*dynamodb.AttributeValue{
-		idField:     {S: aws.String(session.ID)},
-		valuesField: {S: aws.String(values)},
+	av := map[string]types.AttributeValue{
+		keyName(c.primaryKey): &types.AttributeValueMemberS{Value: session.ID},
+		valuesField:           &types.AttributeValueMemberS{Value: values},
 	}
 
 	if session.Options != nil {
-		options, err := dynamodbattribute.Marshal(session.Options)
+		options, err := attributevalue.Marshal(session.Options)
 		if err != nil {
 			return nil, err
 		}
@@ -52,41 +71,40 @@ func (c *codecSerializer) marshal(name string, session *sessions.Session) (map[s
 	return av, nil
 }
 
-func (c *codecSerializer) unmarshal(name string, in map[string]*dynamodb.AttributeValue, session *sessions.Session) error {
+func (c *codecSerializer) unmarshal(name string, in map[string]types.AttributeValue, session *sessions.Session) error {
 	if len(in) == 0 {
-		return errNotFound
+		return ErrNotFound
 	}
 
 	// id
-	av, ok := in[idField]
-	if !ok || av.S == nil {
-		return errMalformedSession
+	id, ok := in[keyName(c.primaryKey)].(*types.AttributeValueMemberS)
+	if !ok {
+		return ErrMalformedSession
 	}
-	id := *av.S
 
 	// payload
 
-	av, ok = in[valuesField]
-	if !ok || av.S == nil {
-		return errMalformedSession
+	payload, ok := in[valuesField].(*types.AttributeValueMemberS)
+	if !ok {
+		return ErrMalformedSession
 	}
 
 	values := map[interface{}]interface{}{}
-	err := securecookie.DecodeMulti(name, *av.S, &values, c.codecs...)
+	err := securecookie.DecodeMulti(name, payload.Value, &values, c.codecs...)
 	if err != nil {
-		return errDecodeFailed
+		return ErrDecodeFailed
 	}
 
 	session.IsNew = false
-	session.ID = id
+	session.ID = id.Value
 	session.Values = values
 
 	// options
 
-	av, ok = in[optionsField]
+	av, ok := in[optionsField]
 	if ok {
 		options := &sessions.Options{}
-		err = dynamodbattribute.Unmarshal(av, options)
+		err = attributevalue.Unmarshal(av, options)
 		if err != nil {
 			return err
 		}
@@ -96,26 +114,93 @@ func (c *codecSerializer) unmarshal(name string, in map[string]*dynamodb.Attribu
 	return nil
 }
 
+func (c *codecSerializer) marshalValue(name string, value interface{}) (types.AttributeValue, error) {
+	encoded, err := securecookie.EncodeMulti(name, []interface{}{value}, c.codecs...)
+	if err != nil {
+		return nil, ErrEncodeFailed
+	}
+	return &types.AttributeValueMemberS{Value: encoded}, nil
+}
+
+func (c *codecSerializer) unmarshalValue(name string, av types.AttributeValue) (interface{}, error) {
+	encoded, ok := av.(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, ErrMalformedSession
+	}
+
+	var value []interface{}
+	if err := securecookie.DecodeMulti(name, encoded.Value, &value, c.codecs...); err != nil || len(value) != 1 {
+		return nil, ErrDecodeFailed
+	}
+	return value[0], nil
+}
+
+// encodedLength extracts the encoded length securecookie reports when a value is
+// too long, returning 0 if it cannot be determined
+func encodedLength(err error) int {
+	msg := err.Error()
+	n, _ := strconv.Atoi(msg[strings.LastIndex(msg, " ")+1:])
+	return n
+}
+
+func init() {
+	// commonly stored types that gob does not register itself
+	gob.Register(time.Time{})
+	gob.Register(map[string]string{})
+	gob.Register(json.RawMessage{})
+}
+
+// registerType registers the type of v with gob, returning an error rather than
+// panicking if it conflicts with an earlier registration
+func registerType(v interface{}) (err error) {
+	if v == nil {
+		return fmt.Errorf("%w: cannot register nil type", ErrInvalidOption)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrInvalidOption, r)
+		}
+	}()
+	gob.Register(v)
+	return nil
+}
+
 type gobSerializer struct {
+	primaryKey string
+
+	// compress stores values as a gzipped Binary attribute at the given level
+	compress bool
+	level    int
 }
 
-func (d *gobSerializer) marshal(name string, session *sessions.Session) (map[string]*dynamodb.AttributeValue, error) {
+func (d *gobSerializer) marshal(name string, session *sessions.Session) (map[string]types.AttributeValue, error) {
 	buf := &bytes.Buffer{}
 	err := gob.NewEncoder(buf).Encode(session.Values)
 	if err != nil {
-		return nil, errEncodeFailed
+		// retain the gob error as it names any type missing from gob.Register
+		return nil, fmt.Errorf("%w: %w", ErrEncodeFailed, err)
+	}
+
+	var values types.AttributeValue
+	if d.compress {
+		data, err := compress(buf.Bytes(), d.level)
+		if err != nil {
+			return nil, ErrEncodeFailed
+		}
+		values = &types.AttributeValueMemberB{Value: data}
+	} else {
+		values = &types.AttributeValueMemberS{Value: base64.StdEncoding.EncodeToString(buf.Bytes())}
 	}
-	values := base64.StdEncoding.EncodeToString(buf.Bytes())
 
-	av := map[string]*dynamodb.AttributeValue{
-		idField:     {S: aws.String(session.ID)},
-		valuesField: {S: aws.String(values)},
+	av := map[string]types.AttributeValue{
+		keyName(d.primaryKey): &types.AttributeValueMemberS{Value: session.ID},
+		valuesField:           values,
 	}
 
 	// encode options
 
 	if session.Options != nil {
-		options, err := dynamodbattribute.Marshal(session.Options)
+		options, err := attributevalue.Marshal(session.Options)
 		if err != nil {
 			return nil, err
 		}
@@ -125,45 +210,53 @@ func (d *gobSerializer) marshal(name string, session *sessions.Session) (map[str
 	return av, nil
 }
 
-func (d *gobSerializer) unmarshal(name string, in map[string]*dynamodb.AttributeValue, session *sessions.Session) error {
+func (d *gobSerializer) unmarshal(name string, in map[string]types.AttributeValue, session *sessions.Session) error {
 	if len(in) == 0 {
-		return errNotFound
+		return ErrNotFound
 	}
 
 	// id
-	av, ok := in[idField]
-	if !ok || av.S == nil {
-		return errMalformedSession
+	id, ok := in[keyName(d.primaryKey)].(*types.AttributeValueMemberS)
+	if !ok {
+		return ErrMalformedSession
 	}
-	id := *av.S
 
 	// payload
 
-	av, ok = in[valuesField]
-	if !ok && av.S != nil {
-		return errMalformedSession
+	var data []byte
+	switch payload := in[valuesField].(type) {
+	case *types.AttributeValueMemberS:
+		v, err := base64.StdEncoding.DecodeString(payload.Value)
+		if err != nil {
+			return ErrDecodeFailed
+		}
+		data = v
+	case *types.AttributeValueMemberB:
+		v, err := decompress(payload.Value)
+		if err != nil {
+			return ErrDecodeFailed
+		}
+		data = v
+	default:
+		return ErrMalformedSession
 	}
 
-	data, err := base64.StdEncoding.DecodeString(*av.S)
-	if err != nil {
-		return errDecodeFailed
-	}
 	values := map[interface{}]interface{}{}
-	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&values)
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&values)
 	if err != nil {
-		return errDecodeFailed
+		return ErrDecodeFailed
 	}
 
 	session.IsNew = false
-	session.ID = id
+	session.ID = id.Value
 	session.Values = values
 
 	// options
 
-	av, ok = in[optionsField]
+	av, ok := in[optionsField]
 	if ok {
 		options := &sessions.Options{}
-		err = dynamodbattribute.Unmarshal(av, options)
+		err = attributevalue.Unmarshal(av, options)
 		if err != nil {
 			return err
 		}
@@ -172,3 +265,30 @@ func (d *gobSerializer) unmarshal(name string, in map[string]*dynamodb.Attribute
 
 	return nil
 }
+
+func (d *gobSerializer) marshalValue(name string, value interface{}) (types.AttributeValue, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode([]interface{}{value}); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncodeFailed, err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+	return &types.AttributeValueMemberS{Value: encoded}, nil
+}
+
+func (d *gobSerializer) unmarshalValue(name string, av types.AttributeValue) (interface{}, error) {
+	encoded, ok := av.(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, ErrMalformedSession
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded.Value)
+	if err != nil {
+		return nil, ErrDecodeFailed
+	}
+
+	var value []interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil || len(value) != 1 {
+		return nil, ErrDecodeFailed
+	}
+	return value[0], nil
+}
@@ -15,11 +15,17 @@
 package dynastore
 
 import (
+	"encoding/json"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
 )
 
 func TestSerializers(t *testing.T) {
@@ -52,7 +58,12 @@ func TestSerializers(t *testing.T) {
 			}
 			session := &sessions.Session{
 				Values: map[interface{}]interface{}{
-					"hello": "world",
+					"hello":   "world",
+					"int":     42,
+					"int64":   int64(-7),
+					"float":   3.25,
+					"enabled": true,
+					"off":     false,
 				},
 				Options: options,
 			}
@@ -69,15 +80,120 @@ func TestSerializers(t *testing.T) {
 				return
 			}
 
-			if session.Values["hello"] != "world" {
-				t.Errorf("expected hello:world; got %#v\n", session.Values)
+			if !reflect.DeepEqual(session.Values, restored.Values) {
+				t.Errorf("expected %#v; got %#v\n", session.Values, restored.Values)
 				return
 			}
 
-			if !reflect.DeepEqual(options, session.Options) {
-				t.Errorf("expected %#v; got %#v", options, session.Options)
+			if !reflect.DeepEqual(options, restored.Options) {
+				t.Errorf("expected %#v; got %#v", options, restored.Options)
 				return
 			}
 		})
 	}
 }
+
+func TestSerializersNoPanic(t *testing.T) {
+	hashKey := securecookie.GenerateRandomKey(64)
+	blockKey := securecookie.GenerateRandomKey(32)
+	codec := securecookie.New(hashKey, blockKey)
+	name := "blah"
+
+	serializers := map[string]serializer{
+		"secure":    &codecSerializer{codecs: []securecookie.Codec{codec}},
+		"plainText": &gobSerializer{},
+	}
+
+	values := map[string]map[interface{}]interface{}{
+		"non-string keys": {42: "answer", 1.5: true},
+		"nil value":       {"nil": nil},
+		"nested map":      {"nested": map[string]interface{}{"a": map[string]int{"b": 1}}},
+		"struct key":      {struct{ A int }{A: 1}: "value"},
+	}
+
+	for label, s := range serializers {
+		for kind, v := range values {
+			t.Run(label+"/"+kind, func(t *testing.T) {
+				session := &sessions.Session{ID: "abc", Values: v}
+				av, err := s.marshal(name, session)
+				if err != nil {
+					if !errors.Is(err, ErrEncodeFailed) {
+						t.Errorf("expected ErrEncodeFailed; got %v", err)
+					}
+					return
+				}
+
+				restored := &sessions.Session{}
+				if err := s.unmarshal(name, av, restored); err != nil {
+					t.Errorf("expected nil; got %v", err)
+				}
+			})
+		}
+
+		t.Run(label+"/missing values", func(t *testing.T) {
+			in := map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+			}
+			if err := s.unmarshal(name, in, &sessions.Session{}); err != ErrMalformedSession {
+				t.Errorf("expected ErrMalformedSession; got %v", err)
+			}
+		})
+	}
+}
+
+type unregisteredValue struct{ A int }
+
+type registeredValue struct{ A int }
+
+type conflictValue struct{ A int }
+
+func TestGobRegisteredTypes(t *testing.T) {
+	now := time.Unix(1500000000, 0).UTC()
+	s := &gobSerializer{}
+
+	session := &sessions.Session{ID: "abc", Values: map[interface{}]interface{}{
+		"time":   now,
+		"slice":  []string{"a", "b"},
+		"map":    map[string]string{"a": "b"},
+		"raw":    json.RawMessage(`{"a":1}`),
+		"custom": unregisteredValue{A: 1},
+	}}
+	_, err := s.marshal("blah", session)
+	if !errors.Is(err, ErrEncodeFailed) {
+		t.Fatalf("expected ErrEncodeFailed; got %v", err)
+	}
+	if !strings.Contains(err.Error(), "unregisteredValue") {
+		t.Errorf("expected error to name the unregistered type; got %v", err)
+	}
+
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), RegisterTypes(registeredValue{})); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	session.Values["custom"] = registeredValue{A: 1}
+	av, err := s.marshal("blah", session)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	restored := &sessions.Session{}
+	if err := s.unmarshal("blah", av, restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if !reflect.DeepEqual(session.Values, restored.Values) {
+		t.Errorf("expected %#v; got %#v", session.Values, restored.Values)
+	}
+}
+
+func TestRegisterTypesConflict(t *testing.T) {
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), RegisterTypes(conflictValue{})); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	type conflictValue struct{ B string } // same name, different type
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), RegisterTypes(conflictValue{})); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), RegisterTypes(nil)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+}
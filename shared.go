@@ -0,0 +1,224 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// SharedCookieName names the cookie holding the item id when SharedItem is set
+	SharedCookieName = "dynastore"
+
+	// sessionFieldPrefix prefixes the attribute holding each named session in a
+	// shared item
+	sessionFieldPrefix = "session."
+)
+
+var errSharedItemUnsupported = errors.New("SharedItem cannot be combined with ValueAttributes, WithVersioning, SlidingExpiration, IdleTimeout, GSI, FallbackToUnprefixed, Tombstones, TrackCreation, Transact or Regenerate")
+
+// sharedIDKey holds the id of the item shared by the sessions of a request
+type sharedIDKey struct{}
+
+type sharedID struct {
+	mutex sync.Mutex
+	id    string
+}
+
+// cookieName returns the name of the cookie identifying the session with the
+// given name
+func (store *Store) cookieName(name string) string {
+	if store.sharedItem {
+		return SharedCookieName
+	}
+	return name
+}
+
+// requestID returns the id of a new session.  When SharedItem is set, every
+// session of the request shares the id read from the cookie, or one assigned
+// earlier in the request.
+func (store *Store) requestID(req *http.Request, cookieID string) string {
+	if !store.sharedItem {
+		return store.newID()
+	}
+
+	shared, ok := req.Context().Value(sharedIDKey{}).(*sharedID)
+	if !ok {
+		shared = &sharedID{}
+		*req = *req.WithContext(context.WithValue(req.Context(), sharedIDKey{}, shared))
+	}
+
+	shared.mutex.Lock()
+	defer shared.mutex.Unlock()
+
+	if shared.id == "" {
+		shared.id = cookieID
+	}
+	if shared.id == "" {
+		shared.id = store.newID()
+	}
+	return shared.id
+}
+
+// sharedSession extracts the attributes of the session with the given name from a
+// shared item, returning nil if the item does not hold it
+func (store *Store) sharedSession(item map[string]types.AttributeValue, name string) map[string]types.AttributeValue {
+	m, ok := item[sessionFieldPrefix+name].(*types.AttributeValueMemberM)
+	if !ok {
+		return nil
+	}
+
+	session := make(map[string]types.AttributeValue, len(m.Value)+1)
+	for k, v := range m.Value {
+		session[k] = v
+	}
+	session[store.primaryKey] = item[store.primaryKey]
+	return session
+}
+
+// saveShared writes session as an attribute of the shared item.  The item ttl is
+// only ever extended so it outlives every session it holds.
+func (store *Store) saveShared(ctx context.Context, name string, session *sessions.Session) error {
+	input, _, err := store.putInput(ctx, name, session)
+	if err != nil {
+		return err
+	}
+
+	attrs := input.Item
+	for k := range store.key(session.ID) {
+		delete(attrs, k)
+	}
+
+	update := &dynamodb.UpdateItemInput{
+		TableName:        aws.String(store.tableName),
+		Key:              store.key(session.ID),
+		UpdateExpression: aws.String("SET #session = :session"),
+		ExpressionAttributeNames: map[string]string{
+			"#session": sessionFieldPrefix + name,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":session": &types.AttributeValueMemberM{Value: attrs},
+		},
+		ReturnConsumedCapacity: store.returnConsumedCapacity(),
+	}
+
+	if ttl, ok := attrs[store.ttlField]; ok {
+		extend := *update
+		extend.UpdateExpression = aws.String("SET #session = :session, #ttl = :ttl")
+		extend.ConditionExpression = aws.String("attribute_not_exists(#ttl) OR #ttl < :ttl")
+		extend.ExpressionAttributeNames = map[string]string{
+			"#session": sessionFieldPrefix + name,
+			"#ttl":     store.ttlField,
+		}
+		extend.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":session": &types.AttributeValueMemberM{Value: attrs},
+			":ttl":     ttl,
+		}
+
+		err := store.updateItem(ctx, OpSave, &extend)
+		if err == nil || !isConditionalCheckFailed(err) {
+			return store.sharedResult(session, err)
+		}
+		// another session in the item expires later; leave the item ttl alone
+	}
+
+	return store.sharedResult(session, store.updateItem(ctx, OpSave, update))
+}
+
+// sharedResult completes saveShared
+func (store *Store) sharedResult(session *sessions.Session, err error) error {
+	if err != nil {
+		store.printf("dynastore: UpdateItem failed - %v\n", err)
+		return wrapError(OpSave, session.ID, err)
+	}
+	store.saved(session, 0)
+	return nil
+}
+
+// deleteShared removes the session with the given name from the shared item,
+// deleting the item once it holds no sessions.  True is returned if the item was
+// deleted.
+func (store *Store) deleteShared(ctx context.Context, id, name string) (_ bool, err error) {
+	done := store.startOperation(OpDelete)
+	defer func() { done(err) }()
+
+	var out *dynamodb.UpdateItemOutput
+	err = store.withRetry(ctx, func() (err error) {
+		input := &dynamodb.UpdateItemInput{
+			TableName:                aws.String(store.tableName),
+			Key:                      store.key(id),
+			UpdateExpression:         aws.String("REMOVE #session"),
+			ExpressionAttributeNames: map[string]string{"#session": sessionFieldPrefix + name},
+			ReturnValues:             types.ReturnValueAllNew,
+			ReturnConsumedCapacity:   store.returnConsumedCapacity(),
+		}
+		store.intercept(ctx, OpDelete, input)
+		out, err = store.ddb.UpdateItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpDelete, out.ConsumedCapacity)
+		}
+		return err
+	})
+	if err != nil {
+		store.printf("dynastore: UpdateItem failed - %v\n", err)
+		return false, wrapError(OpDelete, id, err)
+	}
+
+	for k := range out.Attributes {
+		if strings.HasPrefix(k, sessionFieldPrefix) {
+			return false, nil
+		}
+	}
+
+	err = store.withRetry(ctx, func() error {
+		input := &dynamodb.DeleteItemInput{
+			TableName:              aws.String(store.tableName),
+			Key:                    store.key(id),
+			ReturnConsumedCapacity: store.returnConsumedCapacity(),
+		}
+		store.intercept(ctx, OpDelete, input)
+		out, err := store.ddb.DeleteItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpDelete, out.ConsumedCapacity)
+		}
+		return err
+	})
+	if err != nil {
+		store.printf("dynastore: delete failed - %v\n", err)
+		return false, wrapError(OpDelete, id, err)
+	}
+	return true, nil
+}
+
+// updateItem performs input with retries, recording consumed capacity against op
+func (store *Store) updateItem(ctx context.Context, op string, input *dynamodb.UpdateItemInput) error {
+	return store.withRetry(ctx, func() error {
+		store.intercept(ctx, op, input)
+		out, err := store.ddb.UpdateItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(op, out.ConsumedCapacity)
+		}
+		return err
+	})
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/securecookie"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestSharedItem(t *testing.T) {
+	codec := securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), SharedItem(), Codecs(codec), MaxAge(3600))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// both sessions are new: they share an id assigned within the request
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	w := httptest.NewRecorder()
+	auth, _ := store.Get(req, "auth")
+	auth.Values["user"] = "joe"
+	prefs, _ := store.Get(req, "prefs")
+	prefs.Values["theme"] = "dark"
+	if auth.ID != prefs.ID {
+		t.Fatalf("expected sessions to share an id; got %v and %v", auth.ID, prefs.ID)
+	}
+	if err := auth.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := prefs.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 || cookies[0].Name != SharedCookieName {
+		t.Fatalf("expected %v cookie; got %v", SharedCookieName, cookies)
+	}
+	if v := db.Len(); v != 1 {
+		t.Fatalf("expected 1 item; got %v", v)
+	}
+	item := db.Item(auth.ID)
+	for _, name := range []string{"auth", "prefs"} {
+		if _, ok := item[sessionFieldPrefix+name].(*types.AttributeValueMemberM); !ok {
+			t.Errorf("expected %v attribute; got %#v", name, item[sessionFieldPrefix+name])
+		}
+	}
+
+	// existing sessions load from their own attribute of the shared item
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookies[0])
+	auth, err = store.Get(req, "auth")
+	if err != nil || auth.IsNew {
+		t.Fatalf("expected existing session; got %v", err)
+	}
+	prefs, err = store.Get(req, "prefs")
+	if err != nil || prefs.IsNew {
+		t.Fatalf("expected existing session; got %v", err)
+	}
+	if v := auth.Values["user"]; v != "joe" {
+		t.Errorf("expected joe; got %v", v)
+	}
+	if _, ok := auth.Values["theme"]; ok {
+		t.Error("expected sessions to be serialized independently")
+	}
+	if v := prefs.Values["theme"]; v != "dark" {
+		t.Errorf("expected dark; got %v", v)
+	}
+
+	// a session new to an existing item joins it
+	cart, _ := store.Get(req, "cart")
+	if !cart.IsNew || cart.ID != auth.ID {
+		t.Errorf("expected new session in the shared item; got %v %v", cart.IsNew, cart.ID)
+	}
+
+	// deleting one session only removes its attribute
+	auth.Options.MaxAge = -1
+	w = httptest.NewRecorder()
+	if err := auth.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := len(w.Result().Cookies()); v != 0 {
+		t.Errorf("expected cookie to be retained; got %v cookies", v)
+	}
+	item = db.Item(prefs.ID)
+	if _, ok := item[sessionFieldPrefix+"auth"]; ok {
+		t.Error("expected auth attribute to be removed")
+	}
+	if _, ok := item[sessionFieldPrefix+"prefs"]; !ok {
+		t.Error("expected prefs attribute to remain")
+	}
+
+	// deleting the last session deletes the item and cookie
+	prefs.Options.MaxAge = -1
+	w = httptest.NewRecorder()
+	if err := prefs.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := db.Len(); v != 0 {
+		t.Errorf("expected item to be deleted; got %v items", v)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != "" {
+		t.Errorf("expected cookie to be cleared; got %v", cookies)
+	}
+}
+
+func TestSharedItemTTL(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(db), SharedItem())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	long, _ := store.Get(req, "long")
+	long.Options.MaxAge = 7200
+	short, _ := store.Get(req, "short")
+	short.Options.MaxAge = 60
+
+	w := httptest.NewRecorder()
+	if err := long.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := short.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ttl, ok := db.Item(long.ID)[DefaultTTLField].(*types.AttributeValueMemberN)
+	if !ok || ttl.Value != "8200" {
+		t.Errorf("expected item to expire with the longest session; got %#v", db.Item(long.ID)[DefaultTTLField])
+	}
+
+	var updates int
+	for _, r := range db.Requests() {
+		if _, ok := r.(*dynamodb.UpdateItemInput); ok {
+			updates++
+		}
+	}
+	if updates != 3 {
+		t.Errorf("expected 3 updates; got %v", updates)
+	}
+}
+
+func TestSharedItemUnsupported(t *testing.T) {
+	for _, opt := range []Option{ValueAttributes(), WithVersioning(), SlidingExpiration(), GSI("index", "user")} {
+		if _, err := New(DynamoDB(&dynastoretest.DB{}), SharedItem(), opt); err != errSharedItemUnsupported {
+			t.Errorf("expected errSharedItemUnsupported; got %v", err)
+		}
+	}
+}
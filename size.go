@@ -0,0 +1,142 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/securecookie"
+)
+
+// DefaultMaxItemSize is the largest item DynamoDB will accept
+const DefaultMaxItemSize = 400 * 1024
+
+// ErrSessionTooLarge is returned by Save when the marshaled session exceeds the
+// maximum item size; see MaxItemSize
+type ErrSessionTooLarge struct {
+	// Size holds the computed size of the item in bytes
+	Size int
+	// Limit holds the maximum item size in bytes
+	Limit int
+}
+
+func (e ErrSessionTooLarge) Error() string {
+	return fmt.Sprintf("session of %v bytes exceeds item size limit of %v bytes", e.Size, e.Limit)
+}
+
+// ErrValueTooLong is returned by Save when the encoded session values exceed the
+// limit set by MaxLength
+type ErrValueTooLong struct {
+	// Size holds the encoded size in bytes, if known
+	Size int
+	// Limit holds the maximum encoded size in bytes, if known; codecs not limited
+	// by MaxLength apply their own default
+	Limit int
+}
+
+func (e ErrValueTooLong) Error() string {
+	size := "encoded session"
+	if e.Size > 0 {
+		size = fmt.Sprintf("encoded session of %v bytes", e.Size)
+	}
+	if e.Limit <= 0 {
+		return size + " exceeds the codec's maximum length"
+	}
+	return fmt.Sprintf("%v exceeds MaxLength of %v bytes", size, e.Limit)
+}
+
+// maxLengthCodec is implemented by codecs whose encoded length may be bounded,
+// such as *securecookie.SecureCookie
+type maxLengthCodec interface {
+	MaxLength(n int) *securecookie.SecureCookie
+}
+
+// warnItemSize reports a saved session of size bytes that exceeds WarnItemSize
+func (store *Store) warnItemSize(ctx context.Context, id string, size int) {
+	if store.warnSize <= 0 || size <= store.warnSize {
+		return
+	}
+
+	switch {
+	case store.onWarnSize != nil:
+		store.onWarnSize(id, size)
+	case store.logger != nil:
+		store.logger.WarnContext(ctx, "dynastore: large session", "table", store.tableName, "id", shortID(id), "bytes", size, "threshold", store.warnSize)
+	default:
+		store.printf("dynastore: session of %v bytes exceeds warning threshold of %v bytes\n", size, store.warnSize)
+	}
+}
+
+// itemSize approximates the size DynamoDB assigns item: the length of each
+// attribute name plus the size of its value
+func itemSize(item map[string]types.AttributeValue) int {
+	size := 0
+	for k, av := range item {
+		size += len(k) + attributeSize(av)
+	}
+	return size
+}
+
+// attributeSize approximates the stored size of av in bytes
+func attributeSize(av types.AttributeValue) int {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return numberSize(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, n := range v.Value {
+			size += numberSize(n)
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, b := range v.Value {
+			size += len(b)
+		}
+		return size
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, item := range v.Value {
+			size += 1 + attributeSize(item)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		return 3 + len(v.Value) + itemSize(v.Value)
+	default:
+		return 0
+	}
+}
+
+// numberSize returns the size of a number; DynamoDB stores two significant digits
+// per byte plus one byte of overhead
+func numberSize(n string) int {
+	digits := strings.TrimLeft(strings.NewReplacer("-", "", ".", "").Replace(n), "0")
+	return (len(digits)+1)/2 + 1
+}
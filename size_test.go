@@ -0,0 +1,240 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestItemSize(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"id":  &types.AttributeValueMemberS{Value: "abc"},
+		"ttl": &types.AttributeValueMemberN{Value: "-1234.5"},
+		"b":   &types.AttributeValueMemberB{Value: []byte{1, 2, 3, 4}},
+		"m": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"ok": &types.AttributeValueMemberBOOL{Value: true},
+		}},
+	}
+
+	// id: 2+3, ttl: 3+4, b: 1+4, m: 1+(3+1+2+1)
+	if v := itemSize(item); v != 25 {
+		t.Errorf("expected 25; got %v", v)
+	}
+}
+
+func TestSessionTooLarge(t *testing.T) {
+	testCases := map[string]struct {
+		Opts  []Option
+		Size  int
+		Limit int
+	}{
+		"default": {
+			Size:  500 * 1024,
+			Limit: DefaultMaxItemSize,
+		},
+		"budget": {
+			Opts:  []Option{MaxItemSize(16 * 1024)},
+			Size:  20 * 1024,
+			Limit: 16 * 1024,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			puts := 0
+			ddb := newTestDynamoDB(func(input interface{}) (interface{}, error) {
+				if _, ok := input.(*dynamodb.PutItemInput); ok {
+					puts++
+				}
+				return nil, nil
+			})
+
+			store, err := New(append(tc.Opts, DynamoDB(ddb))...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			session, err := store.New(req, "blah")
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			for i := 0; i*1024 < tc.Size; i++ {
+				session.Values[strconv.Itoa(i)] = strings.Repeat("x", 1024)
+			}
+
+			err = store.Save(req, httptest.NewRecorder(), session)
+			var tooLarge ErrSessionTooLarge
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("expected ErrSessionTooLarge; got %v", err)
+			}
+			if tooLarge.Limit != tc.Limit {
+				t.Errorf("expected limit %v; got %v", tc.Limit, tooLarge.Limit)
+			}
+			if tooLarge.Size <= tc.Limit {
+				t.Errorf("expected size over %v; got %v", tc.Limit, tooLarge.Size)
+			}
+			if puts != 0 {
+				t.Errorf("expected no PutItem; got %v", puts)
+			}
+		})
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	newCodec := func() securecookie.Codec {
+		return securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	}
+
+	testCases := map[string]struct {
+		opts    []Option
+		tooLong bool
+	}{
+		"codec default": {opts: []Option{Codecs(newCodec())}, tooLong: true},
+		"codec 4096":    {opts: []Option{Codecs(newCodec()), MaxLength(4096)}, tooLong: true},
+		"codec 0":       {opts: []Option{Codecs(newCodec()), MaxLength(0)}},
+		"gob 4096":      {opts: []Option{MaxLength(4096)}, tooLong: true},
+		"gob 0":         {opts: []Option{MaxLength(0)}},
+		"json 4096":     {opts: []Option{JSON(), MaxLength(4096)}, tooLong: true},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			store, err := New(append(tc.opts, DynamoDB(db))...)
+			if err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			for i := 0; i < 100; i++ {
+				session.Values["key"+strconv.Itoa(i)] = strings.Repeat("x", 100)
+			}
+
+			err = store.save(context.Background(), "blah", session)
+			if !tc.tooLong {
+				if err != nil {
+					t.Fatalf("expected nil; got %v", err)
+				}
+				return
+			}
+
+			var tooLong ErrValueTooLong
+			if !errors.As(err, &tooLong) {
+				t.Fatalf("expected ErrValueTooLong; got %v", err)
+			}
+			if tooLong.Size <= 10000 {
+				t.Errorf("expected size over 10000; got %v", tooLong.Size)
+			}
+			if label == "codec default" {
+				return
+			}
+			if tooLong.Limit != 4096 {
+				t.Errorf("expected limit 4096; got %v", tooLong.Limit)
+			}
+			if msg := err.Error(); !strings.Contains(msg, "4096") || !strings.Contains(msg, strconv.Itoa(tooLong.Size)) {
+				t.Errorf("expected message to state the limit and size; got %v", msg)
+			}
+		})
+	}
+}
+
+func TestWarnItemSize(t *testing.T) {
+	db := &dynastoretest.DB{}
+
+	var warned []int
+	store, err := New(DynamoDB(db), WarnItemSize(300, func(id string, size int) {
+		if id != "abc" {
+			t.Errorf("expected abc; got %v", id)
+		}
+		warned = append(warned, size)
+	}), PromoteAttributes("plan"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["plan"] = "pro"
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if len(warned) != 0 {
+		t.Fatalf("expected no warning; got %v", warned)
+	}
+
+	small := itemSize(db.Item("abc"))
+	stats := store.Stats().SavedItemSizes
+	if stats.Count != 1 || stats.Min != small || stats.Max != small || stats.Avg != small {
+		t.Errorf("expected 1 save of %v bytes; got %+v", small, stats)
+	}
+
+	// the promoted attribute alone exceeds the threshold
+	session.Values["plan"] = strings.Repeat("x", 300)
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	item := db.Item("abc")
+	if _, ok := item["plan"]; !ok {
+		t.Fatal("expected promoted plan attribute")
+	}
+	if _, ok := item[DefaultTTLField]; !ok {
+		t.Fatal("expected ttl attribute")
+	}
+	large := itemSize(item)
+	if len(warned) != 1 || warned[0] != large {
+		t.Fatalf("expected warning of %v bytes; got %v", large, warned)
+	}
+
+	stats = store.Stats().SavedItemSizes
+	if stats.Count != 2 || stats.Min != small || stats.Max != large || stats.Avg != (small+large)/2 {
+		t.Errorf("expected 2 saves between %v and %v bytes; got %+v", small, large, stats)
+	}
+
+	if _, err := New(DynamoDB(db), WarnItemSize(0, nil)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	if v := summarize(nil); v != (SizeSummary{}) {
+		t.Errorf("expected zero summary; got %+v", v)
+	}
+	if v := summarize([]int{30, 10, 20}); v != (SizeSummary{Count: 3, Min: 10, Max: 30, Avg: 20}) {
+		t.Errorf("expected 3 sizes of 10 to 30; got %+v", v)
+	}
+
+	store := &Store{warnSize: 1}
+	for i := 0; i < sizeWindow+5; i++ {
+		store.recordSaveSize(i)
+	}
+	if v := store.Stats().SavedItemSizes; v.Count != sizeWindow || v.Min != 5 || v.Max != sizeWindow+4 {
+		t.Errorf("expected the last %v saves; got %+v", sizeWindow, v)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// fingerprint summarizes the values and options of session so Save can detect
+// sessions that have not changed since they were loaded.  Values are written in
+// key order in a canonical form, see writeCanonical; values that cannot be
+// written yield nil, which never matches.
+func fingerprint(session *sessions.Session) []byte {
+	var (
+		keys   = make([]string, 0, len(session.Values))
+		values = map[string]interface{}{}
+	)
+	for k, v := range session.Values {
+		key := fmt.Sprintf("%#v", k)
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		io.WriteString(h, key)
+		if !writeCanonical(h, reflect.ValueOf(values[key]), 0) {
+			return nil
+		}
+	}
+	if session.Options != nil {
+		fmt.Fprintf(h, "%#v", *session.Options)
+	}
+
+	return h.Sum(nil)
+}
+
+// maxCanonicalDepth bounds the nesting writeCanonical follows, e.g. through
+// cyclic pointers
+const maxCanonicalDepth = 64
+
+// writeCanonical writes v and its type to w such that equal values are always
+// written identically; unlike gob, map entries are written in key order.  Values
+// implementing encoding.BinaryMarshaler, such as time.Time, are written as
+// marshaled.  False is returned for values that cannot be written, such as funcs
+// and channels.
+func writeCanonical(w io.Writer, v reflect.Value, depth int) bool {
+	if depth > maxCanonicalDepth {
+		return false
+	}
+	if !v.IsValid() {
+		io.WriteString(w, "nil;")
+		return true
+	}
+
+	fmt.Fprintf(w, "%v:", v.Type())
+	if v.CanInterface() {
+		if m, ok := v.Interface().(encoding.BinaryMarshaler); ok && (v.Kind() != reflect.Pointer || !v.IsNil()) {
+			data, err := m.MarshalBinary()
+			if err != nil {
+				return false
+			}
+			fmt.Fprintf(w, "%q;", data)
+			return true
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		fmt.Fprintf(w, "%v;", v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(w, "%v;", v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		fmt.Fprintf(w, "%v;", v.Uint())
+	case reflect.Float32, reflect.Float64:
+		fmt.Fprintf(w, "%v;", v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		fmt.Fprintf(w, "%v;", v.Complex())
+	case reflect.String:
+		fmt.Fprintf(w, "%q;", v.String())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			io.WriteString(w, "nil;")
+			return true
+		}
+		return writeCanonical(w, v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			io.WriteString(w, "nil;")
+			return true
+		}
+		fmt.Fprintf(w, "%v[", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if !writeCanonical(w, v.Index(i), depth+1) {
+				return false
+			}
+		}
+		io.WriteString(w, "];")
+	case reflect.Map:
+		type entry struct {
+			key   string
+			value reflect.Value
+		}
+		entries := make([]entry, 0, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			var key bytes.Buffer
+			if !writeCanonical(&key, iter.Key(), depth+1) {
+				return false
+			}
+			entries = append(entries, entry{key: key.String(), value: iter.Value()})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+		fmt.Fprintf(w, "%v{", len(entries))
+		for _, e := range entries {
+			io.WriteString(w, e.key)
+			if !writeCanonical(w, e.value, depth+1) {
+				return false
+			}
+		}
+		io.WriteString(w, "};")
+	case reflect.Struct:
+		io.WriteString(w, "{")
+		for i := 0; i < v.NumField(); i++ {
+			if !writeCanonical(w, v.Field(i), depth+1) {
+				return false
+			}
+		}
+		io.WriteString(w, "};")
+	default:
+		return false
+	}
+	return true
+}
+
+// slide extends the ttl of an unchanged session without rewriting it.  False is
+// returned when the session must be saved in full.
+func (store *Store) slide(ctx context.Context, session *sessions.Session) (bool, error) {
+	if (!store.sliding && store.idleTimeout == 0) || session.IsNew {
+		return false, nil
+	}
+	expiresAt := store.expiresAt(session)
+	if expiresAt.IsZero() {
+		return false, nil
+	}
+
+	st, ok := lookupState(session)
+	if !ok || st.legacy || st.fingerprint == nil || !bytes.Equal(st.fingerprint, fingerprint(session)) {
+		return false, nil
+	}
+
+	now := store.now()
+	if store.touchWindow > 0 && !store.touchCache.claim(session.ID, now, now.Add(-store.touchWindow)) {
+		return true, nil
+	}
+
+	if err := store.touch(ctx, session.ID, strconv.FormatInt(expiresAt.Unix(), 10)); err != nil {
+		if store.touchWindow > 0 {
+			store.touchCache.release(session.ID)
+		}
+		if isConditionalCheckFailed(err) {
+			// the item has gone; write it again in full
+			return false, nil
+		}
+		return false, err
+	}
+	st.expiresAt = expiresAt
+
+	return true, nil
+}
+
+// Touch extends the ttl of the session with the given id to now plus the default
+// MaxAge without rewriting the session.  The ttl is capped by IdleTimeout and
+// AbsoluteTimeout; the latter requires reading the creation time of the session.
+// ErrNoExpiry is returned when the store has no ttl field or no default MaxAge.
+func (store *Store) Touch(ctx context.Context, id string) error {
+	if store.ttlField == "" || store.options.MaxAge <= 0 {
+		return ErrNoExpiry
+	}
+
+	expiresAt, err := store.capExpiry(ctx, id, store.now().Add(time.Duration(store.options.MaxAge)*time.Second))
+	if err != nil {
+		return err
+	}
+	err = store.touch(ctx, id, strconv.FormatInt(expiresAt.Unix(), 10))
+	if isConditionalCheckFailed(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// pruneTouches periodically forgets sessions touched outside the dedup window
+// until Close is called
+func (store *Store) pruneTouches() {
+	ticker := time.NewTicker(store.touchWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			store.touchCache.prune(store.now().Add(-store.touchWindow))
+		case <-store.done:
+			return
+		}
+	}
+}
+
+// Close stops the background work started by the store and waits for pending
+// quarantines to finish.  The DynamoDB client is not closed.  Close may be called
+// more than once.
+func (store *Store) Close() error {
+	store.closeOnce.Do(func() {
+		if store.done != nil {
+			close(store.done)
+		}
+	})
+	store.quarantines.wg.Wait()
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestSlidingExpiration(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(db), SlidingExpiration(), MaxAge(60))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	defer store.Close()
+	store.now = func() time.Time { return now }
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["user"] = "joe"
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	request := func() *http.Request {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(cookie)
+		return req
+	}
+	last := func() interface{} {
+		requests := db.Requests()
+		return requests[len(requests)-1]
+	}
+
+	// an unchanged session only has its ttl extended
+	now = now.Add(time.Minute)
+	req = request()
+	session, _ = store.Get(req, "blah")
+	w = httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	input, ok := last().(*dynamodb.UpdateItemInput)
+	if !ok {
+		t.Fatalf("expected UpdateItem; got %T", last())
+	}
+	if v := aws.ToString(input.UpdateExpression); v != "SET #ttl = :ttl" {
+		t.Errorf("expected only the ttl to be set; got %v", v)
+	}
+	if v := len(input.ExpressionAttributeValues); v != 1 {
+		t.Errorf("expected 1 value; got %v", v)
+	}
+	if v, err := store.TTLRemaining(context.Background(), session.ID); err != nil || v != time.Minute {
+		t.Errorf("expected 1m remaining; got %v %v", v, err)
+	}
+
+	// the cookie is reissued to expire with the ttl
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected the cookie to be reissued; got %v", cookies)
+	}
+	if v := cookies[0].MaxAge; v != 60 {
+		t.Errorf("expected MaxAge 60; got %v", v)
+	}
+	if v := cookies[0].Expires; !v.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected cookie to expire at %v; got %v", now.Add(time.Minute), v)
+	}
+
+	// a changed session is written in full
+	req = request()
+	session, _ = store.Get(req, "blah")
+	session.Values["user"] = "jane"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, ok := last().(*dynamodb.PutItemInput); !ok {
+		t.Errorf("expected PutItem; got %T", last())
+	}
+
+	// a session deleted since it was loaded is written in full
+	req = request()
+	session, _ = store.Get(req, "blah")
+	if err := store.delete(context.Background(), session.ID); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := db.Len(); v != 1 {
+		t.Errorf("expected 1 item; got %v", v)
+	}
+}
+
+func TestSlidingExpirationDedup(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), SlidingExpiration(), MaxAge(60), TouchDedupWindow(time.Minute))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(w.Result().Cookies()[0])
+		session, _ := store.Get(req, "blah")
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+
+	updates := 0
+	for _, req := range db.Requests() {
+		if _, ok := req.(*dynamodb.UpdateItemInput); ok {
+			updates++
+		}
+	}
+	if updates != 1 {
+		t.Errorf("expected 1 UpdateItem; got %v", updates)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), MaxAge(60))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	now := time.Unix(1000, 0)
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if err := store.Touch(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	now = now.Add(30 * time.Second)
+	if err := store.Touch(ctx, session.ID); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v, err := store.TTLRemaining(ctx, session.ID); err != nil || v != time.Minute {
+		t.Errorf("expected 1m remaining; got %v %v", v, err)
+	}
+
+	noExpiry, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := noExpiry.Touch(ctx, session.ID); err != ErrNoExpiry {
+		t.Errorf("expected ErrNoExpiry; got %v", err)
+	}
+}
+
+func TestTouchAbsoluteTimeout(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), MaxAge(3600), AbsoluteTimeout(2*time.Minute))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	now := time.Unix(1000, 0)
+	store.now = func() time.Time { return now }
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	now = now.Add(time.Minute)
+	if err := store.Touch(ctx, session.ID); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v, err := store.TTLRemaining(ctx, session.ID); err != nil || v != time.Minute {
+		t.Errorf("expected 1m remaining; got %v %v", v, err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+	"weak"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// states holds the bookkeeping of each session, keyed by a weak pointer to the
+// session so that it is kept out of session.Values, which applications may encode
+// themselves, and discarded once the session is garbage collected
+var states sync.Map // weak.Pointer[sessions.Session] -> *sessionState
+
+// sessionState holds what the store learned about a session when it was loaded
+type sessionState struct {
+	// version holds the item version observed at load or last save
+	version int64
+
+	// unsignedCookie is set when the session was found via a legacy unsigned cookie
+	unsignedCookie bool
+
+	// fingerprint summarizes the session as loaded; see SlidingExpiration
+	fingerprint []byte
+
+	// expiresAt holds the item ttl observed at load or last save; see SkipUnchanged
+	expiresAt time.Time
+
+	// force is set by ForceSave
+	force bool
+
+	// unprefixed is set when the session was read from an item written before
+	// KeyPrefix was configured; see FallbackToUnprefixed
+	unprefixed bool
+
+	// legacy is set when the session was decoded from the layout written by the
+	// original dynastore; see DisableLegacyFallback
+	legacy bool
+
+	// partial is set when the session was read by LoadPartial
+	partial bool
+
+	// createdAt holds when the session was first saved
+	createdAt time.Time
+
+	// options holds the session options as loaded or last sent in a cookie when
+	// they differ from the store defaults
+	options *sessions.Options
+
+	// managed is set when the session is saved by Middleware
+	managed bool
+
+	// savedAs summarizes a managed session as last saved in the request so
+	// Middleware need not save it again; see fingerprint
+	savedAs []byte
+}
+
+// stateOf returns the bookkeeping for session, creating it if necessary
+func stateOf(session *sessions.Session) *sessionState {
+	key := weak.Make(session)
+	if st, ok := states.Load(key); ok {
+		return st.(*sessionState)
+	}
+
+	st, loaded := states.LoadOrStore(key, &sessionState{})
+	if !loaded {
+		runtime.AddCleanup(session, func(key weak.Pointer[sessions.Session]) {
+			states.Delete(key)
+		}, key)
+	}
+	return st.(*sessionState)
+}
+
+// lookupState returns the bookkeeping for session, if any
+func lookupState(session *sessions.Session) (*sessionState, bool) {
+	st, ok := states.Load(weak.Make(session))
+	if !ok {
+		return nil, false
+	}
+	return st.(*sessionState), true
+}
+
+// resetState discards the bookkeeping for session, e.g. before it is loaded
+func resetState(session *sessions.Session) {
+	if st, ok := lookupState(session); ok {
+		*st = sessionState{}
+	}
+}
+
+// marshal serializes session using the configured serializer
+func (store *Store) marshal(ctx context.Context, name string, session *sessions.Session) (map[string]types.AttributeValue, error) {
+	var (
+		av  map[string]types.AttributeValue
+		err error
+	)
+	if store.valueAttributes {
+		av, err = store.marshalValues(name, session)
+	} else {
+		av, err = store.serializer.marshal(name, session)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if store.maxLength > 0 {
+		if size := attributeSize(av[valuesField]); size > store.maxLength {
+			store.printf("dynastore: encoded session of %v bytes exceeds MaxLength of %v bytes\n", size, store.maxLength)
+			return nil, ErrValueTooLong{Size: size, Limit: store.maxLength}
+		}
+	}
+
+	if store.encryption != nil {
+		if err := store.encrypt(ctx, av); err != nil {
+			return nil, err
+		}
+	}
+
+	if store.keyPrefix != "" || store.keyDeriver != nil || store.sortKey != "" {
+		for k, v := range store.key(session.ID) {
+			av[k] = v
+		}
+	}
+	return av, nil
+}
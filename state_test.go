@@ -0,0 +1,97 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestVersioning(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), WithVersioning())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	ctx := context.Background()
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["hello"] = "world"
+
+	// repeated saves of the same session succeed
+	for i := 0; i < 2; i++ {
+		if err := store.save(ctx, "blah", session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+	if v := db.Item("abc")[versionField].(*types.AttributeValueMemberN).Value; v != "2" {
+		t.Errorf("expected version 2; got %v", v)
+	}
+
+	a := sessions.NewSession(store, "blah")
+	b := sessions.NewSession(store, "blah")
+	for _, s := range []*sessions.Session{a, b} {
+		if err := store.load(ctx, "blah", "abc", s); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		s.ID = "abc"
+		s.Options = &sessions.Options{MaxAge: 60}
+	}
+
+	a.Values["hello"] = "a"
+	if err := store.save(ctx, "blah", a); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	b.Values["hello"] = "b"
+	if err := store.save(ctx, "blah", b); err != ErrVersionConflict {
+		t.Errorf("expected ErrVersionConflict; got %v", err)
+	}
+
+	restored := sessions.NewSession(store, "blah")
+	if err := store.load(ctx, "blah", "abc", restored); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := restored.Values["hello"]; v != "a" {
+		t.Errorf("expected first writer to win; got %v", v)
+	}
+}
+
+func TestVersioningDisabled(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 60}
+	if err := store.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, ok := db.Item("abc")[versionField]; ok {
+		t.Error("expected no version attribute")
+	}
+	if _, ok := lookupState(session); ok {
+		t.Error("expected no state to be attached")
+	}
+}
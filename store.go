@@ -15,18 +15,22 @@
 package dynastore
 
 import (
+	"compress/gzip"
 	"context"
-	"encoding/base32"
 	"errors"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 )
@@ -37,31 +41,173 @@ const (
 
 	// DefaultTTLField contains the default name of the ttl field
 	DefaultTTLField = "ttl"
+
+	// DefaultPrimaryKey contains the default name of the table's hash key
+	DefaultPrimaryKey = "id"
 )
 
 const (
-	idField      = "id"
 	valuesField  = "values"
 	optionsField = "options"
+
+	// quarantinedField marks items that could not be decoded
+	quarantinedField = "quarantined"
+
+	// versionField holds the item version when versioning is enabled
+	versionField = "version"
+
+	// nameField holds the session name so items can be decoded without a request
+	nameField = "name"
 )
 
+// reservedKeyPrefix marks session.Values keys that are managed by dynastore itself
+const reservedKeyPrefix = "dynastore."
+
+// isReservedKey returns true if key is managed by dynastore rather than the application
+func isReservedKey(key string) bool {
+	return strings.HasPrefix(key, reservedKeyPrefix)
+}
+
 var (
-	errNotFound         = errors.New("session not found")
-	errMalformedSession = errors.New("malformed session data")
-	errEncodeFailed     = errors.New("failed to encode data")
-	errDecodeFailed     = errors.New("failed to decode data")
+	// ErrNotFound indicates the session does not exist or has expired
+	ErrNotFound = errors.New("session not found")
+
+	// ErrMalformedSession indicates the stored item is missing required attributes
+	ErrMalformedSession = errors.New("malformed session data")
+
+	// ErrEncodeFailed indicates the session values could not be serialized
+	ErrEncodeFailed = errors.New("failed to encode data")
+
+	// ErrDecodeFailed indicates the stored session values could not be deserialized
+	ErrDecodeFailed = errors.New("failed to decode data")
+
+	// ErrVersionConflict is returned by Save when versioning is enabled and the
+	// session was modified by another writer since it was loaded
+	ErrVersionConflict = errors.New("session was modified concurrently")
+
+	// ErrReadOnlyStore is returned by operations that would write to DynamoDB when
+	// the store was created with ReadOnly
+	ErrReadOnlyStore = errors.New("store is read only")
 )
 
+// isConditionalCheckFailed returns true if err indicates a condition expression was not met
+func isConditionalCheckFailed(err error) bool {
+	var ccf *types.ConditionalCheckFailedException
+	return errors.As(err, &ccf)
+}
+
+// DynamoDBAPI is the subset of the DynamoDB client used by Store.  *dynamodb.Client
+// satisfies DynamoDBAPI; see the dynastoretest package for an in-memory fake.
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
 // Store provides an implementation of the gorilla sessions.Store interface backed by DynamoDB
 type Store struct {
 	tableName  string
+	primaryKey string
+	sortKey    string
+	sortValue  string
 	ttlField   string
 	codecs     []securecookie.Codec
 	config     *aws.Config
-	ddb        *dynamodb.DynamoDB
+	endpoint   string
+	ddb        DynamoDBAPI
 	serializer serializer
-	options    sessions.Options
-	printf     func(format string, args ...interface{})
+
+	// reads, when set, serves loads in place of ddb; see ReadClient
+	reads         DynamoDBAPI
+	eventualReads bool
+	options       sessions.Options
+	printf        func(format string, args ...interface{})
+	now           func() time.Time
+
+	domainResolver  func(host string) (string, bool)
+	cookiePolicy    CookiePolicyFunc
+	activityLimit   int
+	quarantineTTL   time.Duration
+	quarantineLimit int
+	quarantines     quarantineLimiter
+
+	maxSessionNames int
+	allowedNames    map[string]struct{}
+
+	touchConcurrency int
+	touchRate        int
+	touchWindow      time.Duration
+	touchCache       touchCache
+
+	principalKey    string
+	gsiIndex        string
+	gsiAttribute    string
+	versioning      bool
+	valueAttributes bool
+	requestTimeout  time.Duration
+	unsignedCookies bool
+	jsonValues      bool
+	msgpackValues   bool
+	disableLegacy   bool
+	encryption      EncryptionProvider
+	alwaysSetCookie bool
+	ignoreOptions   bool
+	maxValues       int
+	reservedKeys    map[string]struct{}
+
+	compress         bool
+	compressionLevel int
+
+	maxItemSize int
+	warnSize    int
+	onWarnSize  func(id string, size int)
+	maxLength   int
+	sharedItem  bool
+
+	requestCache bool
+	readOnly     bool
+	failOpen     bool
+
+	logger *slog.Logger
+
+	tombstoneGrace time.Duration
+
+	createTableTimeout time.Duration
+
+	sliding       bool
+	skipUnchanged bool
+	done          chan struct{}
+	closeOnce     sync.Once
+	saving        saveLocks
+
+	keyPrefix          string
+	fallbackUnprefixed bool
+	keyDeriver         KeyDeriverFunc
+
+	retryAttempts int
+	retryBase     time.Duration
+	onRetry       func(attempt int, err error)
+
+	parallelism int
+
+	promoted        []string
+	trackCreation   bool
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+
+	hooks        Hooks
+	interceptor  RequestInterceptorFunc
+	collectStats bool
+	stats        stats
+
+	idGenerator func() string
+
+	// opts holds the options the store was created with; see WithOptions
+	opts       []Option
+	optionErrs []error
 }
 
 // Get should return a cached session.
@@ -73,53 +219,269 @@ func (store *Store) Get(req *http.Request, name string) (*sessions.Session, erro
 //
 // Note that New should never return a nil session, even in the case of
 // an error if using the Registry infrastructure to cache the session.
+//
+// A new session is returned when the cookie refers to a session that is missing,
+// expired or cannot be decoded.  When the request holds several cookies with the
+// session name, e.g. set with different paths, the first that loads is used.  When the session cannot be read, e.g. because
+// DynamoDB is throttling or the table is missing, the new session is returned
+// along with the error unless FailOpen is set.
 func (store *Store) New(req *http.Request, name string) (*sessions.Session, error) {
-	if cookie, errCookie := req.Cookie(name); errCookie == nil {
+	return store.NewCtx(store.contextFor(req), req, name)
+}
+
+func (store *Store) newSession(ctx context.Context, req *http.Request, name string) (*sessions.Session, error) {
+	if err := store.checkName(req, name); err != nil {
+		return sessions.NewSession(store, name), err
+	}
+
+	var (
+		cookieID string
+		loadErr  error
+		attempts int
+	)
+	for _, cookie := range req.Cookies() {
+		if attempts == maxCookieAttempts {
+			break
+		}
+		if cookie.Name != store.cookieName(name) {
+			continue
+		}
+		id, ok := store.decodeCookie(store.cookieName(name), cookie.Value)
+		if !ok {
+			continue
+		}
+		if cookieID == "" {
+			cookieID = id
+		}
+		if s, ok := store.cached(req, name, id); ok {
+			return s, nil
+		}
+
+		attempts++
 		s := sessions.NewSession(store, name)
-		err := store.load(req.Context(), name, cookie.Value, s)
+		s.Options = store.newOptions(req) // used when the item holds no options
+		err := store.load(ctx, name, id, s)
 		if err == nil {
+			if store.ignoreOptions {
+				s.Options = store.newOptions(req)
+			} else {
+				store.cookieScope(req, s.Options, store.options)
+			}
+			store.applyPolicy(req, s)
+			if id == cookie.Value && len(store.codecs) > 0 {
+				// reissue legacy unsigned cookies on the next Save
+				stateOf(s).unsignedCookie = true
+			}
+			store.cache(req, s)
 			return s, nil
 		}
+		if !store.failOpen && !itemError(err) && loadErr == nil {
+			loadErr = err
+		}
 	}
 
 	s := sessions.NewSession(store, name)
-	s.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	s.ID = store.requestID(req, cookieID)
 	s.IsNew = true
-	s.Options = &sessions.Options{
-		Path:     store.options.Path,
-		Domain:   store.options.Domain,
-		MaxAge:   store.options.MaxAge,
-		Secure:   store.options.Secure,
-		HttpOnly: store.options.HttpOnly,
+	s.Options = store.newOptions(req)
+	store.applyPolicy(req, s)
+
+	if !validCookieValue(s.ID) {
+		store.printf("dynastore: generated session id is not a valid cookie value\n")
+		return s, ErrInvalidSessionID
 	}
 
-	return s, nil
+	return s, loadErr
 }
 
-// Save should persist session to the underlying store implementation.
+// newOptions returns the store default options for a session of req
+func (store *Store) newOptions(req *http.Request) *sessions.Options {
+	return &sessions.Options{
+		Path:        store.options.Path,
+		Domain:      store.cookieDomain(req, store.options.Domain),
+		MaxAge:      store.options.MaxAge,
+		Secure:      store.options.Secure,
+		HttpOnly:    store.options.HttpOnly,
+		SameSite:    store.options.SameSite,
+		Partitioned: store.options.Partitioned,
+	}
+}
+
+// Save should persist session to the underlying store implementation.  Saves of
+// the same session from concurrent goroutines are serialized, and only the first
+// successful save of a new session sets its cookie.
 func (store *Store) Save(req *http.Request, w http.ResponseWriter, session *sessions.Session) error {
-	err := store.save(req.Context(), session.Name(), session)
-	if err != nil {
+	return store.SaveCtx(store.contextFor(req), req, w, session)
+}
+
+func (store *Store) saveSession(ctx context.Context, req *http.Request, w http.ResponseWriter, session *sessions.Session) (err error) {
+	unlock := store.saving.lock(session)
+	defer unlock()
+	defer func() {
+		if err == nil || err == ErrHeadersSent {
+			store.rememberSaved(session)
+		}
+	}()
+
+	if store.readOnly {
+		return ErrReadOnlyStore
+	}
+	if !validCookieValue(session.ID) {
+		store.printf("dynastore: session id is not a valid cookie value\n")
+		return ErrInvalidSessionID
+	}
+	store.applyPolicy(req, session)
+	if err := checkCookieOptions(session.Name(), session.Options); err != nil {
+		store.printf("dynastore: %v\n", err)
 		return err
 	}
+	store.uncache(req, session)
 
 	if session.Options != nil && session.Options.MaxAge < 0 {
-		cookie := newCookie(session, session.Name(), "")
-		http.SetCookie(w, cookie)
-		return store.delete(req.Context(), session.ID)
+		if store.sharedItem {
+			// the cookie is retained while other sessions remain in the item
+			deleted, err := store.deleteShared(ctx, session.ID, session.Name())
+			if err != nil || !deleted {
+				return err
+			}
+		}
+		store.cookieScope(req, session.Options, store.sentOptions(session))
+		cookie := newCookie(session, store.cookieName(session.Name()), "", store.now())
+		cookieErr := store.setCookie(w, cookie)
+		if store.sharedItem {
+			return cookieErr
+		}
+		if err := store.delete(ctx, session.ID); err != nil {
+			return err
+		}
+		return cookieErr
+	}
+
+	store.recordActivity(req, session)
+
+	extended := false
+	if !store.unchanged(session) {
+		slid, err := store.slide(ctx, session)
+		if err != nil {
+			return err
+		}
+		if !slid {
+			if err := store.save(ctx, session.Name(), session); err != nil {
+				return err
+			}
+		}
+		// the cookie must follow the ttl or the browser drops an active session
+		extended = store.sliding && session.Options != nil && session.Options.MaxAge > 0
 	}
 
-	if !session.IsNew {
+	if !session.IsNew && !extended && !store.reissueCookie(session) && !store.optionsChanged(session) {
 		// no need to set cookies if they already exist
 		return nil
 	}
 
-	cookie := newCookie(session, session.Name(), session.ID)
+	if session.Options != nil && session.Options.Domain == "" {
+		session.Options.Domain = store.cookieDomain(req, "")
+	}
+
+	value, err := store.encodeCookie(store.cookieName(session.Name()), session.ID)
+	if err != nil {
+		return err
+	}
+
+	cookie := newCookie(session, store.cookieName(session.Name()), value, store.now())
+	if err := store.setCookie(w, cookie); err != nil {
+		return err
+	}
+	store.rememberOptions(session)
+	session.IsNew = false // later saves need not set the cookie again
+	return nil
+}
+
+// rememberSaved records the saved form of a session managed by Middleware
+func (store *Store) rememberSaved(session *sessions.Session) {
+	if st, ok := lookupState(session); ok && st.managed {
+		st.savedAs = fingerprint(session)
+	}
+}
+
+// reissueCookie returns true if the session was loaded from a legacy unsigned
+// cookie that should be replaced with a signed one
+func (store *Store) reissueCookie(session *sessions.Session) bool {
+	st, ok := lookupState(session)
+	if !ok || !st.unsignedCookie {
+		return false
+	}
+	st.unsignedCookie = false
+	return true
+}
+
+// optionsChanged returns true if the session options differ from those the session
+// was loaded with, or AlwaysSetCookie is set, so the cookie must be reissued
+func (store *Store) optionsChanged(session *sessions.Session) bool {
+	if store.alwaysSetCookie {
+		return true
+	}
+
+	if session.Options == nil {
+		return false
+	}
+
+	return store.sentOptions(session) != *session.Options
+}
+
+// sentOptions returns the options the client's cookie was last sent with; see
+// rememberOptions
+func (store *Store) sentOptions(session *sessions.Session) sessions.Options {
+	if st, ok := lookupState(session); ok && st.options != nil {
+		return *st.options
+	}
+	return store.options
+}
+
+// cookieScope fills the Path and Domain missing from opts from fallback.  Browsers
+// only replace or clear a cookie whose Path and Domain match those it was set with,
+// so sessions loaded from items persisted without them, or whose Options are
+// replaced wholesale to log out, would otherwise leave the original cookie behind.
+func (store *Store) cookieScope(req *http.Request, opts *sessions.Options, fallback sessions.Options) {
+	if opts == nil {
+		return
+	}
+	if opts.Path == "" {
+		opts.Path = fallback.Path
+	}
+	if opts.Domain == "" {
+		opts.Domain = store.cookieDomain(req, fallback.Domain)
+	}
+}
+
+// rememberOptions records the options the client's cookie reflects so changes can
+// be detected by optionsChanged.  Options matching the store defaults, the common
+// case, are implied rather than recorded.
+func (store *Store) rememberOptions(session *sessions.Session) {
+	if session.Options == nil || *session.Options == store.options {
+		if st, ok := lookupState(session); ok {
+			st.options = nil
+		}
+		return
+	}
+
+	opts := *session.Options
+	stateOf(session).options = &opts
+}
+
+// setCookie adds cookie to the response.  ErrHeadersSent is returned, and logged,
+// when w is known to have sent its headers already; see ResponseWriter.
+func (store *Store) setCookie(w http.ResponseWriter, cookie *http.Cookie) error {
+	if headersSent(w) {
+		store.printf("dynastore: headers already sent; unable to set cookie, %v\n", cookie.Name)
+		return ErrHeadersSent
+	}
 	http.SetCookie(w, cookie)
 	return nil
 }
 
-func newCookie(session *sessions.Session, name, value string) *http.Cookie {
+// newCookie returns the cookie for session; Expires is computed relative to now
+func newCookie(session *sessions.Session, name, value string, now time.Time) *http.Cookie {
 	cookie := &http.Cookie{
 		Name:  name,
 		Value: value,
@@ -131,138 +493,486 @@ func newCookie(session *sessions.Session, name, value string) *http.Cookie {
 		cookie.MaxAge = opts.MaxAge
 		cookie.HttpOnly = opts.HttpOnly
 		cookie.Secure = opts.Secure
+		cookie.SameSite = opts.SameSite
+		cookie.Partitioned = opts.Partitioned
+
+		// Expires is set for older browsers that ignore Max-Age
+		if opts.MaxAge > 0 {
+			cookie.Expires = now.Add(time.Duration(opts.MaxAge) * time.Second)
+		} else if opts.MaxAge < 0 {
+			cookie.Expires = time.Unix(1, 0)
+		}
 	}
 
 	return cookie
 }
 
+// NewFromConfig instantiates a new Store using a DynamoDB client created from cfg
+// and the given table.  It is equivalent to New with AWSConfig and TableName
+// followed by opts.  ctx is not currently used.
+func NewFromConfig(ctx context.Context, cfg aws.Config, tableName string, opts ...Option) (*Store, error) {
+	return New(append([]Option{AWSConfig(cfg), TableName(tableName)}, opts...)...)
+}
+
 // New instantiates a new Store that implements gorilla's sessions.Store interface
 func New(opts ...Option) (*Store, error) {
 	store := &Store{
-		tableName: DefaultTableName,
-		ttlField:  DefaultTTLField,
-		printf:    func(format string, args ...interface{}) {},
+		tableName:       DefaultTableName,
+		primaryKey:      DefaultPrimaryKey,
+		ttlField:        DefaultTTLField,
+		printf:          func(format string, args ...interface{}) {},
+		now:             time.Now,
+		maxSessionNames: DefaultMaxSessionsPerRequest,
+		maxItemSize:     DefaultMaxItemSize,
+		maxLength:       -1,
+		opts:            append([]Option(nil), opts...),
 	}
 
 	for _, opt := range opts {
 		opt(store)
 	}
 
-	if store.ddb == nil {
+	for name := range store.allowedNames {
+		if err := checkCookieOptions(name, &store.options); err != nil {
+			return nil, err
+		}
+	}
+
+	if store.encryption != nil && (store.jsonValues || store.valueAttributes) {
+		return nil, errEncryptionUnsupported
+	}
+
+	if store.sharedItem && (store.valueAttributes || store.versioning || store.sliding || store.gsiIndex != "" || store.fallbackUnprefixed || store.tombstoneGrace > 0 || store.trackCreation || store.idleTimeout > 0) {
+		return nil, errSharedItemUnsupported
+	}
+
+	// Codecs may follow MaxAge, SessionOptions or MaxLength
+	store.configureCodecs()
+
+	if (store.sliding || store.idleTimeout > 0) && store.touchWindow > 0 {
+		store.done = make(chan struct{})
+		go store.pruneTouches()
+	}
+
+	if store.compress {
+		if _, err := gzip.NewWriterLevel(io.Discard, store.compressionLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	if store.ddb == nil && len(store.optionErrs) == 0 {
 		if store.config == nil {
 			region := os.Getenv("AWS_DEFAULT_REGION")
 			if region == "" {
 				region = os.Getenv("AWS_REGION")
 			}
 
-			store.config = &aws.Config{Region: aws.String(region)}
+			var opts []func(*config.LoadOptions) error
+			if region != "" {
+				opts = append(opts, config.WithRegion(region))
+			}
+
+			cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+			if err != nil {
+				return nil, err
+			}
+			store.config = &cfg
+		}
+		if store.config.Region == "" {
+			return nil, errNoRegion
 		}
 
-		s, err := session.NewSession(store.config)
-		if err != nil {
-			return nil, err
+		var optFns []func(*dynamodb.Options)
+		if store.endpoint != "" {
+			optFns = append(optFns, func(o *dynamodb.Options) {
+				o.BaseEndpoint = aws.String(store.endpoint)
+			})
 		}
+		store.ddb = dynamodb.NewFromConfig(*store.config, optFns...)
+	}
 
-		store.ddb = dynamodb.New(s)
+	switch {
+	case store.jsonValues:
+		store.serializer = &jsonSerializer{primaryKey: store.primaryKey}
+	case store.msgpackValues:
+		store.serializer = &msgpackSerializer{primaryKey: store.primaryKey}
+	case len(store.codecs) > 0:
+		store.serializer = &codecSerializer{codecs: store.codecs, primaryKey: store.primaryKey, maxLength: store.maxLength}
+	default:
+		store.serializer = &gobSerializer{
+			primaryKey: store.primaryKey,
+			compress:   store.compress,
+			level:      store.compressionLevel,
+		}
 	}
 
-	if len(store.codecs) > 0 {
-		store.serializer = &codecSerializer{codecs: store.codecs}
-	} else {
-		store.serializer = &gobSerializer{}
+	if err := store.Validate(); err != nil {
+		return nil, err
 	}
 
 	return store, nil
 }
 
 func (store *Store) save(ctx context.Context, name string, session *sessions.Session) error {
-	av, err := store.serializer.marshal(name, session)
+	_, err := store.persist(ctx, name, session, store.trackCreation)
+	return err
+}
+
+// persist writes session and, when track is set, returns true if no session was
+// stored under its id beforehand; see TrackCreation
+func (store *Store) persist(ctx context.Context, name string, session *sessions.Session, track bool) (created bool, err error) {
+	done := store.startOperation(OpSave)
+	defer func() { done(err) }()
+
+	if store.readOnly {
+		return false, ErrReadOnlyStore
+	}
+	if store.sharedItem {
+		return false, store.saveShared(ctx, name, session)
+	}
+
+	input, version, err := store.putInput(ctx, name, session)
 	if err != nil {
-		store.printf("dynastore: failed to marshal session - %v\n", err)
+		return false, err
+	}
+	input.ReturnConsumedCapacity = store.returnConsumedCapacity()
+	if track {
+		input.ReturnValues = types.ReturnValueAllOld
+	}
+
+	var out *dynamodb.PutItemOutput
+	err = store.withRetry(ctx, func() (err error) {
+		store.intercept(ctx, OpSave, input)
+		out, err = store.ddb.PutItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpSave, out.ConsumedCapacity)
+		}
 		return err
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) && store.revoked(ctx, session.ID) {
+			store.printf("dynastore: session revoked\n")
+			return false, ErrSessionRevoked
+		}
+		if store.versioning && isConditionalCheckFailed(err) {
+			store.printf("dynastore: version conflict saving session\n")
+			return false, ErrVersionConflict
+		}
+		store.printf("dynastore: PutItem failed - %v\n", err)
+		return false, wrapError(OpSave, session.ID, err)
+	}
+
+	store.saved(session, version)
+	if track {
+		created = store.tracked(ctx, session, input.Item, out.Attributes)
+	}
+	store.debug(ctx, "dynastore: session saved", session.ID, "bytes", itemSize(input.Item))
+	return created, nil
+}
+
+// putInput builds the PutItem request that saves session along with the version
+// the item will hold once written
+func (store *Store) putInput(ctx context.Context, name string, session *sessions.Session) (*dynamodb.PutItemInput, int64, error) {
+	if st, ok := lookupState(session); ok && st.partial {
+		store.printf("dynastore: refusing to save partially loaded session\n")
+		return nil, 0, ErrPartialSession
 	}
+	removeExpired(session.Values, store.now())
 
-	if store.ttlField != "" && session.Options != nil && session.Options.MaxAge > 0 {
-		expiresAt := time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second)
+	if err := store.checkValues(session); err != nil {
+		return nil, 0, err
+	}
+
+	av, err := store.marshal(ctx, name, session)
+	if err != nil {
+		store.printf("dynastore: failed to marshal session - %v\n", err)
+		return nil, 0, err
+	}
+
+	if expiresAt := store.expiresAt(session); !expiresAt.IsZero() {
 		ttl := strconv.FormatInt(expiresAt.Unix(), 10)
-		av[store.ttlField] = &dynamodb.AttributeValue{N: aws.String(ttl)}
+		av[store.ttlField] = &types.AttributeValueMemberN{Value: ttl}
+	}
+
+	if principal, ok := store.principal(session); ok {
+		av[principalField] = &types.AttributeValueMemberS{Value: principal}
+	}
+
+	av[nameField] = &types.AttributeValueMemberS{Value: name}
+	av[schemaField] = &types.AttributeValueMemberN{Value: strconv.Itoa(currentSchema)}
+	store.stampTimes(session, av)
+
+	if value, ok := store.indexValue(session); ok {
+		av[store.gsiAttribute] = &types.AttributeValueMemberS{Value: value}
 	}
+	store.promote(session, av)
 
-	_, err = store.ddb.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+	input := &dynamodb.PutItemInput{
 		TableName: aws.String(store.tableName),
 		Item:      av,
-	})
-	if err != nil {
-		store.printf("dynastore: PutItem failed - %v\n", err)
-		return err
 	}
 
+	var version int64
+	if store.versioning {
+		st := stateOf(session)
+		version = st.version + 1
+		av[versionField] = &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)}
+		input.ConditionExpression = aws.String("attribute_not_exists(#version) OR #version = :expected")
+		input.ExpressionAttributeNames = map[string]string{
+			"#version": versionField,
+		}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":expected": &types.AttributeValueMemberN{Value: strconv.FormatInt(st.version, 10)},
+		}
+	}
+
+	names := map[string]string{}
+	if condition := store.notRevoked(aws.ToString(input.ConditionExpression), names); condition != "" {
+		input.ConditionExpression = aws.String(condition)
+		if input.ExpressionAttributeNames == nil {
+			input.ExpressionAttributeNames = map[string]string{}
+		}
+		for k, v := range names {
+			input.ExpressionAttributeNames[k] = v
+		}
+	}
+
+	size := itemSize(av)
+	store.recordItemSize(av)
+	if store.maxItemSize > 0 && size > store.maxItemSize {
+		store.printf("dynastore: session of %v bytes exceeds limit of %v bytes\n", size, store.maxItemSize)
+		return nil, 0, ErrSessionTooLarge{Size: size, Limit: store.maxItemSize}
+	}
+	store.recordSaveSize(size)
+	store.warnItemSize(ctx, session.ID, size)
+
+	return input, version, nil
+}
+
+// saved updates the bookkeeping of session once it has been written at version
+func (store *Store) saved(session *sessions.Session, version int64) {
+	if store.versioning {
+		stateOf(session).version = version
+	}
+	if st, ok := lookupState(session); ok {
+		st.unprefixed = false
+		st.legacy = false
+		st.force = false
+	}
+	if store.tracksChanges() {
+		st := stateOf(session)
+		st.fingerprint = fingerprint(session)
+		st.expiresAt = store.expiresAt(session)
+	}
+}
+
+// key returns the primary key of the item holding the session with the given id
+func (store *Store) key(id string) map[string]types.AttributeValue {
+	return store.itemKey(store.itemID(id))
+}
+
+// delete removes the session with the given id.  Deleting a session that does not
+// exist is not an error.
+func (store *Store) delete(ctx context.Context, id string) (err error) {
+	done := store.startOperation(OpDelete)
+	defer func() { done(err) }()
+
+	if store.readOnly {
+		return ErrReadOnlyStore
+	}
+
+	keys := []map[string]types.AttributeValue{store.key(id)}
+	if key := store.legacyKey(id); key != nil {
+		keys = append(keys, key)
+	}
+
+	for i, key := range keys {
+		if i == 0 && store.tombstoneGrace > 0 {
+			if err := store.tombstone(ctx, key); err != nil {
+				store.printf("dynastore: delete failed - %v\n", err)
+				return wrapError(OpDelete, id, err)
+			}
+			continue
+		}
+
+		err := store.withRetry(ctx, func() error {
+			input := &dynamodb.DeleteItemInput{
+				TableName:              aws.String(store.tableName),
+				Key:                    key,
+				ReturnConsumedCapacity: store.returnConsumedCapacity(),
+			}
+			store.intercept(ctx, OpDelete, input)
+			out, err := store.ddb.DeleteItem(ctx, input)
+			if out != nil {
+				store.consumedCapacity(OpDelete, out.ConsumedCapacity)
+			}
+			return err
+		})
+		if err != nil {
+			store.printf("dynastore: delete failed - %v\n", err)
+			return wrapError(OpDelete, id, err)
+		}
+	}
+
+	store.debug(ctx, "dynastore: session deleted", id)
 	return nil
 }
 
-func (store *Store) delete(ctx context.Context, id string) error {
-	_, err := store.ddb.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
-		TableName: aws.String(store.tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"id": {S: aws.String(id)},
-		},
-	})
+// ErrNoExpiry is returned by TTLRemaining when the session has no server-side expiry
+var ErrNoExpiry = errors.New("session has no expiry")
+
+// TTLRemaining returns the time until the session with the given id expires on the
+// server.  Only the key and ttl attributes are read.  ErrNotFound is returned for
+// sessions that are missing or have expired but not yet been reaped, and
+// ErrNoExpiry for sessions without a ttl.
+func (store *Store) TTLRemaining(ctx context.Context, id string, opts ...ReadOption) (time.Duration, error) {
+	if store.ttlField == "" {
+		return 0, ErrNoExpiry
+	}
+
+	item, err := store.readExpiry(ctx, id, opts)
 	if err != nil {
-		store.printf("dynastore: delete failed - %v\n", err)
-		return err
+		return 0, err
 	}
-	return nil
+	if len(item) == 0 {
+		return 0, ErrNotFound
+	}
+
+	ttl, err := store.itemTTL(item)
+	if err != nil {
+		return 0, err
+	}
+	if ttl == 0 {
+		return 0, ErrNoExpiry
+	}
+
+	remaining := time.Unix(ttl, 0).Sub(store.now())
+	if remaining < 0 {
+		return 0, ErrNotFound
+	}
+	return remaining, nil
 }
 
 // load loads a session data from the database.
 // True is returned if there is a session data in the database.
-func (store *Store) load(ctx context.Context, name, value string, session *sessions.Session) error {
-	out, err := store.ddb.GetItemWithContext(ctx, &dynamodb.GetItemInput{
-		TableName:      aws.String(store.tableName),
-		ConsistentRead: aws.Bool(true),
-		Key: map[string]*dynamodb.AttributeValue{
-			"id": {S: aws.String(value)},
-		},
-	})
+func (store *Store) load(ctx context.Context, name, value string, session *sessions.Session) (err error) {
+	done := store.startOperation(OpLoad)
+	defer func() { done(err) }()
+	defer func() { store.logLoad(ctx, value, err) }()
+
+	item, legacy, err := store.getItem(ctx, value)
 	if err != nil {
 		store.printf("dynastore: GetItem failed\n")
-		return err
+		return wrapError(OpLoad, value, err)
 	}
 
-	if len(out.Item) == 0 {
+	if len(item) == 0 {
 		store.printf("dynastore: session not found\n")
-		return errNotFound
+		return ErrNotFound
 	}
 
+	store.recordItemSize(item)
+	if store.sharedItem {
+		if item = store.sharedSession(item, name); item == nil {
+			store.printf("dynastore: session not found in shared item\n")
+			return ErrNotFound
+		}
+	}
+
+	if _, ok := item[quarantinedField]; ok {
+		store.printf("dynastore: session quarantined\n")
+		return ErrNotFound
+	}
+
+	if _, ok := item[deletedField]; ok {
+		store.printf("dynastore: session deleted\n")
+		return ErrNotFound
+	}
+
+	err = store.decode(ctx, name, item, session)
+	if err == ErrMalformedSession || err == ErrDecodeFailed {
+		store.quarantineAsync(ctx, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	session.ID = value
+	if legacy {
+		stateOf(session).unprefixed = true
+	}
+	return nil
+}
+
+// decode verifies the item has not expired and unmarshals it into session
+func (store *Store) decode(ctx context.Context, name string, item map[string]types.AttributeValue, session *sessions.Session) error {
 	ttl := int64(0)
-	if av, ok := out.Item[store.ttlField]; ok {
-		if av.N == nil {
+	if av, ok := item[store.ttlField]; ok {
+		n, ok := av.(*types.AttributeValueMemberN)
+		if !ok {
 			store.printf("dynastore: no ttl associated with session\n")
-			return errMalformedSession
+			return ErrMalformedSession
 		}
-		v, err := strconv.ParseInt(*av.N, 10, 64)
+		v, err := strconv.ParseInt(n.Value, 10, 64)
 		if err != nil {
 			store.printf("dynastore: malformed session - %v\n", err)
-			return errMalformedSession
+			return ErrMalformedSession
 		}
 		ttl = v
 	}
 
-	if ttl > 0 && ttl < time.Now().Unix() {
+	if ttl > 0 && ttl < store.now().Unix() {
 		store.printf("dynastore: session expired\n")
-		return errNotFound
+		return ErrNotFound
+	}
+	if store.timedOut(item) {
+		store.printf("dynastore: session timed out\n")
+		return ErrNotFound
 	}
 
-	err = store.serializer.unmarshal(name, out.Item, session)
+	decoder, err := decoderFor(item)
 	if err != nil {
-		store.printf("dynastore: unable to unmarshal session - %v\n", err)
+		store.printf("dynastore: unable to read session schema - %v\n", err)
 		return err
 	}
+	resetState(session) // what was learned from an earlier load no longer applies
+	if err := decoder(store, ctx, name, item, session); err != nil {
+		return err
+	}
+	if session.Values == nil {
+		session.Values = map[interface{}]interface{}{} // e.g. a codec decoded nil
+	}
+	removeExpired(session.Values, store.now())
+	store.checkPrincipal(item, session)
+	if createdAt := itemTime(item, createdField); !createdAt.IsZero() {
+		stateOf(session).createdAt = createdAt
+	}
+
+	if store.tracksChanges() {
+		st := stateOf(session)
+		st.fingerprint = fingerprint(session)
+		if ttl > 0 {
+			st.expiresAt = time.Unix(ttl, 0)
+		}
+	}
+	store.rememberOptions(session)
+
+	if store.versioning {
+		var version int64
+		if n, ok := item[versionField].(*types.AttributeValueMemberN); ok {
+			version, _ = strconv.ParseInt(n.Value, 10, 64)
+		}
+		stateOf(session).version = version
+	}
 
 	return nil
 }
 
 type serializer interface {
-	marshal(name string, session *sessions.Session) (map[string]*dynamodb.AttributeValue, error)
-	unmarshal(name string, in map[string]*dynamodb.AttributeValue, session *sessions.Session) error
+	marshal(name string, session *sessions.Session) (map[string]types.AttributeValue, error)
+	unmarshal(name string, in map[string]types.AttributeValue, session *sessions.Session) error
+
+	// marshalValue and unmarshalValue encode a single value for use with ValueAttributes
+	marshalValue(name string, value interface{}) (types.AttributeValue, error)
+	unmarshalValue(name string, av types.AttributeValue) (interface{}, error)
 }
@@ -15,107 +15,612 @@
 package dynastore
 
 import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
 )
 
-func TestLifecycle(t *testing.T) {
-	hashKey := securecookie.GenerateRandomKey(64)
-	blockKey := securecookie.GenerateRandomKey(32)
-	codec := securecookie.New(hashKey, blockKey)
-	name := "blah"
-	tableName := os.Getenv("TABLE_NAME")
-	if tableName == "" {
-		return
+// testDynamoDB answers requests with fn rather than sending them over the network
+type testDynamoDB struct {
+	fn func(input interface{}) (interface{}, error)
+}
+
+// newTestDynamoDB returns a client whose requests are answered by fn.  fn receives
+// the request input and may return an output, an error, or neither in which case
+// an empty output is returned.
+func newTestDynamoDB(fn func(input interface{}) (interface{}, error)) *testDynamoDB {
+	return &testDynamoDB{fn: fn}
+}
+
+func (t *testDynamoDB) call(input interface{}) (interface{}, error) {
+	if t.fn == nil {
+		return nil, nil
 	}
+	return t.fn(input)
+}
 
-	testCases := map[string][]Option{
-		"gob":   {TableName(tableName)},
-		"codec": {TableName(tableName), Codecs(codec)},
+func (t *testDynamoDB) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.GetItemOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (t *testDynamoDB) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.PutItemOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (t *testDynamoDB) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.DeleteItemOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (t *testDynamoDB) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.UpdateItemOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (t *testDynamoDB) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.ScanOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (t *testDynamoDB) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.BatchWriteItemOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (t *testDynamoDB) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.TransactWriteItemsOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (t *testDynamoDB) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.QueryOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.QueryOutput{}, nil
+}
+
+func (t *testDynamoDB) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	out, err := t.call(input)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := out.(*dynamodb.BatchGetItemOutput); ok {
+		return v, nil
+	}
+	return &dynamodb.BatchGetItemOutput{}, nil
+}
+
+func TestQuarantineCorrupt(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	healthy, err := (&gobSerializer{}).marshal("blah", &sessions.Session{ID: "abc"})
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	testCases := map[string]struct {
+		item        map[string]types.AttributeValue
+		quarantined bool
+	}{
+		"corrupt": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+				valuesField:       &types.AttributeValueMemberS{Value: "!!! not base64 !!!"},
+			},
+			quarantined: true,
+		},
+		"already quarantined": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+				valuesField:       &types.AttributeValueMemberS{Value: "!!! not base64 !!!"},
+				quarantinedField:  &types.AttributeValueMemberBOOL{Value: true},
+			},
+		},
+		"healthy": {
+			item: healthy,
+		},
 	}
 
 	for label, tc := range testCases {
 		t.Run(label, func(t *testing.T) {
-			store, err := New(tc...)
+			var updates []*dynamodb.UpdateItemInput
+			ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+				switch input := in.(type) {
+				case *dynamodb.GetItemInput:
+					return &dynamodb.GetItemOutput{Item: tc.item}, nil
+				case *dynamodb.UpdateItemInput:
+					updates = append(updates, input)
+				}
+				return nil, nil
+			})
+
+			store, err := New(DynamoDB(ddb), QuarantineCorrupt(time.Hour))
 			if err != nil {
-				t.Errorf("expected nil; got %v", err)
-				return
+				t.Fatalf("expected nil; got %v", err)
 			}
+			store.now = func() time.Time { return now }
 
-			// New Session ------------------------
-
-			req, _ := http.NewRequest("GET", "http://localhost", nil)
-			session, err := store.New(req, name)
-			if err != nil {
-				t.Errorf("expected New returns nil; got %v", err)
+			err = store.load(context.Background(), "blah", "abc", sessions.NewSession(store, "blah"))
+			store.Close() // wait for the quarantine
+			if tc.quarantined {
+				if err != ErrDecodeFailed {
+					t.Errorf("expected ErrDecodeFailed; got %v", err)
+				}
+				if v := len(updates); v != 1 {
+					t.Fatalf("expected 1 UpdateItem; got %v", v)
+				}
+				if v := updates[0].ExpressionAttributeValues[":ttl"].(*types.AttributeValueMemberN).Value; v != "1500003600" {
+					t.Errorf("expected ttl of now+1h; got %v", v)
+				}
 				return
 			}
-			if !session.IsNew {
-				t.Error("expected new session")
-				return
+
+			if v := len(updates); v != 0 {
+				t.Errorf("expected no UpdateItem; got %v", v)
+			}
+			if _, ok := tc.item[quarantinedField]; ok && err != ErrNotFound {
+				t.Errorf("expected ErrNotFound; got %v", err)
+			} else if !ok && err != nil {
+				t.Errorf("expected nil; got %v", err)
 			}
+		})
+	}
+}
+
+func TestTTLRemaining(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	testCases := map[string]struct {
+		item map[string]types.AttributeValue
+		want time.Duration
+		err  error
+	}{
+		"remaining": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+				DefaultTTLField:   &types.AttributeValueMemberN{Value: "1500000120"},
+			},
+			want: 2 * time.Minute,
+		},
+		"expired": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+				DefaultTTLField:   &types.AttributeValueMemberN{Value: "1499999000"},
+			},
+			err: ErrNotFound,
+		},
+		"no ttl": {
+			item: map[string]types.AttributeValue{
+				DefaultPrimaryKey: &types.AttributeValueMemberS{Value: "abc"},
+			},
+			err: ErrNoExpiry,
+		},
+		"not found": {
+			err: ErrNotFound,
+		},
+	}
 
-			// Save -------------------------------
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var input *dynamodb.GetItemInput
+			ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+				input = in.(*dynamodb.GetItemInput)
+				return &dynamodb.GetItemOutput{Item: tc.item}, nil
+			})
 
-			w := httptest.NewRecorder()
-			err = store.Save(req, w, session)
+			store, err := New(DynamoDB(ddb))
 			if err != nil {
-				t.Errorf("expected Save returns nil; got %v", err)
-				return
+				t.Fatalf("expected nil; got %v", err)
 			}
-			cookies := w.Result().Cookies()
-			if v := len(cookies); v != 1 {
-				t.Errorf("expected Save sets 1 cookie; got %v", v)
-				return
+			store.now = func() time.Time { return now }
+
+			got, err := store.TTLRemaining(context.Background(), "abc")
+			if err != tc.err {
+				t.Errorf("expected %v; got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %v; got %v", tc.want, got)
+			}
+			if input.ProjectionExpression == nil {
+				t.Error("expected projection expression to be set")
 			}
-			cookie := cookies[0]
+		})
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	db := &dynastoretest.DB{}
+	ctx := context.Background()
+
+	store, err := New(DynamoDB(db), TTLField("expires"), TableName("sessions"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return now }
 
-			// Existing Session -------------------
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 60}
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	av, ok := db.Item("abc")["expires"]
+	if !ok {
+		t.Fatal("expected ttl attribute to be written")
+	}
+	if n, ok := av.(*types.AttributeValueMemberN); !ok || n.Value != "1500000060" {
+		t.Errorf("expected Number 1500000060; got %v", av)
+	}
+
+	if err := store.load(ctx, "blah", "abc", sessions.NewSession(store, "blah")); err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+
+	now = now.Add(61 * time.Second)
+	if err := store.load(ctx, "blah", "abc", sessions.NewSession(store, "blah")); err != ErrNotFound {
+		t.Errorf("expected expired session to be ErrNotFound; got %v", err)
+	}
+}
+
+type testStruct struct {
+	Name  string
+	Count int
+}
+
+func init() {
+	gob.Register(testStruct{})
+	gob.Register(time.Time{})
+	gob.Register([]string{})
+}
+
+func TestRoundTripValues(t *testing.T) {
+	hashKey := securecookie.GenerateRandomKey(64)
+	blockKey := securecookie.GenerateRandomKey(32)
+	codec := securecookie.New(hashKey, blockKey)
+	ctx := context.Background()
 
-			req.AddCookie(cookie)
-			found, err := store.New(req, name)
+	testCases := map[string][]Option{
+		"gob":   {},
+		"codec": {Codecs(codec)},
+	}
+
+	for label, opts := range testCases {
+		t.Run(label, func(t *testing.T) {
+			db := &dynastoretest.DB{}
+			store, err := New(append(opts, DynamoDB(db))...)
 			if err != nil {
-				t.Errorf("expected nil; got %v", err)
-				return
-			}
-			if found.IsNew {
-				t.Error("expected existing session; got new session")
-				return
+				t.Fatalf("expected nil; got %v", err)
 			}
 
-			// Delete Session ---------------------
+			now := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+			values := map[interface{}]interface{}{
+				"int":    42,
+				"time":   now,
+				"struct": testStruct{Name: "joe", Count: 3},
+				"slice":  []string{"a", "b"},
+			}
 
-			found.Options.MaxAge = -1
-			w = httptest.NewRecorder()
-			err = store.Save(req, w, found)
-			if err != nil {
-				t.Errorf("expected Save returns nil; got %v", err)
-				return
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			for k, v := range values {
+				session.Values[k] = v
 			}
-			cookies = w.Result().Cookies()
-			if v := len(cookies); v != 1 {
-				t.Errorf("expected Save sets 1 cookie; got %v", v)
-				return
+			if err := store.save(ctx, "blah", session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
 			}
-			if cookie := cookies[0]; cookie.Value != "" {
-				t.Errorf("expected cookie to be cleared; got %v", cookie.Value)
-				return
+
+			restored := sessions.NewSession(store, "blah")
+			if err := store.load(ctx, "blah", "abc", restored); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if !reflect.DeepEqual(values, restored.Values) {
+				t.Errorf("expected %#v; got %#v", values, restored.Values)
 			}
+		})
+	}
+}
+
+func TestNewUnknownSession(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	if err := store.load(context.Background(), "blah", "unknown", session); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+	if session.ID != "" {
+		t.Errorf("expected session to be untouched; got ID=%v", session.ID)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(&http.Cookie{Name: "blah", Value: "unknown"})
+	session, err = store.New(req, "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if !session.IsNew {
+		t.Error("expected new session")
+	}
+	if session.ID == "" || session.ID == "unknown" {
+		t.Errorf("expected fresh session id; got %v", session.ID)
+	}
+}
+
+func TestNewLoadError(t *testing.T) {
+	db := &dynastoretest.DB{}
+	writer, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := writer.New(req, "blah")
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	db.Err = func(input interface{}) error {
+		if _, ok := input.(*dynamodb.GetItemInput); ok {
+			return &types.ProvisionedThroughputExceededException{}
+		}
+		return nil
+	}
+
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	req, _ = http.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookie)
+	got, err := store.New(req, "blah")
+	if !errors.Is(err, ErrThrottled) {
+		t.Errorf("expected ErrThrottled; got %v", err)
+	}
+	if got == nil || !got.IsNew || got.ID == session.ID {
+		t.Errorf("expected fresh session; got %v", got)
+	}
+
+	store, err = New(DynamoDB(db), FailOpen())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	req, _ = http.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookie)
+	got, err = store.New(req, "blah")
+	if err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+	if got == nil || !got.IsNew {
+		t.Errorf("expected fresh session; got %v", got)
+	}
+}
+
+func TestPrimaryKey(t *testing.T) {
+	db := &dynastoretest.DB{PrimaryKey: "session_id"}
+	store, err := New(DynamoDB(db), PrimaryKey("session_id"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// Save -------------------------------
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// Load -------------------------------
+
+	req, _ = http.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	found, err := store.New(req, "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if found.IsNew || found.ID != session.ID {
+		t.Errorf("expected existing session %v; got %v", session.ID, found.ID)
+	}
+
+	// Delete -----------------------------
+
+	found.Options.MaxAge = -1
+	if err := store.Save(req, httptest.NewRecorder(), found); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	for _, r := range db.Requests() {
+		var key map[string]types.AttributeValue
+		switch input := r.(type) {
+		case *dynamodb.PutItemInput:
+			key = input.Item
+		case *dynamodb.GetItemInput:
+			key = input.Key
+		case *dynamodb.DeleteItemInput:
+			key = input.Key
+		}
+		if _, ok := key["session_id"]; !ok {
+			t.Errorf("expected session_id key in %T", r)
+		}
+		if _, ok := key[DefaultPrimaryKey]; ok {
+			t.Errorf("expected no %v attribute in %T", DefaultPrimaryKey, r)
+		}
+	}
+	if v := len(db.Requests()); v != 3 {
+		t.Errorf("expected 3 requests; got %v", v)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	var ops []string
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		ops = append(ops, strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", in), "*dynamodb."), "Input"))
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: -1}
+	session.Values["hello"] = "world"
+
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if len(ops) != 1 || ops[0] != "DeleteItem" {
+		t.Errorf("expected a single DeleteItem; got %v", ops)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected cookie to be expired; got %v", cookies)
+	}
+}
+
+func TestDeleteMissing(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if err := store.delete(context.Background(), "missing"); err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+}
+
+func TestConsistentRead(t *testing.T) {
+	var inputs []*dynamodb.GetItemInput
+	ddb := newTestDynamoDB(func(input interface{}) (interface{}, error) {
+		if v, ok := input.(*dynamodb.GetItemInput); ok {
+			inputs = append(inputs, v)
+		}
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), KeyPrefix("app"), FallbackToUnprefixed())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(&http.Cookie{Name: "blah", Value: "abc"})
+	if _, err := store.New(req, "blah"); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
 
-			// Verify Session Deleted -------------
+	if len(inputs) != 2 {
+		t.Fatalf("expected 2 GetItem requests; got %v", len(inputs))
+	}
+	for _, input := range inputs {
+		if !aws.ToBool(input.ConsistentRead) {
+			t.Errorf("expected consistent read")
+		}
+	}
+}
 
-			found, err = store.New(req, name)
+func TestLoadNilValues(t *testing.T) {
+	testCases := map[string][]Option{
+		"gob":     nil,
+		"json":    {JSON()},
+		"msgpack": {Msgpack()},
+		"values":  {ValueAttributes()},
+		"codecs":  {Codecs(securecookie.New(securecookie.GenerateRandomKey(32), nil))},
+	}
+
+	for label, opts := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store, err := New(append([]Option{DynamoDB(&dynastoretest.DB{})}, opts...)...)
 			if err != nil {
-				t.Errorf("expected nil; got %v", err)
-				return
+				t.Fatalf("expected nil; got %v", err)
 			}
-			if !found.IsNew {
-				t.Error("expected new session; got existing session")
-				return
+
+			session := sessions.NewSession(store, "blah")
+			session.ID = "abc"
+			session.Values["a"] = "b"
+			if err := store.save(context.Background(), "blah", session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+
+			restored := &sessions.Session{}
+			if err := store.load(context.Background(), "blah", "abc", restored); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			if got := restored.Values["a"]; got != "b" {
+				t.Errorf("expected b; got %v", got)
 			}
 		})
 	}
@@ -0,0 +1,172 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DefaultCreateTableTimeout is the default time CreateTableIfNotExists waits for
+// the table to become ACTIVE
+const DefaultCreateTableTimeout = 5 * time.Minute
+
+var errTableAPI = errors.New("dynamodb client does not support table management")
+
+// TableAPI holds the table management calls used by CreateTableIfNotExists.  The
+// *dynamodb.Client satisfies both DynamoDBAPI and TableAPI.
+type TableAPI interface {
+	DescribeTable(ctx context.Context, input *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	CreateTable(ctx context.Context, input *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	UpdateTimeToLive(ctx context.Context, input *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+}
+
+// CreateTableIfNotExists creates the session table with PAY_PER_REQUEST billing,
+// the configured primary key and GSI if it does not already exist, enables TTL on
+// the configured ttl field, and waits for the table to become ACTIVE; see
+// CreateTableTimeout.  Existing tables are left unchanged.  It is safe to call
+// concurrently from multiple instances.  The DynamoDB client must implement
+// TableAPI.
+func (store *Store) CreateTableIfNotExists(ctx context.Context) error {
+	if store.readOnly {
+		return ErrReadOnlyStore
+	}
+
+	api, ok := store.ddb.(TableAPI)
+	if !ok {
+		return errTableAPI
+	}
+
+	out, err := api.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(store.tableName),
+	})
+	if err == nil {
+		if out.Table != nil && out.Table.TableStatus == types.TableStatusActive {
+			return nil
+		}
+		return store.waitForTable(ctx, api)
+	}
+
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		store.printf("dynastore: DescribeTable failed - %v\n", err)
+		return err
+	}
+
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(store.tableName),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String(store.primaryKey),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String(store.primaryKey),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+	}
+	if store.sortKey != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: aws.String(store.sortKey),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+		input.KeySchema = append(input.KeySchema, types.KeySchemaElement{
+			AttributeName: aws.String(store.sortKey),
+			KeyType:       types.KeyTypeRange,
+		})
+	}
+	if store.gsiIndex != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: aws.String(store.gsiAttribute),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+		input.GlobalSecondaryIndexes = []types.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(store.gsiIndex),
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String(store.gsiAttribute),
+						KeyType:       types.KeyTypeHash,
+					},
+				},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			},
+		}
+	}
+
+	_, err = api.CreateTable(ctx, input)
+	if err != nil {
+		// another instance won the race to create the table
+		var inUse *types.ResourceInUseException
+		if errors.As(err, &inUse) {
+			return store.waitForTable(ctx, api)
+		}
+		store.printf("dynastore: CreateTable failed - %v\n", err)
+		return err
+	}
+
+	if err := store.waitForTable(ctx, api); err != nil {
+		return err
+	}
+
+	if store.ttlField == "" {
+		return nil
+	}
+
+	_, err = api.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(store.tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(store.ttlField),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		store.printf("dynastore: UpdateTimeToLive failed - %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// waitForTable blocks until the table is ACTIVE or the create table timeout elapses
+func (store *Store) waitForTable(ctx context.Context, api TableAPI) error {
+	timeout := store.createTableTimeout
+	if timeout <= 0 {
+		timeout = DefaultCreateTableTimeout
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(api, func(o *dynamodb.TableExistsWaiterOptions) {
+		o.MinDelay = time.Second
+		o.MaxDelay = 10 * time.Second
+	})
+	err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(store.tableName),
+	}, timeout)
+	if err != nil {
+		store.printf("dynastore: table did not become active - %v\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestCreateTableIfNotExists(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), TableName("sessions"), PrimaryKey("sid"), TTLField("expires"))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	if err := store.CreateTableIfNotExists(ctx); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	var create *dynamodb.CreateTableInput
+	for _, req := range db.Requests() {
+		if v, ok := req.(*dynamodb.CreateTableInput); ok {
+			create = v
+		}
+	}
+	if create == nil {
+		t.Fatal("expected CreateTable to be called")
+	}
+	if v := create.BillingMode; v != types.BillingModePayPerRequest {
+		t.Errorf("expected PAY_PER_REQUEST; got %v", v)
+	}
+	if v := aws.ToString(create.KeySchema[0].AttributeName); v != "sid" {
+		t.Errorf("expected sid; got %v", v)
+	}
+	if spec := db.TimeToLive(); spec == nil || aws.ToString(spec.AttributeName) != "expires" || !aws.ToBool(spec.Enabled) {
+		t.Errorf("expected ttl enabled on expires; got %#v", spec)
+	}
+
+	// subsequent calls only describe the table
+	n := len(db.Requests())
+	if err := store.CreateTableIfNotExists(ctx); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := len(db.Requests()) - n; v != 1 {
+		t.Errorf("expected 1 request; got %v", v)
+	}
+}
+
+// staleDescribe reports the table as missing on the first DescribeTable as seen by
+// an instance racing another that has just created it
+type staleDescribe struct {
+	*dynastoretest.DB
+	described bool
+}
+
+func (s *staleDescribe) DescribeTable(ctx context.Context, input *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	if !s.described {
+		s.described = true
+		return nil, &types.ResourceNotFoundException{}
+	}
+	return s.DB.DescribeTable(ctx, input, optFns...)
+}
+
+func TestCreateTableRace(t *testing.T) {
+	db := &dynastoretest.DB{}
+	winner, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	loser, err := New(DynamoDB(&staleDescribe{DB: db}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	if err := winner.CreateTableIfNotExists(ctx); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := loser.CreateTableIfNotExists(ctx); err != nil {
+		t.Errorf("expected ResourceInUseException to be tolerated; got %v", err)
+	}
+}
+
+func TestCreateTableUnsupported(t *testing.T) {
+	store, err := New(DynamoDB(newTestDynamoDB(nil)))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.CreateTableIfNotExists(context.Background()); err != errTableAPI {
+		t.Errorf("expected errTableAPI; got %v", err)
+	}
+}
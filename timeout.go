@@ -0,0 +1,72 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+// lastAccessField holds the time, in unix seconds, the session was last saved or
+// touched when IdleTimeout is set
+const lastAccessField = "lastAccess"
+
+// tracksChanges returns true if sessions are fingerprinted when loaded so Save
+// can tell whether they changed
+func (store *Store) tracksChanges() bool {
+	return store.sliding || store.skipUnchanged || store.idleTimeout > 0
+}
+
+// createdAt returns when session was first saved, or now if it has not been
+func (store *Store) createdAt(session *sessions.Session) time.Time {
+	if st, ok := lookupState(session); ok && !st.createdAt.IsZero() {
+		return st.createdAt
+	}
+	return store.now()
+}
+
+// timedOut returns true if the session held by item has been idle for longer than
+// IdleTimeout or has outlived AbsoluteTimeout.  Items without the attributes
+// recording access and creation are not checked.
+func (store *Store) timedOut(item map[string]types.AttributeValue) bool {
+	now := store.now()
+	if store.idleTimeout > 0 {
+		if lastAccess := itemTime(item, lastAccessField); !lastAccess.IsZero() && now.After(lastAccess.Add(store.idleTimeout)) {
+			return true
+		}
+	}
+	if store.absoluteTimeout > 0 {
+		if createdAt := itemTime(item, createdField); !createdAt.IsZero() && now.After(createdAt.Add(store.absoluteTimeout)) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastAccess returns the lastAccess attribute for a session accessed at t
+func lastAccess(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
+
+// earliest returns the earlier of a and b, ignoring either if it is zero
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestSessionTimeouts(t *testing.T) {
+	db := &dynastoretest.DB{}
+	start := time.Unix(1000, 0)
+	now := start
+	store, err := New(DynamoDB(db), MaxAge(86400), IdleTimeout(30*time.Minute), AbsoluteTimeout(12*time.Hour), Clock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["user"] = "joe"
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+	id := session.ID
+
+	ttl := func() time.Time {
+		return itemTime(db.Item(id), DefaultTTLField)
+	}
+	// visit loads the session and saves it unchanged, returning whether it was found
+	visit := func() bool {
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(cookie)
+		session, err := store.New(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if session.IsNew {
+			return false
+		}
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		return true
+	}
+	// outliveTTL pushes the ttl out so only the load checks apply
+	outliveTTL := func() {
+		item := db.Item(id)
+		item[DefaultTTLField] = &types.AttributeValueMemberN{Value: "99999999999"}
+		db.SetItem(item)
+	}
+
+	if got, want := ttl(), start.Add(30*time.Minute); !got.Equal(want) {
+		t.Errorf("expected ttl of %v; got %v", want, got)
+	}
+
+	// an unchanged session refreshes lastAccess and the ttl with an UpdateItem
+	now = now.Add(20 * time.Minute)
+	if !visit() {
+		t.Fatal("expected session within the idle timeout to load")
+	}
+	requests := db.Requests()
+	input, ok := requests[len(requests)-1].(*dynamodb.UpdateItemInput)
+	if !ok {
+		t.Fatalf("expected UpdateItem; got %T", requests[len(requests)-1])
+	}
+	if v := aws.ToString(input.UpdateExpression); v != "SET #ttl = :ttl, #lastAccess = :lastAccess" {
+		t.Errorf("unexpected UpdateExpression; got %v", v)
+	}
+	if got := itemTime(db.Item(id), lastAccessField); !got.Equal(now) {
+		t.Errorf("expected lastAccess of %v; got %v", now, got)
+	}
+	if got, want := ttl(), now.Add(30*time.Minute); !got.Equal(want) {
+		t.Errorf("expected ttl of %v; got %v", want, got)
+	}
+
+	// idle for longer than the timeout
+	outliveTTL()
+	now = now.Add(31 * time.Minute)
+	if visit() {
+		t.Error("expected idle session to be rejected")
+	}
+
+	// active, but older than the absolute timeout
+	item := db.Item(id)
+	item[lastAccessField] = lastAccess(now)
+	db.SetItem(item)
+	if !visit() {
+		t.Fatal("expected recently accessed session to load")
+	}
+	for now.Before(start.Add(12*time.Hour - 20*time.Minute)) {
+		now = now.Add(20 * time.Minute)
+		if !visit() {
+			t.Fatalf("expected active session to load at %v", now.Sub(start))
+		}
+	}
+	if got, want := ttl(), start.Add(12*time.Hour); !got.Equal(want) {
+		t.Errorf("expected ttl capped at %v; got %v", want, got)
+	}
+	outliveTTL()
+	now = start.Add(12*time.Hour + time.Second)
+	if visit() {
+		t.Error("expected session past the absolute timeout to be rejected")
+	}
+}
+
+func TestTimeoutOptions(t *testing.T) {
+	for _, opt := range []Option{IdleTimeout(-time.Second), AbsoluteTimeout(-time.Second)} {
+		if _, err := New(DynamoDB(&dynastoretest.DB{}), opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected ErrInvalidOption; got %v", err)
+		}
+	}
+	if _, err := New(DynamoDB(&dynastoretest.DB{}), SharedItem(), IdleTimeout(time.Minute)); !errors.Is(err, errSharedItemUnsupported) {
+		t.Errorf("expected errSharedItemUnsupported; got %v", err)
+	}
+}
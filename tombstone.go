@@ -0,0 +1,99 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// deletedField marks the tombstone left in place of a deleted session; see Tombstones
+const deletedField = "deleted_at"
+
+var (
+	// ErrSessionRevoked is returned by Save when the session was deleted while
+	// Tombstones is enabled, e.g. by a logout racing an in-flight request
+	ErrSessionRevoked = errors.New("session was revoked")
+
+	errTombstonesTTL = errors.New("dynastore: Tombstones requires a ttl field")
+)
+
+// tombstone replaces the item with the given key by a marker that expires after
+// the grace period, preventing the session from being saved again
+func (store *Store) tombstone(ctx context.Context, key map[string]types.AttributeValue) error {
+	now := store.now()
+	item := map[string]types.AttributeValue{
+		deletedField:   &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		store.ttlField: &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(store.tombstoneGrace).Unix(), 10)},
+	}
+	for k, v := range key {
+		item[k] = v
+	}
+
+	return store.withRetry(ctx, func() error {
+		input := &dynamodb.PutItemInput{
+			TableName:              aws.String(store.tableName),
+			Item:                   item,
+			ReturnConsumedCapacity: store.returnConsumedCapacity(),
+		}
+		store.intercept(ctx, OpDelete, input)
+		out, err := store.ddb.PutItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpDelete, out.ConsumedCapacity)
+		}
+		return err
+	})
+}
+
+// notRevoked extends condition, a disjunction of AND clauses, to also require the
+// item not be a tombstone.  condition is returned unchanged unless Tombstones is
+// enabled.
+func (store *Store) notRevoked(condition string, names map[string]string) string {
+	if store.tombstoneGrace <= 0 {
+		return condition
+	}
+
+	names["#deleted"] = deletedField
+	if condition == "" {
+		return "attribute_not_exists(#deleted)"
+	}
+
+	clauses := strings.Split(condition, " OR ")
+	for i, clause := range clauses {
+		clauses[i] = clause + " AND attribute_not_exists(#deleted)"
+	}
+	return strings.Join(clauses, " OR ")
+}
+
+// revoked returns true if a failed conditional write of the session with the given
+// id was caused by its tombstone
+func (store *Store) revoked(ctx context.Context, id string) bool {
+	if store.tombstoneGrace <= 0 {
+		return false
+	}
+
+	item, err := store.readItem(ctx, store.key(id))
+	if err != nil {
+		return false
+	}
+	_, ok := item[deletedField]
+	return ok
+}
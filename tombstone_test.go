@@ -0,0 +1,131 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestTombstones(t *testing.T) {
+	ctx := context.Background()
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(db), Tombstones(time.Minute), MaxAge(3600))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Options = &sessions.Options{MaxAge: 3600}
+	if err := store.save(ctx, "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	// an in-flight request holds the session while another logs out
+	inflight := sessions.NewSession(store, "blah")
+	if err := store.load(ctx, "blah", "abc", inflight); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if err := store.delete(ctx, "abc"); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	item := db.Item("abc")
+	if _, ok := item[deletedField]; !ok {
+		t.Fatalf("expected tombstone; got %v", item)
+	}
+	if v, ok := item[DefaultTTLField].(*types.AttributeValueMemberN); !ok || v.Value != "1060" {
+		t.Errorf("expected tombstone to expire after the grace period; got %#v", item[DefaultTTLField])
+	}
+
+	if err := store.load(ctx, "blah", "abc", sessions.NewSession(store, "blah")); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+
+	inflight.Values["n"] = 1
+	if err := store.save(ctx, "blah", inflight); err != ErrSessionRevoked {
+		t.Errorf("expected ErrSessionRevoked; got %v", err)
+	}
+	if _, ok := db.Item("abc")[deletedField]; !ok {
+		t.Error("expected tombstone to remain")
+	}
+
+	if err := store.Touch(ctx, "abc"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound; got %v", err)
+	}
+
+	if _, err := New(DynamoDB(db), Tombstones(time.Minute), TTLField("")); !errors.Is(err, errTombstonesTTL) {
+		t.Errorf("expected errTombstonesTTL; got %v", err)
+	}
+}
+
+func TestTombstonesRace(t *testing.T) {
+	ctx := context.Background()
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), Tombstones(time.Minute))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		session, _ := store.New(req, "blah")
+		if err := session.Save(req, httptest.NewRecorder()); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		inflight := sessions.NewSession(store, "blah")
+		if err := store.load(ctx, "blah", session.ID, inflight); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+
+		var (
+			wg      sync.WaitGroup
+			saveErr error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			inflight.Values["n"] = i
+			saveErr = store.save(ctx, "blah", inflight)
+		}()
+		go func() {
+			defer wg.Done()
+			if err := store.delete(ctx, session.ID); err != nil {
+				t.Errorf("expected nil; got %v", err)
+			}
+		}()
+		wg.Wait()
+
+		if saveErr != nil && saveErr != ErrSessionRevoked {
+			t.Fatalf("expected nil or ErrSessionRevoked; got %v", saveErr)
+		}
+		err := store.load(ctx, "blah", session.ID, sessions.NewSession(store, "blah"))
+		if err != ErrNotFound {
+			t.Fatalf("expected deleted session to stay deleted; got %v", err)
+		}
+	}
+}
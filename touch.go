@@ -0,0 +1,288 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// DefaultTouchConcurrency is the default number of concurrent UpdateItem calls made by TouchBatch
+	DefaultTouchConcurrency = 8
+
+	// touchChunkSize is the number of ids processed between context checks
+	touchChunkSize = 100
+)
+
+var errTTLDisabled = errors.New("no ttl field configured")
+
+// BatchReport summarizes the outcome of TouchBatch
+type BatchReport struct {
+	// Touched holds the number of sessions whose ttl was extended
+	Touched int
+	// Skipped holds the number of sessions skipped as they were touched within the dedup window
+	Skipped int
+	// NotFound holds the ids of sessions that no longer exist
+	NotFound []string
+	// Throttled holds the ids of sessions that could not be touched due to throttling
+	Throttled []string
+	// Failed holds the ids of sessions that failed for any other reason
+	Failed map[string]error
+}
+
+// touchCache remembers when ids were last touched so TouchBatch can skip them
+type touchCache struct {
+	mutex   sync.Mutex
+	touched map[string]time.Time
+}
+
+// claim returns true if id has not been touched since cutoff and records it as touched at now
+func (c *touchCache) claim(id string, now, cutoff time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.touched == nil {
+		c.touched = map[string]time.Time{}
+	}
+	if t, ok := c.touched[id]; ok && t.After(cutoff) {
+		return false
+	}
+	c.touched[id] = now
+	return true
+}
+
+// release forgets id so a failed touch may be retried
+func (c *touchCache) release(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.touched, id)
+}
+
+// prune removes entries touched before cutoff
+func (c *touchCache) prune(cutoff time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for id, t := range c.touched {
+		if !t.After(cutoff) {
+			delete(c.touched, id)
+		}
+	}
+}
+
+// TouchBatch extends the ttl of the given sessions to now+ttl, capped by
+// IdleTimeout and AbsoluteTimeout as Touch is.  DynamoDB has no batch update, so
+// ids are updated individually by a bounded pool of workers; see
+// TouchConcurrency and TouchRate.  Ids touched within the TouchDedupWindow are
+// skipped.  Per-id failures are recorded in the report; the returned error is
+// non-nil only when ctx is cancelled, which is checked between chunks of ids.
+func (store *Store) TouchBatch(ctx context.Context, ids []string, ttl time.Duration) (BatchReport, error) {
+	report := BatchReport{
+		Failed: map[string]error{},
+	}
+	if store.readOnly {
+		return report, ErrReadOnlyStore
+	}
+	if store.ttlField == "" {
+		return report, errTTLDisabled
+	}
+
+	now := store.now()
+	cutoff := now.Add(-store.touchWindow)
+	if store.touchWindow > 0 {
+		store.touchCache.prune(cutoff)
+	}
+
+	expiresAt := now.Add(ttl)
+
+	concurrency := store.touchConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultTouchConcurrency
+	}
+
+	var tick <-chan time.Time
+	if store.touchRate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(store.touchRate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var mutex sync.Mutex
+	record := func(id string, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if err == nil {
+			report.Touched++
+			return
+		}
+
+		switch {
+		case isConditionalCheckFailed(err):
+			report.NotFound = append(report.NotFound, id)
+		case isThrottled(err):
+			report.Throttled = append(report.Throttled, id)
+		default:
+			report.Failed[id] = err
+		}
+	}
+
+	for offset := 0; offset < len(ids); offset += touchChunkSize {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		end := offset + touchChunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		work := make(chan string)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for id := range work {
+					if tick != nil {
+						select {
+						case <-tick:
+						case <-ctx.Done():
+							record(id, ctx.Err())
+							continue
+						}
+					}
+
+					capped, err := store.capExpiry(ctx, id, expiresAt)
+					if err == nil {
+						err = store.touch(ctx, id, strconv.FormatInt(capped.Unix(), 10))
+					}
+					if err != nil && store.touchWindow > 0 {
+						store.touchCache.release(id)
+					}
+					record(id, err)
+				}
+			}()
+		}
+
+		for _, id := range ids[offset:end] {
+			if store.touchWindow > 0 && !store.touchCache.claim(id, now, cutoff) {
+				report.Skipped++
+				continue
+			}
+			work <- id
+		}
+		close(work)
+		wg.Wait()
+	}
+
+	return report, nil
+}
+
+// touch sets the ttl of an existing session to expiresAt (unix seconds)
+func (store *Store) touch(ctx context.Context, id, expiresAt string) (err error) {
+	done := store.startOperation(OpTouch)
+	defer func() { done(err) }()
+
+	if store.readOnly {
+		return ErrReadOnlyStore
+	}
+
+	names := map[string]string{
+		"#id":  store.primaryKey,
+		"#ttl": store.ttlField,
+	}
+	values := map[string]types.AttributeValue{
+		":ttl": &types.AttributeValueMemberN{Value: expiresAt},
+	}
+	update := "SET #ttl = :ttl"
+	if store.idleTimeout > 0 {
+		names["#lastAccess"] = lastAccessField
+		values[":lastAccess"] = lastAccess(store.now())
+		update += ", #lastAccess = :lastAccess"
+	}
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(store.tableName),
+		Key:                       store.key(id),
+		ConditionExpression:       aws.String(store.notRevoked("attribute_exists(#id)", names)),
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnConsumedCapacity:    store.returnConsumedCapacity(),
+	}
+	err = store.withRetry(ctx, func() error {
+		store.intercept(ctx, OpTouch, input)
+		out, err := store.ddb.UpdateItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpTouch, out.ConsumedCapacity)
+		}
+		return err
+	})
+	if err != nil {
+		store.printf("dynastore: touch failed - %v\n", err)
+		return wrapError(OpTouch, id, err)
+	}
+	return nil
+}
+
+// capExpiry limits expiresAt to the IdleTimeout measured from now and the
+// AbsoluteTimeout measured from the creation time of the session with the given
+// id, which is read from the table.  Sessions without a recorded creation time,
+// including missing ones, are capped by IdleTimeout alone.
+func (store *Store) capExpiry(ctx context.Context, id string, expiresAt time.Time) (time.Time, error) {
+	if store.idleTimeout > 0 {
+		expiresAt = earliest(expiresAt, store.now().Add(store.idleTimeout))
+	}
+	if store.absoluteTimeout <= 0 {
+		return expiresAt, nil
+	}
+
+	input := &dynamodb.GetItemInput{
+		TableName:                aws.String(store.tableName),
+		ConsistentRead:           aws.Bool(true),
+		ProjectionExpression:     aws.String("#created"),
+		ExpressionAttributeNames: map[string]string{"#created": createdField},
+		Key:                      store.key(id),
+		ReturnConsumedCapacity:   store.returnConsumedCapacity(),
+	}
+
+	var out *dynamodb.GetItemOutput
+	err := store.withRetry(ctx, func() (err error) {
+		store.intercept(ctx, OpTouch, input)
+		out, err = store.reader().GetItem(ctx, input)
+		if out != nil {
+			store.consumedCapacity(OpTouch, out.ConsumedCapacity)
+		}
+		return err
+	})
+	if err != nil {
+		store.printf("dynastore: GetItem failed - %v\n", err)
+		return time.Time{}, wrapError(OpTouch, id, err)
+	}
+
+	if createdAt := itemTime(out.Item, createdField); !createdAt.IsZero() {
+		expiresAt = earliest(expiresAt, createdAt.Add(store.absoluteTimeout))
+	}
+	return expiresAt, nil
+}
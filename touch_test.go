@@ -0,0 +1,177 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestTouchBatch(t *testing.T) {
+	var (
+		inFlight    int32
+		maxInFlight int32
+		calls       int32
+	)
+
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		input := in.(*dynamodb.UpdateItemInput)
+		atomic.AddInt32(&calls, 1)
+
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		switch id := input.Key[DefaultPrimaryKey].(*types.AttributeValueMemberS).Value; {
+		case id == "id-13":
+			return nil, &types.ConditionalCheckFailedException{Message: aws.String("not found")}
+		case id == "id-42":
+			return nil, &types.ProvisionedThroughputExceededException{Message: aws.String("throttled")}
+		}
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), TouchConcurrency(4), TouchDedupWindow(time.Minute))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ids := make([]string, 500)
+	for i := range ids {
+		ids[i] = "id-" + strconv.Itoa(i)
+	}
+
+	report, err := store.TouchBatch(context.Background(), ids, time.Hour)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if report.Touched != 498 {
+		t.Errorf("expected 498 touched; got %v", report.Touched)
+	}
+	if len(report.NotFound) != 1 || report.NotFound[0] != "id-13" {
+		t.Errorf("expected id-13 not found; got %v", report.NotFound)
+	}
+	if len(report.Throttled) != 1 || report.Throttled[0] != "id-42" {
+		t.Errorf("expected id-42 throttled; got %v", report.Throttled)
+	}
+	if v := atomic.LoadInt32(&maxInFlight); v > 4 {
+		t.Errorf("expected at most 4 concurrent calls; got %v", v)
+	}
+
+	// Dedup ------------------------------
+
+	atomic.StoreInt32(&calls, 0)
+	report, err = store.TouchBatch(context.Background(), ids, time.Hour)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if report.Skipped != 498 {
+		t.Errorf("expected 498 skipped; got %v", report.Skipped)
+	}
+	if v := atomic.LoadInt32(&calls); v != 2 {
+		t.Errorf("expected only failed ids to be retried; got %v calls", v)
+	}
+}
+
+func TestTouchBatchCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var once sync.Once
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		once.Do(cancel)
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), TouchConcurrency(1))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ids := make([]string, 500)
+	for i := range ids {
+		ids[i] = "id-" + strconv.Itoa(i)
+	}
+
+	report, err := store.TouchBatch(ctx, ids, time.Hour)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled; got %v", err)
+	}
+	if n := report.Touched + len(report.Failed); n >= len(ids) {
+		t.Errorf("expected remaining chunks to be skipped; got %v processed", n)
+	}
+}
+
+func TestTouchBatchTimeouts(t *testing.T) {
+	var (
+		mutex sync.Mutex
+		ttls  = map[string]string{}
+	)
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		switch input := in.(type) {
+		case *dynamodb.GetItemInput:
+			if id := input.Key[DefaultPrimaryKey].(*types.AttributeValueMemberS).Value; id == "old" {
+				return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+					createdField: &types.AttributeValueMemberN{Value: "900"},
+				}}, nil
+			}
+			return nil, nil
+		case *dynamodb.UpdateItemInput:
+			id := input.Key[DefaultPrimaryKey].(*types.AttributeValueMemberS).Value
+			if id == "broken" {
+				return nil, errors.New("boom")
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			ttls[id] = input.ExpressionAttributeValues[":ttl"].(*types.AttributeValueMemberN).Value
+		}
+		return nil, nil
+	})
+
+	store, err := New(DynamoDB(ddb), IdleTimeout(30*time.Minute), AbsoluteTimeout(time.Hour))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return time.Unix(3000, 0) }
+
+	report, err := store.TouchBatch(context.Background(), []string{"old", "new", "broken"}, time.Hour)
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := ttls["old"]; v != "4500" {
+		t.Errorf("expected 4500; got %v", v)
+	}
+	if v := ttls["new"]; v != "4800" {
+		t.Errorf("expected 4800; got %v", v)
+	}
+	if err := report.Failed["broken"]; err == nil || !strings.HasPrefix(err.Error(), "dynastore: touch session broken") {
+		t.Errorf("expected wrapped error; got %v", err)
+	}
+}
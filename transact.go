@@ -0,0 +1,216 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+)
+
+var errTransactAPI = errors.New("dynamodb client does not support transactions")
+
+// TransactAPI holds the call used by Transact.  The *dynamodb.Client satisfies
+// both DynamoDBAPI and TransactAPI.
+type TransactAPI interface {
+	TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// TxOp is an operation performed atomically with others by Transact
+type TxOp struct {
+	build func(ctx context.Context, store *Store) ([]types.TransactWriteItem, error)
+	done  func(store *Store)
+}
+
+// PutSession saves session within a transaction
+func PutSession(session *sessions.Session) TxOp {
+	var version int64
+	return TxOp{
+		build: func(ctx context.Context, store *Store) ([]types.TransactWriteItem, error) {
+			if store.sharedItem {
+				return nil, errSharedItemUnsupported
+			}
+			input, v, err := store.putInput(ctx, session.Name(), session)
+			if err != nil {
+				return nil, err
+			}
+			version = v
+
+			return []types.TransactWriteItem{
+				{
+					Put: &types.Put{
+						TableName:                 input.TableName,
+						Item:                      input.Item,
+						ConditionExpression:       input.ConditionExpression,
+						ExpressionAttributeNames:  input.ExpressionAttributeNames,
+						ExpressionAttributeValues: input.ExpressionAttributeValues,
+					},
+				},
+			}, nil
+		},
+		done: func(store *Store) {
+			store.saved(session, version)
+		},
+	}
+}
+
+// DeleteSession deletes the session with the given id within a transaction
+func DeleteSession(id string) TxOp {
+	return TxOp{
+		build: func(ctx context.Context, store *Store) ([]types.TransactWriteItem, error) {
+			items := []types.TransactWriteItem{
+				{
+					Delete: &types.Delete{
+						TableName: aws.String(store.tableName),
+						Key:       store.key(id),
+					},
+				},
+			}
+			if key := store.legacyKey(id); key != nil {
+				items = append(items, types.TransactWriteItem{
+					Delete: &types.Delete{
+						TableName: aws.String(store.tableName),
+						Key:       key,
+					},
+				})
+			}
+			return items, nil
+		},
+	}
+}
+
+// ConditionCheck adds check to a transaction; the transaction is cancelled unless
+// its condition holds.  The store's table is used if check names none.
+func ConditionCheck(check types.ConditionCheck) TxOp {
+	return TxOp{
+		build: func(ctx context.Context, store *Store) ([]types.TransactWriteItem, error) {
+			if check.TableName == nil {
+				check.TableName = aws.String(store.tableName)
+			}
+			return []types.TransactWriteItem{{ConditionCheck: &check}}, nil
+		},
+	}
+}
+
+// TransactItem adds an arbitrary write to a transaction e.g. to revoke a row
+// related to the session
+func TransactItem(item types.TransactWriteItem) TxOp {
+	return TxOp{
+		build: func(ctx context.Context, store *Store) ([]types.TransactWriteItem, error) {
+			return []types.TransactWriteItem{item}, nil
+		},
+	}
+}
+
+// TxFailure describes an op responsible for cancelling a transaction
+type TxFailure struct {
+	// Op holds the index of the op as passed to Transact
+	Op int
+	// Code holds the cancellation reason e.g. ConditionalCheckFailed
+	Code string
+	// Message holds the detail provided by DynamoDB, if any
+	Message string
+}
+
+// TransactionCanceledError is returned by Transact when DynamoDB cancels the
+// transaction.  None of its ops are applied.
+type TransactionCanceledError struct {
+	// Failed holds the ops that caused the cancellation
+	Failed []TxFailure
+
+	err error
+}
+
+func (e *TransactionCanceledError) Error() string {
+	var reasons []string
+	for _, f := range e.Failed {
+		reasons = append(reasons, fmt.Sprintf("op %v: %v", f.Op, f.Code))
+	}
+	return "transaction cancelled - " + strings.Join(reasons, ", ")
+}
+
+// Unwrap returns the underlying TransactionCanceledException
+func (e *TransactionCanceledError) Unwrap() error {
+	return e.err
+}
+
+// Transact performs ops atomically using TransactWriteItems; either every op is
+// applied or none are.  Sessions are marshaled with the configured serializer and
+// honour versioning.  The DynamoDB client must implement TransactAPI.
+func (store *Store) Transact(ctx context.Context, ops ...TxOp) error {
+	if store.readOnly {
+		return ErrReadOnlyStore
+	}
+
+	api, ok := store.ddb.(TransactAPI)
+	if !ok {
+		return errTransactAPI
+	}
+
+	var (
+		items   []types.TransactWriteItem
+		indexes []int // op index of each item
+	)
+	for i, op := range ops {
+		built, err := op.build(ctx, store)
+		if err != nil {
+			return err
+		}
+		for range built {
+			indexes = append(indexes, i)
+		}
+		items = append(items, built...)
+	}
+
+	_, err := api.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			txErr := &TransactionCanceledError{err: err}
+			for i, reason := range canceled.CancellationReasons {
+				code := aws.ToString(reason.Code)
+				if code == "" || code == "None" || i >= len(indexes) {
+					continue
+				}
+				txErr.Failed = append(txErr.Failed, TxFailure{
+					Op:      indexes[i],
+					Code:    code,
+					Message: aws.ToString(reason.Message),
+				})
+			}
+			store.printf("dynastore: %v\n", txErr)
+			return txErr
+		}
+
+		store.printf("dynastore: TransactWriteItems failed - %v\n", err)
+		return err
+	}
+
+	for _, op := range ops {
+		if op.done != nil {
+			op.done(store)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestTransact(t *testing.T) {
+	var input *dynamodb.TransactWriteItemsInput
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		input, _ = in.(*dynamodb.TransactWriteItemsInput)
+		return nil, nil
+	})
+	store, err := New(DynamoDB(ddb), TableName("sessions"), WithVersioning())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+	session.Values["hello"] = "world"
+
+	check := types.ConditionCheck{
+		Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "user"}},
+		ConditionExpression: aws.String("attribute_exists(id)"),
+	}
+
+	err = store.Transact(context.Background(), PutSession(session), DeleteSession("def"), ConditionCheck(check))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if input == nil {
+		t.Fatal("expected TransactWriteItems to be called")
+	}
+	if v := len(input.TransactItems); v != 3 {
+		t.Fatalf("expected 3 items; got %v", v)
+	}
+
+	put := input.TransactItems[0].Put
+	if put == nil {
+		t.Fatal("expected Put")
+	}
+	if v := aws.ToString(put.TableName); v != "sessions" {
+		t.Errorf("expected sessions; got %v", v)
+	}
+	if v, ok := put.Item["id"].(*types.AttributeValueMemberS); !ok || v.Value != "abc" {
+		t.Errorf("expected abc; got %#v", put.Item["id"])
+	}
+	if put.ConditionExpression == nil {
+		t.Error("expected version condition")
+	}
+
+	del := input.TransactItems[1].Delete
+	if del == nil {
+		t.Fatal("expected Delete")
+	}
+	if v, ok := del.Key["id"].(*types.AttributeValueMemberS); !ok || v.Value != "def" {
+		t.Errorf("expected def; got %#v", del.Key["id"])
+	}
+
+	cc := input.TransactItems[2].ConditionCheck
+	if cc == nil {
+		t.Fatal("expected ConditionCheck")
+	}
+	if v := aws.ToString(cc.TableName); v != "sessions" {
+		t.Errorf("expected table name to default to sessions; got %v", v)
+	}
+
+	if v := stateOf(session).version; v != 1 {
+		t.Errorf("expected version 1; got %v", v)
+	}
+}
+
+func TestTransactCanceled(t *testing.T) {
+	ddb := newTestDynamoDB(func(in interface{}) (interface{}, error) {
+		return nil, &types.TransactionCanceledException{
+			Message: aws.String("Transaction cancelled"),
+			CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("None")},
+				{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed")},
+			},
+		}
+	})
+	store, err := New(DynamoDB(ddb), WithVersioning())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "abc"
+
+	err = store.Transact(context.Background(), PutSession(session), DeleteSession("def"))
+	var txErr *TransactionCanceledError
+	if !errors.As(err, &txErr) {
+		t.Fatalf("expected TransactionCanceledError; got %v", err)
+	}
+	if v := len(txErr.Failed); v != 1 {
+		t.Fatalf("expected 1 failure; got %v", v)
+	}
+	if f := txErr.Failed[0]; f.Op != 1 || f.Code != "ConditionalCheckFailed" {
+		t.Errorf("expected op 1 ConditionalCheckFailed; got %#v", f)
+	}
+
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		t.Errorf("expected TransactionCanceledException to be unwrapped")
+	}
+	if v := stateOf(session).version; v != 0 {
+		t.Errorf("expected version to be unchanged; got %v", v)
+	}
+}
+
+func TestTransactFake(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	ctx := context.Background()
+	old := sessions.NewSession(store, "blah")
+	old.ID = "old"
+	if err := store.save(ctx, "blah", old); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	session := sessions.NewSession(store, "blah")
+	session.ID = "new"
+
+	missing := ConditionCheck(types.ConditionCheck{
+		Key:                      map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "missing"}},
+		ConditionExpression:      aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{"#id": "id"},
+	})
+	err = store.Transact(ctx, PutSession(session), DeleteSession("old"), missing)
+	var txErr *TransactionCanceledError
+	if !errors.As(err, &txErr) {
+		t.Fatalf("expected TransactionCanceledError; got %v", err)
+	}
+	if db.Item("new") != nil || db.Item("old") == nil {
+		t.Error("expected no writes to be applied")
+	}
+
+	if err := store.Transact(ctx, PutSession(session), DeleteSession("old")); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if db.Item("new") == nil || db.Item("old") != nil {
+		t.Error("expected new to be saved and old deleted")
+	}
+}
+
+func TestTransactUnsupported(t *testing.T) {
+	store := &Store{ddb: struct{ DynamoDBAPI }{}}
+	if err := store.Transact(context.Background()); err != errTransactAPI {
+		t.Errorf("expected errTransactAPI; got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// ForceSave marks session to be written by its next Save even if it has not
+// changed; see SkipUnchanged
+func ForceSave(session *sessions.Session) {
+	stateOf(session).force = true
+}
+
+// unchanged returns true if saving session may be skipped as it has not changed
+// since it was loaded and its ttl does not yet need to be extended
+func (store *Store) unchanged(session *sessions.Session) bool {
+	if !store.skipUnchanged || session.IsNew || store.idleTimeout > 0 {
+		// with IdleTimeout, lastAccess is refreshed by slide
+		return false
+	}
+
+	st, ok := lookupState(session)
+	if !ok || st.force || st.legacy || st.unprefixed || st.fingerprint == nil || !bytes.Equal(st.fingerprint, fingerprint(session)) {
+		return false
+	}
+
+	if !store.expiresAt(session).IsZero() {
+		if session.Options == nil || session.Options.MaxAge <= 0 {
+			return false
+		}
+		// extend the ttl once half of MaxAge has elapsed
+		refreshAt := st.expiresAt.Add(-time.Duration(session.Options.MaxAge) * time.Second / 2)
+		if st.expiresAt.IsZero() || !store.now().Before(refreshAt) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expiresAt returns the ttl a session saved now would be written with, or the zero
+// time if it would have none.  The ttl is the earliest of MaxAge, IdleTimeout and
+// AbsoluteTimeout from when the session was created.
+func (store *Store) expiresAt(session *sessions.Session) time.Time {
+	if store.ttlField == "" {
+		return time.Time{}
+	}
+
+	var (
+		now       = store.now()
+		expiresAt time.Time
+	)
+	if session.Options != nil && session.Options.MaxAge > 0 {
+		expiresAt = now.Add(time.Duration(session.Options.MaxAge) * time.Second)
+	}
+	if store.idleTimeout > 0 {
+		expiresAt = earliest(expiresAt, now.Add(store.idleTimeout))
+	}
+	if store.absoluteTimeout > 0 {
+		expiresAt = earliest(expiresAt, store.createdAt(session).Add(store.absoluteTimeout))
+	}
+	return expiresAt
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestSkipUnchanged(t *testing.T) {
+	db := &dynastoretest.DB{}
+	now := time.Unix(1000, 0)
+	store, err := New(DynamoDB(db), SkipUnchanged(), MaxAge(3600))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	puts := func() (n int) {
+		for _, r := range db.Requests() {
+			if _, ok := r.(*dynamodb.PutItemInput); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	var cookie *http.Cookie
+	serve := func(fn func(session *sessions.Session)) {
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		session, err := store.Get(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		fn(session)
+		if err := session.Save(req, w); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if cookies := w.Result().Cookies(); len(cookies) > 0 {
+			cookie = cookies[0]
+		}
+	}
+
+	serve(func(session *sessions.Session) { session.Values["n"] = 1 })
+	if v := puts(); v != 1 {
+		t.Fatalf("expected new session to be written; got %v puts", v)
+	}
+
+	serve(func(session *sessions.Session) {})
+	if v := puts(); v != 1 {
+		t.Errorf("expected read only request to skip the write; got %v puts", v)
+	}
+
+	serve(func(session *sessions.Session) { session.Values["n"] = 2 })
+	if v := puts(); v != 2 {
+		t.Errorf("expected mutated session to be written; got %v puts", v)
+	}
+
+	serve(func(session *sessions.Session) { ForceSave(session) })
+	if v := puts(); v != 3 {
+		t.Errorf("expected forced session to be written; got %v puts", v)
+	}
+
+	// the ttl is extended once half of MaxAge has elapsed
+	now = now.Add(29 * time.Minute)
+	serve(func(session *sessions.Session) {})
+	if v := puts(); v != 3 {
+		t.Errorf("expected write to be skipped; got %v puts", v)
+	}
+	now = now.Add(time.Minute)
+	serve(func(session *sessions.Session) {})
+	if v := puts(); v != 4 {
+		t.Errorf("expected ttl to be extended; got %v puts", v)
+	}
+
+	serve(func(session *sessions.Session) { session.Options.MaxAge = 7200 })
+	if v := puts(); v != 5 {
+		t.Errorf("expected changed options to be written; got %v puts", v)
+	}
+}
+
+func TestSkipUnchangedMap(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), SkipUnchanged(), MaxAge(3600), JSON())
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	prefs := map[string]interface{}{}
+	for i := 0; i < 50; i++ {
+		prefs[strconv.Itoa(i)] = map[string]interface{}{"on": i%2 == 0}
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["prefs"] = prefs
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		req.AddCookie(cookie)
+		session, err := store.Get(req, "blah")
+		if err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}
+
+	puts := 0
+	for _, r := range db.Requests() {
+		if _, ok := r.(*dynamodb.PutItemInput); ok {
+			puts++
+		}
+	}
+	if puts != 1 {
+		t.Errorf("expected unchanged map values to skip the write; got %v puts", puts)
+	}
+
+	off := sessions.NewSession(store, "blah")
+	off.Values["prefs"] = map[string]interface{}{"0": map[string]interface{}{"on": false}}
+	on := sessions.NewSession(store, "blah")
+	on.Values["prefs"] = map[string]interface{}{"0": map[string]interface{}{"on": true}}
+	if string(fingerprint(off)) == string(fingerprint(on)) {
+		t.Error("expected nested map values to change the fingerprint")
+	}
+}
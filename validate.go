@@ -0,0 +1,189 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+var (
+	// ErrInvalidOption is wrapped by errors from options given invalid values
+	ErrInvalidOption = errors.New("invalid option")
+
+	errNoClient      = errors.New("dynastore: no DynamoDB client configured")
+	errNoRegion      = errors.New("dynastore: no AWS region configured; set AWS_REGION or use AWSConfig")
+	errNoTableName   = errors.New("dynastore: table name must not be empty")
+	errNoPrimaryKey  = errors.New("dynastore: primary key must not be empty")
+	errTTLPrimaryKey = errors.New("dynastore: ttl field must differ from the primary key")
+	errSortKey       = errors.New("dynastore: sort key must differ from the primary key and ttl field")
+	errCodecsJSON    = errors.New("dynastore: Codecs cannot be combined with JSON or Msgpack as values would not be encrypted")
+	errSerializers   = errors.New("dynastore: JSON and Msgpack cannot be combined")
+)
+
+// Validate checks the store configuration and returns an error listing every
+// problem found, or nil if there are none.  New calls Validate so a misconfigured
+// store fails when it is created rather than on the first request.
+func (store *Store) Validate() error {
+	errs := append([]error(nil), store.optionErrs...)
+
+	if store.ddb == nil {
+		errs = append(errs, errNoClient)
+	}
+	if strings.TrimSpace(store.tableName) == "" {
+		errs = append(errs, errNoTableName)
+	}
+	if store.primaryKey == "" {
+		errs = append(errs, errNoPrimaryKey)
+	}
+	if store.ttlField != "" && store.ttlField == store.primaryKey {
+		errs = append(errs, errTTLPrimaryKey)
+	}
+	if store.sortKey != "" && (store.sortKey == store.primaryKey || store.sortKey == store.ttlField) {
+		errs = append(errs, errSortKey)
+	}
+	if (store.jsonValues || store.msgpackValues) && len(store.codecs) > 0 {
+		errs = append(errs, errCodecsJSON)
+	}
+	if store.tombstoneGrace > 0 && store.ttlField == "" {
+		errs = append(errs, errTombstonesTTL)
+	}
+	if store.jsonValues && store.msgpackValues {
+		errs = append(errs, errSerializers)
+	}
+	if err := store.checkPromotedFields(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// invalidOption records the non-nil errors among errs so New fails with them and
+// returns true if there were any
+func (store *Store) invalidOption(errs ...error) bool {
+	var invalid bool
+	for _, err := range errs {
+		if err != nil {
+			store.optionErrs = append(store.optionErrs, err)
+			invalid = true
+		}
+	}
+	return invalid
+}
+
+// isNil returns true if v is nil or holds a nil pointer, e.g. an uninitialized
+// *dynamodb.Client
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+// checkPath requires cookie paths to be absolute
+func checkPath(path string) error {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("%w: path must begin with a slash; got %q", ErrInvalidOption, path)
+	}
+	return nil
+}
+
+// checkMaxAge rejects ages that overflow time.Duration when computing the cookie
+// Expires and item ttl
+func checkMaxAge(maxAge int) error {
+	if int64(maxAge) > math.MaxInt64/int64(time.Second) {
+		return fmt.Errorf("%w: MaxAge %v is too large", ErrInvalidOption, maxAge)
+	}
+	return nil
+}
+
+// TableName returns the name of the DynamoDB table holding sessions
+func (store *Store) TableName() string {
+	return store.tableName
+}
+
+// PrimaryKey returns the name of the table's hash key attribute
+func (store *Store) PrimaryKey() string {
+	return store.primaryKey
+}
+
+// SortKey returns the name of the table's sort key attribute, or "" if the table
+// has none; see CompositeKey
+func (store *Store) SortKey() string {
+	return store.sortKey
+}
+
+// Options returns a copy of the default options applied to new sessions
+func (store *Store) Options() sessions.Options {
+	return store.options
+}
+
+// String describes the store configuration for logging.  Codecs and encryption
+// keys are reported only by count or presence.
+func (store *Store) String() string {
+	fields := []string{
+		"table=" + store.tableName,
+		"primaryKey=" + store.primaryKey,
+		"ttlField=" + store.ttlField,
+		fmt.Sprintf("serializer=%v", store.serializerName()),
+		fmt.Sprintf("codecs=%v", len(store.codecs)),
+		fmt.Sprintf("encryption=%v", store.encryption != nil),
+		fmt.Sprintf("maxAge=%v", store.options.MaxAge),
+	}
+	if store.sortKey != "" {
+		fields = append(fields, "sortKey="+store.sortKey)
+	}
+	if store.keyPrefix != "" {
+		fields = append(fields, "keyPrefix="+store.keyPrefix)
+	}
+	if store.keyDeriver != nil {
+		fields = append(fields, "keyDeriver=true")
+	}
+	if store.endpoint != "" {
+		fields = append(fields, "endpoint="+store.endpoint)
+	}
+	if store.gsiIndex != "" {
+		fields = append(fields, "gsi="+store.gsiIndex+"/"+store.gsiAttribute)
+	}
+	if store.sharedItem {
+		fields = append(fields, "sharedItem=true")
+	}
+	return "dynastore.Store{" + strings.Join(fields, ", ") + "}"
+}
+
+// serializerName returns a short name for the configured serializer
+func (store *Store) serializerName() string {
+	switch store.serializer.(type) {
+	case *gobSerializer:
+		return "gob"
+	case *codecSerializer:
+		return "codec"
+	case *jsonSerializer:
+		return "json"
+	case *msgpackSerializer:
+		return "msgpack"
+	case nil:
+		return "none"
+	default:
+		return "custom"
+	}
+}
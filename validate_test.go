@@ -0,0 +1,182 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestValidate(t *testing.T) {
+	codec := securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+
+	testCases := map[string]struct {
+		opts []Option
+		want []error
+	}{
+		"table name":  {opts: []Option{TableName("")}, want: []error{ErrInvalidOption}},
+		"primary key": {opts: []Option{PrimaryKey("")}, want: []error{errNoPrimaryKey}},
+		"ttl field":   {opts: []Option{TTLField(DefaultPrimaryKey)}, want: []error{errTTLPrimaryKey}},
+		"codecs json": {opts: []Option{Codecs(codec), JSON()}, want: []error{errCodecsJSON}},
+		"multiple": {
+			opts: []Option{PrimaryKey(""), Codecs(codec), JSON()},
+			want: []error{errNoPrimaryKey, errCodecsJSON},
+		},
+		"option and conflict": {
+			opts: []Option{TableName(""), PrimaryKey("key"), TTLField("key")},
+			want: []error{ErrInvalidOption, errTTLPrimaryKey},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			_, err := New(append([]Option{DynamoDB(&dynastoretest.DB{})}, tc.opts...)...)
+			for _, want := range tc.want {
+				if !errors.Is(err, want) {
+					t.Errorf("expected %v; got %v", want, err)
+				}
+			}
+		})
+	}
+
+	if err := (&Store{}).Validate(); !errors.Is(err, errNoClient) || !errors.Is(err, errNoTableName) {
+		t.Errorf("expected errNoClient and errNoTableName; got %v", err)
+	}
+}
+
+func TestOptionErrors(t *testing.T) {
+	testCases := map[string]struct {
+		opt   Option
+		valid bool
+	}{
+		"max age":              {opt: MaxAge(86400), valid: true},
+		"max age overflow":     {opt: MaxAge(math.MaxInt64/int(time.Second) + 1)},
+		"path":                 {opt: Path("/app"), valid: true},
+		"path empty":           {opt: Path(""), valid: true},
+		"path relative":        {opt: Path("app")},
+		"table name":           {opt: TableName("sessions"), valid: true},
+		"table name empty":     {opt: TableName("")},
+		"session options":      {opt: SessionOptions(sessions.Options{Path: "/", MaxAge: 60}), valid: true},
+		"session options path": {opt: SessionOptions(sessions.Options{Path: "app"})},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store, err := New(DynamoDB(&dynastoretest.DB{}), tc.opt)
+			if tc.valid {
+				if err != nil {
+					t.Errorf("expected nil; got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Errorf("expected ErrInvalidOption; got %v", err)
+			}
+			if store != nil {
+				t.Errorf("expected nil store; got %v", store)
+			}
+		})
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	codec := securecookie.New([]byte("super-secret-hash-key"), nil)
+	store, err := New(DynamoDB(&dynastoretest.DB{}), TableName("sessions"), Codecs(codec), MaxAge(3600))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	if v := store.TableName(); v != "sessions" {
+		t.Errorf("expected sessions; got %v", v)
+	}
+
+	opts := store.Options()
+	if opts.MaxAge != 3600 {
+		t.Errorf("expected 3600; got %v", opts.MaxAge)
+	}
+	opts.MaxAge = 1
+	if v := store.Options(); v.MaxAge != 3600 {
+		t.Errorf("expected Options to return a copy; got %v", v.MaxAge)
+	}
+
+	s := store.String()
+	if !strings.Contains(s, "table=sessions") || !strings.Contains(s, "serializer=codec") || !strings.Contains(s, "codecs=1") {
+		t.Errorf("expected configuration to be described; got %v", s)
+	}
+	if strings.Contains(s, "super-secret") {
+		t.Errorf("expected codec keys to be redacted; got %v", s)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	var client *dynamodb.Client
+
+	testCases := map[string]struct {
+		opts []Option
+		want error
+	}{
+		"whitespace table name": {opts: []Option{DynamoDB(&dynastoretest.DB{}), TableName(" \t")}, want: ErrInvalidOption},
+		"nil client":            {opts: []Option{DynamoDB(nil)}, want: ErrInvalidOption},
+		"nil pointer client":    {opts: []Option{DynamoDB(client)}, want: ErrInvalidOption},
+		"no region":             {opts: []Option{AWSConfig(aws.Config{})}, want: errNoRegion},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			if _, err := New(tc.opts...); !errors.Is(err, tc.want) {
+				t.Errorf("expected %v; got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	cfg := aws.Config{
+		Region:      "us-west-2",
+		Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	}
+
+	store, err := NewFromConfig(context.Background(), cfg, "sessions", MaxAge(60))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if got := store.TableName(); got != "sessions" {
+		t.Errorf("expected sessions; got %v", got)
+	}
+	if _, ok := store.ddb.(*dynamodb.Client); !ok {
+		t.Errorf("expected *dynamodb.Client; got %T", store.ddb)
+	}
+	if got := store.options.MaxAge; got != 60 {
+		t.Errorf("expected 60; got %v", got)
+	}
+
+	if _, err := NewFromConfig(context.Background(), cfg, " "); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+	if _, err := NewFromConfig(context.Background(), aws.Config{}, "sessions"); !errors.Is(err, errNoRegion) {
+		t.Errorf("expected errNoRegion; got %v", err)
+	}
+}
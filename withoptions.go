@@ -0,0 +1,90 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/securecookie"
+)
+
+// WithOptions returns a new Store configured with the options the receiver was
+// created with followed by opts, e.g. to use a different KeyPrefix per tenant.  The
+// receiver is not modified.  The derived store shares the receiver's DynamoDB client
+// unless opts includes DynamoDB; AWSConfig and Endpoint otherwise have no effect.
+//
+// If the options are invalid, the derived store fails every request with the error,
+// which its Validate method also returns.  Close the derived store when it is no
+// longer needed.
+func (store *Store) WithOptions(opts ...Option) *Store {
+	all := make([]Option, 0, len(store.opts)+len(opts)+1)
+	all = append(all, store.opts...)
+	all = append(all, copyCodecs, DynamoDB(store.ddb))
+	all = append(all, opts...)
+
+	derived, err := New(all...)
+	if err != nil {
+		store.printf("dynastore: invalid options - %v\n", err)
+		failed, _ := New(DynamoDB(failingClient{err: err}))
+		failed.optionErrs = []error{err}
+		return failed
+	}
+	return derived
+}
+
+// copyCodecs replaces the codecs of s with copies so that applying MaxAge and
+// MaxLength to a derived store leaves the codecs of its receiver unchanged.  Other
+// codec types are shared.
+func copyCodecs(s *Store) {
+	codecs := make([]securecookie.Codec, 0, len(s.codecs))
+	for _, codec := range s.codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			c := *sc
+			codec = &c
+		}
+		codecs = append(codecs, codec)
+	}
+	s.codecs = codecs
+}
+
+// failingClient fails every request with err
+type failingClient struct {
+	err error
+}
+
+func (c failingClient) GetItem(context.Context, *dynamodb.GetItemInput, ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return nil, c.err
+}
+
+func (c failingClient) PutItem(context.Context, *dynamodb.PutItemInput, ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return nil, c.err
+}
+
+func (c failingClient) DeleteItem(context.Context, *dynamodb.DeleteItemInput, ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return nil, c.err
+}
+
+func (c failingClient) UpdateItem(context.Context, *dynamodb.UpdateItemInput, ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return nil, c.err
+}
+
+func (c failingClient) Scan(context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return nil, c.err
+}
+
+func (c failingClient) BatchWriteItem(context.Context, *dynamodb.BatchWriteItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	return nil, c.err
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+func TestWithOptions(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db), MaxAge(60))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	tenant := store.WithOptions(KeyPrefix("tenant"))
+	defer tenant.Close()
+	if err := tenant.Validate(); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if store.keyPrefix != "" {
+		t.Errorf("expected receiver to be unchanged; got prefix %v", store.keyPrefix)
+	}
+	if got := tenant.options.MaxAge; got != 60 {
+		t.Errorf("expected options of the receiver to be kept; got MaxAge %v", got)
+	}
+
+	session := sessions.NewSession(tenant, "blah")
+	session.ID = "abc"
+	if err := tenant.save(context.Background(), "blah", session); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if db.Item("tenant#abc") == nil {
+		t.Error("expected the derived store to share the client of the receiver")
+	}
+}
+
+func TestWithOptionsInvalid(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	derived := store.WithOptions(Clock(nil))
+	if err := derived.Validate(); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+
+	session := sessions.NewSession(derived, "blah")
+	session.ID = "abc"
+	if err := derived.save(context.Background(), "blah", session); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption; got %v", err)
+	}
+}
+
+func TestWithOptionsCodecs(t *testing.T) {
+	hashKey := securecookie.GenerateRandomKey(32)
+	value := signedCookie(t, hashKey, "blah", "abc", time.Now().Add(-time.Minute))
+
+	store, err := New(DynamoDB(&dynastoretest.DB{}), Codecs(securecookie.New(hashKey, nil)), MaxAge(3600))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	derived := store.WithOptions(MaxAge(1))
+	if err := derived.Validate(); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if _, ok := derived.decodeCookie("blah", value); ok {
+		t.Error("expected the derived store to reject the older cookie")
+	}
+	if _, ok := store.decodeCookie("blah", value); !ok {
+		t.Error("expected the receiver to accept its cookie")
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	store, err := New(DynamoDB(&dynastoretest.DB{}), WithConsumedCapacity(), SlidingExpiration(), MaxAge(60))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	defer store.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			req, _ := http.NewRequest("GET", "http://localhost", nil)
+			session, err := store.Get(req, "blah")
+			if err != nil {
+				t.Errorf("expected nil; got %v", err)
+				return
+			}
+			session.Values["n"] = i
+			w := httptest.NewRecorder()
+			if err := store.Save(req, w, session); err != nil {
+				t.Errorf("expected nil; got %v", err)
+				return
+			}
+
+			for j := 0; j < 10; j++ {
+				req, _ := http.NewRequest("GET", "http://localhost", nil)
+				for _, cookie := range w.Result().Cookies() {
+					req.AddCookie(cookie)
+				}
+				session, err := store.Get(req, "blah")
+				if err != nil {
+					t.Errorf("expected nil; got %v", err)
+					return
+				}
+				if got := session.Values["n"]; got != i {
+					t.Errorf("expected %v; got %v", i, got)
+					return
+				}
+				session.Values["j"] = fmt.Sprint(j)
+				if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+					t.Errorf("expected nil; got %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := store.Stats().Operations[OpSave]; got != 50*11 {
+		t.Errorf("expected %v saves; got %v", 50*11, got)
+	}
+}
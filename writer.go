@@ -0,0 +1,246 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+var (
+	// ErrHeadersSent is returned by Save when the session was persisted but its
+	// cookie could not be set as the response headers had already been sent.  It
+	// is only detected for writers wrapped by ResponseWriter, DeferCookies or
+	// Middleware, including through other wrappers that implement
+	// Unwrap() http.ResponseWriter as http.ResponseController expects.
+	ErrHeadersSent = errors.New("headers already sent; unable to set cookie")
+
+	errHijackNotSupported = errors.New("underlying ResponseWriter does not support hijacking")
+)
+
+// deferredWriter delays the status line until the first body write so that
+// cookies set by Save after WriteHeader still reach the client
+type deferredWriter struct {
+	http.ResponseWriter
+	status  int
+	flushed bool
+}
+
+// DeferCookies wraps next so that handlers which call WriteHeader before saving
+// their session don't lose the Set-Cookie header.  The status line is held back
+// until the first Write, Flush or ReadFrom, or until next returns.  Saves that
+// occur after the headers have been sent are logged via Output.
+//
+// The wrapper supports http.Flusher, http.Hijacker and io.ReaderFrom.
+func DeferCookies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		dw := &deferredWriter{ResponseWriter: w}
+		next.ServeHTTP(dw, req)
+		dw.flush()
+	})
+}
+
+// headersSent returns true if w, or any writer it wraps, is a deferred or tracking
+// writer whose headers have been sent
+func headersSent(w http.ResponseWriter) bool {
+	for w != nil {
+		switch v := w.(type) {
+		case *deferredWriter:
+			if v.flushed {
+				return true
+			}
+		case *trackingWriter:
+			if v.sent {
+				return true
+			}
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+	return false
+}
+
+func (w *deferredWriter) flush() {
+	if w.flushed {
+		return
+	}
+	w.flushed = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *deferredWriter) WriteHeader(status int) {
+	if w.flushed || w.status != 0 {
+		return
+	}
+	w.status = status
+}
+
+func (w *deferredWriter) Write(p []byte) (int, error) {
+	w.flush()
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher
+func (w *deferredWriter) Flush() {
+	w.flush()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.  Any pending status is discarded as the caller
+// takes over the connection.
+func (w *deferredWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijackNotSupported
+	}
+	w.flushed = true
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *deferredWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ReadFrom implements io.ReaderFrom so sendfile optimizations are preserved
+func (w *deferredWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.flush()
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+// trackingWriter records when the headers are sent so Save can report cookies
+// that cannot be set
+type trackingWriter struct {
+	http.ResponseWriter
+	sent bool
+
+	// before, if set, is called once just before the headers are sent
+	before func()
+}
+
+// ResponseWriter wraps w so that Save returns ErrHeadersSent, rather than nil,
+// when the response headers were sent before the session cookie could be set.
+// The wrapper supports http.Flusher, http.Hijacker and io.ReaderFrom.
+func ResponseWriter(w http.ResponseWriter) http.ResponseWriter {
+	if _, ok := w.(*trackingWriter); ok {
+		return w
+	}
+	return &trackingWriter{ResponseWriter: w}
+}
+
+// Middleware loads the session with the given name before next runs and saves it
+// just before the response headers are sent, or when next returns if it sends
+// none, so handlers need not call Save.  Handlers retrieve the session with
+// store.Get.  When the session cannot be loaded, e.g. because DynamoDB is
+// throttling, Middleware responds 503 Service Unavailable rather than replace it
+// with a new session; see FailOpen.  Save errors are logged via Output.  Sessions
+// the handler saved itself are only saved again if changed since.
+func Middleware(store *Store, name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			session, err := store.Get(req, name)
+			if err != nil {
+				store.printf("dynastore: unable to load session - %v\n", err)
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+
+			st := stateOf(session)
+			st.managed = true
+
+			tw := &trackingWriter{ResponseWriter: w}
+			tw.before = func() {
+				if st.savedAs != nil && !st.force && bytes.Equal(st.savedAs, fingerprint(session)) {
+					return
+				}
+				if err := store.Save(req, tw, session); err != nil {
+					store.printf("dynastore: unable to save session - %v\n", err)
+				}
+			}
+			next.ServeHTTP(tw, req)
+			tw.send()
+		})
+	}
+}
+
+func (w *trackingWriter) send() {
+	if w.sent {
+		return
+	}
+	if w.before != nil {
+		w.before()
+	}
+	w.sent = true
+}
+
+func (w *trackingWriter) WriteHeader(status int) {
+	w.send()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	w.send()
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher
+func (w *trackingWriter) Flush() {
+	w.send()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.  Under Middleware the session is saved before
+// the connection is handed over, e.g. for a websocket upgrade, so changes made
+// beforehand are kept.  Its cookie is not sent as the caller writes the response;
+// new sessions should be saved, and their cookie set, before upgrading.
+func (w *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijackNotSupported
+	}
+	w.send()
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *trackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ReadFrom implements io.ReaderFrom so sendfile optimizations are preserved
+func (w *trackingWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.send()
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
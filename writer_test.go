@@ -0,0 +1,447 @@
+// Copyright 2017 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package dynastore
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/savaki/dynastore/dynastoretest"
+)
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestDeferCookies(t *testing.T) {
+	buf := &bytes.Buffer{}
+	store, err := New(DynamoDB(newTestDynamoDB(nil)), Output(buf))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	t.Run("early WriteHeader", func(t *testing.T) {
+		h := DeferCookies(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			session, _ := store.New(req, "blah")
+			if err := store.Save(req, w, session); err != nil {
+				t.Fatalf("expected nil; got %v", err)
+			}
+			io.WriteString(w, "hello")
+		}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Errorf("expected %v; got %v", http.StatusAccepted, w.Code)
+		}
+		if v := len(w.Result().Cookies()); v != 1 {
+			t.Errorf("expected 1 cookie; got %v", v)
+		}
+		if v := w.Body.String(); v != "hello" {
+			t.Errorf("expected hello; got %v", v)
+		}
+	})
+
+	t.Run("status only", func(t *testing.T) {
+		h := DeferCookies(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("expected %v; got %v", http.StatusNoContent, w.Code)
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		buf.Reset()
+		h := DeferCookies(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			io.WriteString(w, "chunk")
+			w.(http.Flusher).Flush()
+			session, _ := store.New(req, "blah")
+			store.Save(req, w, session)
+		}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		h.ServeHTTP(w, req)
+
+		if !w.Flushed {
+			t.Error("expected Flush to pass through")
+		}
+		if !strings.Contains(buf.String(), "headers already sent") {
+			t.Errorf("expected late Save to be logged; got %q", buf.String())
+		}
+	})
+
+	t.Run("hijack", func(t *testing.T) {
+		h := DeferCookies(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusSwitchingProtocols)
+			if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+				t.Errorf("expected nil; got %v", err)
+			}
+		}))
+
+		w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		h.ServeHTTP(w, req)
+
+		if !w.hijacked {
+			t.Error("expected Hijack to pass through")
+		}
+		if w.ResponseRecorder.Flushed || w.ResponseRecorder.Body.Len() > 0 {
+			t.Error("expected nothing to be written after hijack")
+		}
+	})
+
+	t.Run("hijack unsupported", func(t *testing.T) {
+		h := DeferCookies(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if _, _, err := w.(http.Hijacker).Hijack(); err != errHijackNotSupported {
+				t.Errorf("expected errHijackNotSupported; got %v", err)
+			}
+		}))
+
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("ReadFrom", func(t *testing.T) {
+		h := DeferCookies(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.(io.ReaderFrom).ReadFrom(strings.NewReader("body"))
+		}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost", nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated || w.Body.String() != "body" {
+			t.Errorf("expected 201 body; got %v %v", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestResponseWriter(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	t.Run("save then write", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		w := ResponseWriter(rec)
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		session, _ := store.New(req, "blah")
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+		io.WriteString(w, "hello")
+
+		if v := len(rec.Result().Cookies()); v != 1 {
+			t.Errorf("expected 1 cookie; got %v", v)
+		}
+	})
+
+	t.Run("write then save", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		w := ResponseWriter(rec)
+		req := httptest.NewRequest("GET", "http://localhost", nil)
+		session, _ := store.New(req, "blah")
+		io.WriteString(w, "hello")
+		if err := store.Save(req, w, session); err != ErrHeadersSent {
+			t.Fatalf("expected ErrHeadersSent; got %v", err)
+		}
+
+		if db.Item(session.ID) == nil {
+			t.Error("expected session to be persisted")
+		}
+		if v := len(rec.Result().Cookies()); v != 0 {
+			t.Errorf("expected no cookies; got %v", v)
+		}
+	})
+
+	if w := ResponseWriter(httptest.NewRecorder()); ResponseWriter(w) != w {
+		t.Error("expected ResponseWriter not to wrap twice")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	testCases := map[string]func(w http.ResponseWriter){
+		"write":        func(w http.ResponseWriter) { io.WriteString(w, "hello") },
+		"write header": func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) },
+		"flush":        func(w http.ResponseWriter) { w.(http.Flusher).Flush() },
+		"nothing":      func(w http.ResponseWriter) {},
+	}
+
+	for label, respond := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var id string
+			h := Middleware(store, "blah")(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				session, _ := store.Get(req, "blah")
+				session.Values["n"] = 1
+				id = session.ID
+				respond(w)
+				session.Values["late"] = true
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost", nil))
+
+			if v := len(w.Result().Cookies()); v != 1 {
+				t.Fatalf("expected 1 cookie; got %v", v)
+			}
+			if db.Item(id) == nil {
+				t.Fatal("expected session to be persisted")
+			}
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			req.AddCookie(w.Result().Cookies()[0])
+			session, _ := store.New(req, "blah")
+			if v := session.Values["n"]; v != 1 {
+				t.Errorf("expected 1; got %v", v)
+			}
+			if _, late := session.Values["late"]; late != (label == "nothing") {
+				t.Errorf("expected session to be saved before the response was sent")
+			}
+		})
+	}
+}
+
+func TestMiddlewareUnavailable(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	db.Err = func(input interface{}) error {
+		return &types.ProvisionedThroughputExceededException{}
+	}
+
+	called := false
+	h := Middleware(store, "blah")(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	}))
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if v := w.Code; v != http.StatusServiceUnavailable {
+		t.Errorf("expected %v; got %v", http.StatusServiceUnavailable, v)
+	}
+	if called {
+		t.Error("expected handler not to be called")
+	}
+	if v := len(w.Result().Cookies()); v != 0 {
+		t.Errorf("expected no cookie; got %v", v)
+	}
+}
+
+// unwrapWriter stands in for a third-party wrapper that supports Unwrap
+type unwrapWriter struct {
+	http.ResponseWriter
+}
+
+func (w unwrapWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestHeadersSentNested(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	var got error
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		session, _ := store.Get(req, "other")
+		io.WriteString(w, "hello")
+		got = store.Save(req, w, session)
+	})
+	wrap := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(unwrapWriter{ResponseWriter: w}, req)
+		})
+	}
+
+	testCases := map[string]http.Handler{
+		"middleware":            Middleware(store, "blah")(handler),
+		"defer in middleware":   Middleware(store, "blah")(DeferCookies(handler)),
+		"middleware in defer":   DeferCookies(Middleware(store, "blah")(handler)),
+		"wrapped middleware":    Middleware(store, "blah")(wrap(handler)),
+		"wrapped defer":         DeferCookies(wrap(handler)),
+		"untracked":             wrap(handler),
+		"wrapped in middleware": Middleware(store, "blah")(wrap(DeferCookies(wrap(handler)))),
+	}
+
+	for label, h := range testCases {
+		t.Run(label, func(t *testing.T) {
+			got = nil
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost", nil))
+
+			want := ErrHeadersSent
+			if label == "untracked" {
+				want = nil // nothing tracks the headers
+			}
+			if got != want {
+				t.Errorf("expected %v; got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSaved(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	puts := func() (n int) {
+		for _, r := range db.Requests() {
+			if _, ok := r.(*dynamodb.PutItemInput); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	testCases := map[string]struct {
+		change bool
+		want   int
+	}{
+		"unchanged": {want: 1},
+		"changed":   {change: true, want: 2},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var id string
+			before := puts()
+			h := Middleware(store, "blah")(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				session, _ := store.Get(req, "blah")
+				session.Values["n"] = 1
+				id = session.ID
+				if err := store.Save(req, w, session); err != nil {
+					t.Fatalf("expected nil; got %v", err)
+				}
+				if tc.change {
+					session.Values["n"] = 2
+				}
+				io.WriteString(w, "hello")
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost", nil))
+
+			if v := puts() - before; v != tc.want {
+				t.Errorf("expected %v puts; got %v", tc.want, v)
+			}
+			if v := len(w.Result().Cookies()); v != 1 {
+				t.Fatalf("expected 1 cookie; got %v", v)
+			}
+
+			req := httptest.NewRequest("GET", "http://localhost", nil)
+			req.AddCookie(w.Result().Cookies()[0])
+			session, _ := store.New(req, "blah")
+			if session.ID != id {
+				t.Fatalf("expected %v; got %v", id, session.ID)
+			}
+			if want := map[bool]int{false: 1, true: 2}[tc.change]; session.Values["n"] != want {
+				t.Errorf("expected %v; got %v", want, session.Values["n"])
+			}
+		})
+	}
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	db := &dynastoretest.DB{}
+	store, err := New(DynamoDB(db))
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost", nil)
+	session, _ := store.New(req, "blah")
+	session.Values["n"] = 1
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	h := Middleware(store, "blah")(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		session, _ := store.Get(req, "blah")
+		session.Values["n"] = 2
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Fatalf("expected nil; got %v", err)
+		}
+	}))
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookie)
+	hr := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(hr, req)
+	if !hr.hijacked {
+		t.Fatal("expected Hijack to pass through")
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost", nil)
+	req.AddCookie(cookie)
+	session, err = store.New(req, "blah")
+	if err != nil {
+		t.Fatalf("expected nil; got %v", err)
+	}
+	if v := session.Values["n"]; v != 2 {
+		t.Errorf("expected 2; got %v", v)
+	}
+}